@@ -143,6 +143,7 @@ func TestStation13(t *testing.T) {
 				"id":          tc.ID,
 				"subject":     tc.Subject,
 				"description": tc.Description,
+				"priority":    float64(0),
 			}
 
 			now := time.Now().UTC()
@@ -8,6 +8,7 @@ import (
 
 	"github.com/TechBowl-japan/go-stations/db"
 	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
 	"github.com/TechBowl-japan/go-stations/service"
 )
 
@@ -91,7 +92,7 @@ func TestStation18(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			err := service.NewTODOService(todoDB).DeleteTODO(context.Background(), tc.IDs)
+			err := service.NewTODOService(repository.NewSQLiteTODORepository(todoDB)).DeleteTODO(context.Background(), tc.IDs)
 
 			switch tc.WantError {
 			case nil:
@@ -0,0 +1,356 @@
+// Package config loads the server configuration from defaults, a config file,
+// environment variables and command-line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Log levels accepted by Config.LogLevel.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// A Config expresses the configuration of the server.
+type Config struct {
+	// Addr is the TCP address to listen on, like ":8080".
+	Addr string `json:"addr"`
+	// DBPath is the path of the SQLite database file.
+	DBPath string `json:"db_path"`
+	// Timezone is the IANA name of the location used as time.Local.
+	Timezone string `json:"timezone"`
+
+	ReadTimeout     Duration `json:"read_timeout"`
+	WriteTimeout    Duration `json:"write_timeout"`
+	IdleTimeout     Duration `json:"idle_timeout"`
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	ShutdownDelay   Duration `json:"shutdown_delay"`
+
+	// LogLevel is one of debug, info, warn and error. It only gates the access
+	// logs, which are written at info level, while the other logs have no
+	// level and are always written.
+	LogLevel string `json:"log_level"`
+
+	// DefaultPageSize is the number of TODOs listed when size is not given,
+	// and MaxPageSize is the largest size accepted.
+	DefaultPageSize int64 `json:"default_page_size"`
+	MaxPageSize     int64 `json:"max_page_size"`
+	// CursorSecret signs the cursors of pages, so that they stay valid across
+	// restarts and replicas. A random secret is used when empty.
+	CursorSecret string `json:"cursor_secret"`
+
+	// TrashRetention is how long deleted TODOs stay in the trash before they
+	// are purged every PurgeInterval. 0 keeps them forever.
+	TrashRetention Duration `json:"trash_retention"`
+	PurgeInterval  Duration `json:"purge_interval"`
+
+	// WebhookInterval is how often the events of TODO changes are delivered
+	// to the webhooks. 0 disables the deliveries, while the events for the
+	// active webhooks are still kept to be delivered once enabled again, so
+	// the webhooks should be deactivated as well.
+	WebhookInterval Duration `json:"webhook_interval"`
+
+	// CORSOrigins are the origins allowed to call the API from browsers, or
+	// "*" for any origin. CORS is disabled when empty. They may connect to the
+	// WebSocket endpoint as well, which is otherwise open to the same origin
+	// only.
+	CORSOrigins []string `json:"cors_origins"`
+}
+
+// minCursorSecretSize is the smallest size of Config.CursorSecret, the size of
+// the HMAC-SHA256 signing it.
+const minCursorSecretSize = 32
+
+// Default returns Config with the default values.
+func Default() *Config {
+	return &Config{
+		Addr:            ":8080",
+		DBPath:          ".sqlite3/todo.db",
+		Timezone:        "Asia/Tokyo",
+		ReadTimeout:     Duration(10 * time.Second),
+		IdleTimeout:     Duration(60 * time.Second),
+		ShutdownTimeout: Duration(10 * time.Second),
+		LogLevel:        LogLevelInfo,
+		DefaultPageSize: 10,
+		MaxPageSize:     100,
+		TrashRetention:  Duration(30 * 24 * time.Hour),
+		PurgeInterval:   Duration(time.Hour),
+		WebhookInterval: Duration(5 * time.Second),
+		CORSOrigins:     []string{},
+	}
+}
+
+// A field binds a config value to its environment variable and flag.
+type field struct {
+	env, flag, usage string
+	set              func(c *Config, v string) error
+}
+
+var fields = []field{
+	{"PORT", "addr", "TCP address to listen on", func(c *Config, v string) error {
+		c.Addr = v
+		return nil
+	}},
+	{"DB_PATH", "db-path", "path of the SQLite database file", func(c *Config, v string) error {
+		c.DBPath = v
+		return nil
+	}},
+	{"TIMEZONE", "timezone", "IANA name of the time zone", func(c *Config, v string) error {
+		c.Timezone = v
+		return nil
+	}},
+	{"READ_TIMEOUT", "read-timeout", "maximum duration for reading a request", durationSetter(func(c *Config) *Duration { return &c.ReadTimeout })},
+	{"WRITE_TIMEOUT", "write-timeout", "maximum duration for writing a response, 0 for no limit", durationSetter(func(c *Config) *Duration { return &c.WriteTimeout })},
+	{"IDLE_TIMEOUT", "idle-timeout", "maximum duration to keep an idle connection", durationSetter(func(c *Config) *Duration { return &c.IdleTimeout })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "maximum duration to wait for in-flight requests on shutdown", durationSetter(func(c *Config) *Duration { return &c.ShutdownTimeout })},
+	{"SHUTDOWN_DELAY", "shutdown-delay", "duration to keep serving after a shutdown signal", durationSetter(func(c *Config) *Duration { return &c.ShutdownDelay })},
+	{"LOG_LEVEL", "log-level", "one of debug, info, warn and error", func(c *Config, v string) error {
+		c.LogLevel = v
+		return nil
+	}},
+	{"DEFAULT_PAGE_SIZE", "default-page-size", "number of TODOs listed when size is not given", intSetter(func(c *Config) *int64 { return &c.DefaultPageSize })},
+	{"MAX_PAGE_SIZE", "max-page-size", "largest size accepted when listing TODOs", intSetter(func(c *Config) *int64 { return &c.MaxPageSize })},
+	{"CURSOR_SECRET", "cursor-secret", "secret of at least 32 bytes signing the cursors of pages", func(c *Config, v string) error {
+		c.CursorSecret = v
+		return nil
+	}},
+	{"TRASH_RETENTION", "trash-retention", "duration to keep deleted TODOs in the trash, 0 for ever", durationSetter(func(c *Config) *Duration { return &c.TrashRetention })},
+	{"PURGE_INTERVAL", "purge-interval", "interval to purge the trash", durationSetter(func(c *Config) *Duration { return &c.PurgeInterval })},
+	{"WEBHOOK_INTERVAL", "webhook-interval", "interval to deliver events to the webhooks, 0 to disable", durationSetter(func(c *Config) *Duration { return &c.WebhookInterval })},
+	{"CORS_ORIGINS", "cors-origins", "comma separated origins allowed by CORS, or *", func(c *Config, v string) error {
+		c.CORSOrigins = []string{}
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORSOrigins = append(c.CORSOrigins, origin)
+			}
+		}
+		return nil
+	}},
+}
+
+// Load defines the config flags on fs, parses args with it and returns Config
+// merged from, in increasing order of precedence, the defaults, the JSON, YAML
+// or TOML file given by -config or CONFIG_FILE, environment variables looked up with getenv
+// and the flags set in args. Flags of the caller must be defined on fs before.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	path := fs.String("config", "", "path of the JSON, YAML or TOML config file")
+	values := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		values[f.flag] = fs.String(f.flag, "", f.usage+" (env "+f.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+
+	if *path == "" {
+		*path = getenv("CONFIG_FILE")
+	}
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range fields {
+		if v := getenv(f.env); v != "" {
+			if err := f.set(c, v); err != nil {
+				return nil, fmt.Errorf("config: invalid %s: %w", f.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if err == nil && fl.Name == f.flag {
+				if serr := f.set(c, *values[f.flag]); serr != nil {
+					err = fmt.Errorf("config: invalid -%s: %w", f.flag, serr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile overrides c with the fields present in the file at path, which is
+// JSON, YAML or TOML by its extension.
+func (c *Config) loadFile(path string) error {
+	// YAML and TOML are converted to JSON, so that all formats share the keys
+	// and the values accepted
+	var unmarshal func(b []byte, v interface{}) error
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return fmt.Errorf("config: unsupported config file format %q, only .json, .yaml, .yml and .toml are supported", ext)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if unmarshal != nil {
+		var values map[string]interface{}
+		if err := unmarshal(b, &values); err != nil {
+			return fmt.Errorf("config: failed to parse %s: %w", path, err)
+		}
+		if b, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("config: failed to parse %s: %w", path, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	// a misspelled key would otherwise be ignored silently
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config: failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid value of c in one error.
+func (c *Config) Validate() error {
+	var problems []string
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		invalid("addr must be host:port, given = %q", c.Addr)
+	}
+	if c.DBPath == "" {
+		invalid("db_path must not be empty")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" {
+		invalid("timezone must be an IANA time zone name, given = %q", c.Timezone)
+	}
+	for name, d := range map[string]Duration{
+		"read_timeout":     c.ReadTimeout,
+		"write_timeout":    c.WriteTimeout,
+		"idle_timeout":     c.IdleTimeout,
+		"shutdown_timeout": c.ShutdownTimeout,
+		"shutdown_delay":   c.ShutdownDelay,
+		"trash_retention":  c.TrashRetention,
+		"webhook_interval": c.WebhookInterval,
+	} {
+		if d < 0 {
+			invalid("%s must not be negative, given = %s", name, d)
+		}
+	}
+	switch c.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		invalid("log_level must be one of debug, info, warn and error, given = %q", c.LogLevel)
+	}
+	if c.TrashRetention > 0 && c.PurgeInterval <= 0 {
+		invalid("purge_interval must be positive, given = %s", c.PurgeInterval)
+	}
+	if c.MaxPageSize < 1 {
+		invalid("max_page_size must be 1 or more, given = %d", c.MaxPageSize)
+	}
+	if c.DefaultPageSize < 1 || c.DefaultPageSize > c.MaxPageSize {
+		invalid("default_page_size must be between 1 and max_page_size, given = %d", c.DefaultPageSize)
+	}
+	if c.CursorSecret != "" && len(c.CursorSecret) < minCursorSecretSize {
+		invalid("cursor_secret must be at least %d bytes", minCursorSecretSize)
+	}
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			invalid("cors_origins must be origins like https://example.com or *, given = %q", origin)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	// durations are checked in map order
+	sort.Strings(problems)
+	return errors.New("config: " + strings.Join(problems, "; "))
+}
+
+// redacted replaces the secrets in Redacted.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with the secrets replaced, to be printed or
+// logged. A secret not set stays empty.
+func (c *Config) Redacted() *Config {
+	r := *c
+	if r.CursorSecret != "" {
+		r.CursorSecret = redacted
+	}
+	return &r
+}
+
+// LogsAt reports whether messages at level are logged with c.LogLevel.
+func (c *Config) LogsAt(level string) bool {
+	return logLevelOrder(level) >= logLevelOrder(c.LogLevel)
+}
+
+func logLevelOrder(level string) int {
+	switch level {
+	case LogLevelDebug:
+		return 0
+	case LogLevelInfo:
+		return 1
+	case LogLevelWarn:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func durationSetter(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+func intSetter(field func(c *Config) *int64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
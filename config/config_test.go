@@ -0,0 +1,201 @@
+package config_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/TechBowl-japan/go-stations/config"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(file, []byte(`{"addr":":9000","db_path":"file.db","read_timeout":"3s","max_page_size":50,"cors_origins":["https://file.example"]}`), 0o600); err != nil {
+		t.Fatal("failed to write config file, err =", err)
+	}
+	yamlFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(yamlFile, []byte("addr: \":9000\"\ndb_path: file.db\nread_timeout: 3s\nmax_page_size: 50\ncors_origins:\n  - https://file.example\n"), 0o600); err != nil {
+		t.Fatal("failed to write config file, err =", err)
+	}
+	tomlFile := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(tomlFile, []byte("addr = \":9000\"\ndb_path = \"file.db\"\nread_timeout = \"3s\"\nmax_page_size = 50\ncors_origins = [\"https://file.example\"]\n"), 0o600); err != nil {
+		t.Fatal("failed to write config file, err =", err)
+	}
+	unknownYAML := filepath.Join(dir, "unknown.yml")
+	if err := os.WriteFile(unknownYAML, []byte("adr: \":9000\"\n"), 0o600); err != nil {
+		t.Fatal("failed to write config file, err =", err)
+	}
+	unknown := filepath.Join(dir, "unknown.json")
+	if err := os.WriteFile(unknown, []byte(`{"adr":":9000"}`), 0o600); err != nil {
+		t.Fatal("failed to write config file, err =", err)
+	}
+
+	cases := map[string]struct {
+		args []string
+		env  map[string]string
+		want func(c *config.Config)
+		err  string
+	}{
+		"Defaults": {
+			want: func(c *config.Config) {},
+		},
+		"File": {
+			args: []string{"-config", file},
+			want: func(c *config.Config) {
+				c.Addr = ":9000"
+				c.DBPath = "file.db"
+				c.ReadTimeout = config.Duration(3 * time.Second)
+				c.MaxPageSize = 50
+				c.CORSOrigins = []string{"https://file.example"}
+			},
+		},
+		"YAML file": {
+			args: []string{"-config", yamlFile},
+			want: func(c *config.Config) {
+				c.Addr = ":9000"
+				c.DBPath = "file.db"
+				c.ReadTimeout = config.Duration(3 * time.Second)
+				c.MaxPageSize = 50
+				c.CORSOrigins = []string{"https://file.example"}
+			},
+		},
+		"TOML file": {
+			args: []string{"-config", tomlFile},
+			want: func(c *config.Config) {
+				c.Addr = ":9000"
+				c.DBPath = "file.db"
+				c.ReadTimeout = config.Duration(3 * time.Second)
+				c.MaxPageSize = 50
+				c.CORSOrigins = []string{"https://file.example"}
+			},
+		},
+		"Env over file": {
+			env: map[string]string{"CONFIG_FILE": file, "PORT": ":9001", "CORS_ORIGINS": "https://a.example, *", "SHUTDOWN_DELAY": "5s", "WEBHOOK_INTERVAL": "0"},
+			want: func(c *config.Config) {
+				c.Addr = ":9001"
+				c.DBPath = "file.db"
+				c.ReadTimeout = config.Duration(3 * time.Second)
+				c.ShutdownDelay = config.Duration(5 * time.Second)
+				c.WebhookInterval = 0
+				c.MaxPageSize = 50
+				c.CORSOrigins = []string{"https://a.example", "*"}
+			},
+		},
+		"Flags over env": {
+			args: []string{"-config", file, "-addr", "127.0.0.1:9002", "-log-level", "warn"},
+			env:  map[string]string{"PORT": ":9001", "LOG_LEVEL": "debug", "TIMEZONE": "UTC"},
+			want: func(c *config.Config) {
+				c.Addr = "127.0.0.1:9002"
+				c.DBPath = "file.db"
+				c.Timezone = "UTC"
+				c.ReadTimeout = config.Duration(3 * time.Second)
+				c.LogLevel = config.LogLevelWarn
+				c.MaxPageSize = 50
+				c.CORSOrigins = []string{"https://file.example"}
+			},
+		},
+		"Invalid values": {
+			args: []string{"-addr", "8080", "-default-page-size", "200", "-cors-origins", "example.com"},
+			env:  map[string]string{"TIMEZONE": "Mars/Base"},
+			err:  "addr must be host:port",
+		},
+		"Invalid duration": {
+			env: map[string]string{"READ_TIMEOUT": "soon"},
+			err: "invalid READ_TIMEOUT",
+		},
+		"Unknown file key": {
+			args: []string{"-config", unknown},
+			err:  `unknown field "adr"`,
+		},
+		"Unknown YAML file key": {
+			args: []string{"-config", unknownYAML},
+			err:  `unknown field "adr"`,
+		},
+		"Unsupported file format": {
+			args: []string{"-config", filepath.Join(dir, "config.ini")},
+			err:  "unsupported config file format",
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			got, err := config.Load(fs, c.args, func(key string) string { return c.env[key] })
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("unexpected error, given = %v, expected = %s", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to load config, err =", err)
+			}
+
+			want := config.Default()
+			c.want(want)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	c := config.Default()
+	c.Addr = "8080"
+	c.DefaultPageSize = 200
+	c.CORSOrigins = []string{"example.com"}
+	c.LogLevel = "verbose"
+	c.ShutdownTimeout = config.Duration(-time.Second)
+	c.CursorSecret = "short"
+	c.WebhookInterval = config.Duration(-time.Second)
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an error for invalid values")
+	}
+	for _, want := range []string{"addr", "default_page_size", "cors_origins", "log_level", "shutdown_timeout", "cursor_secret", "webhook_interval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing problem, expected = %s, given = %v", want, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	t.Parallel()
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	c := config.Default()
+	c.CursorSecret = secret
+
+	b, err := json.Marshal(c.Redacted())
+	if err != nil {
+		t.Fatal("failed to encode config, err =", err)
+	}
+	if strings.Contains(string(b), secret) || !strings.Contains(string(b), `"cursor_secret":"REDACTED"`) {
+		t.Errorf("secret is not redacted, given = %s", b)
+	}
+	if c.CursorSecret != secret {
+		t.Errorf("original config is changed, given = %q", c.CursorSecret)
+	}
+
+	if b, err := json.Marshal(config.Default().Redacted()); err != nil || !strings.Contains(string(b), `"cursor_secret":""`) {
+		t.Errorf("secret not set is not empty, given = %s, err = %v", b, err)
+	}
+}
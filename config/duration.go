@@ -0,0 +1,35 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A Duration is time.Duration which is written as a string like "10s" in JSON.
+type Duration time.Duration
+
+// String returns the duration formatted like "1m30s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. It accepts a string for
+// time.ParseDuration.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
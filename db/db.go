@@ -1,25 +1,116 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	_ "embed"
+	"encoding/binary"
+	"math"
+	"strings"
+	"unsafe"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-//go:embed schema.sql
-var schema string
+// driverName is go-sqlite3 with the functions this application needs.
+const driverName = "sqlite3_todo"
 
-// NewDB returns go-sqlite3 driver based *sql.DB.
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fts_bm25", ftsBM25, true)
+		},
+	})
+}
+
+// NewDB returns go-sqlite3 driver based *sql.DB with all migrations applied.
 func NewDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDB(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.Exec(schema); err != nil {
+	if _, err := Migrate(context.Background(), db, false); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// OpenDB returns go-sqlite3 driver based *sql.DB as is, without migrating it.
+// Its transactions take the write lock as they begin, so that one reading
+// before it writes waits for the others instead of failing with SQLITE_BUSY.
+// Reads are therefore made outside transactions, not to wait for writers.
+func OpenDB(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return sql.Open(driverName, path+sep+"_txlock=immediate")
+}
+
+// nativeEndian is the byte order of the machine, in which matchinfo is
+// written.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// The parameters of Okapi BM25, the same as the bm25 function of FTS5.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// ftsBM25 scores a full-text search hit by Okapi BM25 from
+// matchinfo(table, 'pcnalx'), with the term frequency of each column weighted
+// by weights and normalized by its length. Higher is better, unlike the bm25
+// function of FTS5. matchinfo only counts the rows having a phrase in each
+// column, so the largest of them stands for the rows having it at all. A
+// phrase found in at least half of the rows scores almost nothing, as in FTS5.
+func ftsBM25(matchinfo []byte, weights ...float64) float64 {
+	info := make([]uint32, len(matchinfo)/4)
+	for i := range info {
+		info[i] = nativeEndian.Uint32(matchinfo[i*4:])
+	}
+	if len(info) < 3 {
+		return 0
+	}
+
+	phrases, columns, rows := int(info[0]), int(info[1]), float64(info[2])
+	if len(info) < 3+2*columns+3*phrases*columns {
+		return 0
+	}
+	avgLengths, lengths, hits := info[3:3+columns], info[3+columns:3+2*columns], info[3+2*columns:]
+
+	var score float64
+	for p := 0; p < phrases; p++ {
+		var rowsWithHits float64
+		for c := 0; c < columns; c++ {
+			rowsWithHits = math.Max(rowsWithHits, float64(hits[3*(p*columns+c)+2]))
+		}
+		idf := math.Log((rows - rowsWithHits + 0.5) / (rowsWithHits + 0.5))
+		if idf <= 0 {
+			idf = 1e-6
+		}
+
+		for c := 0; c < columns; c++ {
+			hitsThisRow := float64(hits[3*(p*columns+c)])
+			if hitsThisRow == 0 {
+				continue
+			}
+			weight := 1.0
+			if c < len(weights) {
+				weight = weights[c]
+			}
+			// the average is rounded to an integer by matchinfo
+			avgLength := math.Max(float64(avgLengths[c]), 1)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(lengths[c])/avgLength)
+			score += weight * idf * hitsThisRow * (bm25K1 + 1) / (hitsThisRow + norm)
+		}
+	}
+	return score
+}
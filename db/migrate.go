@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// ErrUnknownVersion is returned when the database has been migrated by a newer
+// binary than this one.
+var ErrUnknownVersion = errors.New("db: database version is newer than the latest known migration")
+
+// A Migration expresses a versioned change of the schema.
+// Migrations live in migrations/ and are named like 0001_create_todos.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// A MigrationStatus expresses which migrations a database has applied.
+type MigrationStatus struct {
+	Current int64
+	Latest  int64
+	Pending []Migration
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		i := strings.Index(name, "_")
+		if i < 0 {
+			return nil, fmt.Errorf("db: invalid migration name %q", e.Name())
+		}
+		version, err := strconv.ParseInt(name[:i], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("db: invalid migration version %q", e.Name())
+		}
+
+		b, err := migrationFS.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name[i+1:], SQL: string(b)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			return nil, fmt.Errorf("db: migration version %d is missing or duplicated", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Status reports the migration status of db without modifying it.
+func Status(ctx context.Context, db *sql.DB) (*MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := currentVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStatus(current, migrations)
+}
+
+// Migrate applies the pending migrations to db in order and returns the status
+// before they were applied. Each migration runs in its own transaction.
+// If dryRun is true, all pending migrations run in a single transaction which is
+// rolled back, so db is left untouched.
+func Migrate(ctx context.Context, db *sql.DB, dryRun bool) (*MigrationStatus, error) {
+	const (
+		create = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    INTEGER  NOT NULL PRIMARY KEY,
+  name       TEXT     NOT NULL,
+  applied_at DATETIME NOT NULL DEFAULT (DATETIME('now'))
+)`
+		insert = `INSERT INTO schema_migrations(version, name) VALUES(?, ?)`
+	)
+
+	status, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, create); err != nil {
+			return nil, err
+		}
+		for _, m := range status.Pending {
+			if err := apply(ctx, tx, m, insert); err != nil {
+				return nil, err
+			}
+		}
+		return status, nil
+	}
+
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return nil, err
+	}
+	for _, m := range status.Pending {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := apply(ctx, tx, m, insert); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func apply(ctx context.Context, tx *sql.Tx, m Migration, insert string) error {
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return fmt.Errorf("db: failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, insert, m.Version, m.Name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// currentVersion returns the latest applied version. A database that has never
+// been migrated was created by schema.sql, which had todos.completed_at before
+// the migrations replaced it, so that it is at version 2 with the column and 0
+// without it.
+func currentVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	const (
+		exists      = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+		latest      = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+		completedAt = `SELECT COUNT(*) FROM pragma_table_info('todos') WHERE name = 'completed_at'`
+	)
+
+	var n int
+	if err := db.QueryRowContext(ctx, exists).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		if err := db.QueryRowContext(ctx, completedAt).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n != 0 {
+			return 2, nil
+		}
+		return 0, nil
+	}
+
+	var version int64
+	if err := db.QueryRowContext(ctx, latest).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func newStatus(current int64, migrations []Migration) (*MigrationStatus, error) {
+	var latest int64
+	if len(migrations) != 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if current > latest {
+		return nil, fmt.Errorf("%w: database = %d, latest = %d", ErrUnknownVersion, current, latest)
+	}
+
+	return &MigrationStatus{
+		Current: current,
+		Latest:  latest,
+		Pending: migrations[current:],
+	}, nil
+}
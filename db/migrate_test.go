@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/db"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := db.Migrations()
+	if err != nil {
+		t.Fatal("failed to load migrations, err =", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	cases := map[string]struct {
+		setup       string
+		dryRun      bool
+		wantCurrent int64
+		wantPending int
+		wantAfter   int64
+		err         error
+	}{
+		"Empty database": {
+			wantCurrent: 0,
+			wantPending: len(migrations),
+			wantAfter:   latest,
+		},
+		"Dry run": {
+			dryRun:      true,
+			wantCurrent: 0,
+			wantPending: len(migrations),
+			wantAfter:   0,
+		},
+		"Database created before migrations": {
+			setup:       migrations[0].SQL,
+			wantCurrent: 0,
+			wantPending: len(migrations),
+			wantAfter:   latest,
+		},
+		// schema.sql added completed_at to todos before the migrations
+		"Database created with completed_at before migrations": {
+			setup:       migrations[0].SQL + migrations[1].SQL,
+			wantCurrent: 2,
+			wantPending: len(migrations) - 2,
+			wantAfter:   latest,
+		},
+		"Database from a newer binary": {
+			setup: `CREATE TABLE schema_migrations(version INTEGER PRIMARY KEY, name TEXT, applied_at DATETIME);
+INSERT INTO schema_migrations(version, name) VALUES(999, 'future');`,
+			err: db.ErrUnknownVersion,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := db.OpenDB(filepath.Join(t.TempDir(), "migrate_test.db"))
+			if err != nil {
+				t.Fatal("failed to open db, err =", err)
+			}
+			t.Cleanup(func() {
+				if err := d.Close(); err != nil {
+					t.Error("failed to close db, err =", err)
+				}
+			})
+
+			ctx := context.Background()
+			if c.setup != "" {
+				if _, err := d.ExecContext(ctx, c.setup); err != nil {
+					t.Fatal("failed to set up db, err =", err)
+				}
+			}
+
+			status, err := db.Migrate(ctx, d, c.dryRun)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Errorf("unexpected error, given = %v, expected = %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to migrate, err =", err)
+			}
+			if status.Current != c.wantCurrent || len(status.Pending) != c.wantPending {
+				t.Errorf("unexpected status, given = %d/%d pending, expected = %d/%d pending",
+					status.Current, len(status.Pending), c.wantCurrent, c.wantPending)
+			}
+
+			after, err := db.Status(ctx, d)
+			if err != nil {
+				t.Fatal("failed to get status, err =", err)
+			}
+			if after.Current != c.wantAfter {
+				t.Errorf("unexpected version after migration, given = %d, expected = %d", after.Current, c.wantAfter)
+			}
+
+			// migrating again must be a no-op
+			if c.dryRun {
+				return
+			}
+			again, err := db.Migrate(ctx, d, false)
+			if err != nil {
+				t.Fatal("failed to migrate again, err =", err)
+			}
+			if len(again.Pending) != 0 {
+				t.Errorf("unexpected pending migrations, given = %d, expected = 0", len(again.Pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+-- FTS5 is not compiled into go-sqlite3 without the sqlite_fts5 build tag, so
+-- this uses FTS4 with the todos table as external content.
+CREATE VIRTUAL TABLE todos_fts USING fts4(content='todos', subject, description, tokenize=unicode61);
+
+CREATE TRIGGER trigger_todos_fts_before_update BEFORE UPDATE OF subject, description ON todos
+BEGIN
+  DELETE FROM todos_fts WHERE docid = OLD.id;
+END;
+
+CREATE TRIGGER trigger_todos_fts_before_delete BEFORE DELETE ON todos
+BEGIN
+  DELETE FROM todos_fts WHERE docid = OLD.id;
+END;
+
+CREATE TRIGGER trigger_todos_fts_after_update AFTER UPDATE OF subject, description ON todos
+BEGIN
+  INSERT INTO todos_fts(docid, subject, description) VALUES(NEW.id, NEW.subject, NEW.description);
+END;
+
+CREATE TRIGGER trigger_todos_fts_after_insert AFTER INSERT ON todos
+BEGIN
+  INSERT INTO todos_fts(docid, subject, description) VALUES(NEW.id, NEW.subject, NEW.description);
+END;
+
+INSERT INTO todos_fts(todos_fts) VALUES('rebuild');
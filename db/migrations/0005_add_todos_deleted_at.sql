@@ -0,0 +1,3 @@
+ALTER TABLE todos ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS index_todos_deleted_at ON todos(deleted_at);
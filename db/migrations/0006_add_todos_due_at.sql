@@ -0,0 +1,4 @@
+ALTER TABLE todos ADD COLUMN due_at DATETIME;
+
+-- every query on TODOs out of the trash narrows down by deleted_at first
+CREATE INDEX IF NOT EXISTS index_todos_deleted_at_due_at ON todos(deleted_at, due_at);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS tags (
+  id         INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name       TEXT     NOT NULL COLLATE NOCASE UNIQUE,
+  created_at DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(name <> '')
+);
+
+CREATE TABLE IF NOT EXISTS todo_tags (
+  todo_id INTEGER NOT NULL,
+  tag_id  INTEGER NOT NULL,
+  PRIMARY KEY (todo_id, tag_id)
+) WITHOUT ROWID;
+
+-- filtering by tags looks up the TODOs of a tag
+CREATE INDEX IF NOT EXISTS index_todo_tags_tag_id ON todo_tags(tag_id, todo_id);
+
+-- foreign keys are not enforced on the connections, so the links are removed
+-- with the TODO or the tag instead
+CREATE TRIGGER IF NOT EXISTS trigger_todos_tags_after_delete AFTER DELETE ON todos
+BEGIN
+  DELETE FROM todo_tags WHERE todo_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trigger_tags_after_delete AFTER DELETE ON tags
+BEGIN
+  DELETE FROM todo_tags WHERE tag_id = OLD.id;
+END;
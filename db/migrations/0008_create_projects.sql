@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS projects (
+  id          INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  name        TEXT     NOT NULL,
+  description TEXT     NOT NULL DEFAULT '',
+  created_at  DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at  DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(name <> '')
+);
+
+CREATE TRIGGER IF NOT EXISTS trigger_projects_updated_at AFTER UPDATE ON projects
+BEGIN
+  UPDATE projects SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+-- foreign keys are not enforced on the connections, so the repository checks
+-- the project and leaves it before deleting it instead
+ALTER TABLE todos ADD COLUMN project_id INTEGER REFERENCES projects(id);
+
+-- listing and counting the TODOs of a project
+CREATE INDEX IF NOT EXISTS index_todos_project_id_deleted_at ON todos(project_id, deleted_at);
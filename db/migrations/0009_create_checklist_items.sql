@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS checklist_items (
+  id         INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  todo_id    INTEGER  NOT NULL,
+  -- the items of a TODO are numbered from 0 without gaps
+  position   INTEGER  NOT NULL,
+  text       TEXT     NOT NULL,
+  done       BOOLEAN  NOT NULL DEFAULT FALSE,
+  created_at DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(text <> '')
+);
+
+CREATE INDEX IF NOT EXISTS index_checklist_items_todo_id_position ON checklist_items(todo_id, position);
+
+CREATE TRIGGER IF NOT EXISTS trigger_checklist_items_updated_at AFTER UPDATE ON checklist_items
+BEGIN
+  UPDATE checklist_items SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+-- foreign keys are not enforced on the connections, so the items are removed
+-- with the TODO instead
+CREATE TRIGGER IF NOT EXISTS trigger_todos_checklist_items_after_delete AFTER DELETE ON todos
+BEGIN
+  DELETE FROM checklist_items WHERE todo_id = OLD.id;
+END;
@@ -0,0 +1,4 @@
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0 CHECK(priority BETWEEN 0 AND 4);
+
+-- sorting by priority, the most important first
+CREATE INDEX IF NOT EXISTS index_todos_deleted_at_priority ON todos(deleted_at, priority);
@@ -0,0 +1,62 @@
+-- the events of TODO changes, recorded in the same transaction as the change
+-- and dispatched to the webhooks afterwards
+CREATE TABLE IF NOT EXISTS outbox (
+  id            INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  type          TEXT     NOT NULL,
+  todo_id       INTEGER  NOT NULL,
+  -- the JSON of the TODO after the change, NULL when it was deleted
+  todo          TEXT,
+  created_at    DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  dispatched_at DATETIME
+);
+
+-- the events not dispatched yet in order
+CREATE INDEX IF NOT EXISTS index_outbox_undispatched ON outbox(id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id         INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  url        TEXT     NOT NULL,
+  secret     TEXT     NOT NULL,
+  -- comma separated event types, or empty for all
+  events     TEXT     NOT NULL DEFAULT '',
+  active     BOOLEAN  NOT NULL DEFAULT TRUE,
+  created_at DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(url <> '' AND secret <> '')
+);
+
+CREATE TRIGGER IF NOT EXISTS trigger_webhooks_updated_at AFTER UPDATE ON webhooks
+BEGIN
+  UPDATE webhooks SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  webhook_id       INTEGER  NOT NULL,
+  event_id         INTEGER  NOT NULL,
+  status           TEXT     NOT NULL DEFAULT 'pending',
+  attempts         INTEGER  NOT NULL DEFAULT 0,
+  next_attempt_at  DATETIME,
+  last_status_code INTEGER  NOT NULL DEFAULT 0,
+  last_error       TEXT     NOT NULL DEFAULT '',
+  created_at       DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at       DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(status IN ('pending', 'succeeded', 'failed'))
+);
+
+-- claiming the pending deliveries due
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+-- listing the deliveries of a webhook, the latest first
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);
+
+CREATE TRIGGER IF NOT EXISTS trigger_webhook_deliveries_updated_at AFTER UPDATE ON webhook_deliveries
+BEGIN
+  UPDATE webhook_deliveries SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+-- foreign keys are not enforced on the connections, so the deliveries are
+-- removed with the webhook instead
+CREATE TRIGGER IF NOT EXISTS trigger_webhooks_after_delete AFTER DELETE ON webhooks
+BEGIN
+  DELETE FROM webhook_deliveries WHERE webhook_id = OLD.id;
+END;
@@ -0,0 +1,16 @@
+-- finding the deliveries of an event
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_event_id ON webhook_deliveries(event_id);
+
+-- the events dispatched are removed with their last delivery, which holds
+-- them for the delivery log
+CREATE TRIGGER IF NOT EXISTS trigger_webhook_deliveries_after_delete AFTER DELETE ON webhook_deliveries
+WHEN NOT EXISTS (SELECT 1 FROM webhook_deliveries WHERE event_id = OLD.event_id)
+BEGIN
+  DELETE FROM outbox WHERE id = OLD.event_id AND dispatched_at IS NOT NULL;
+END;
+
+-- the events dispatched so far with no delivery left
+DELETE FROM outbox WHERE dispatched_at IS NOT NULL AND id NOT IN (SELECT event_id FROM webhook_deliveries);
+
+-- pruning the deliveries finished
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_finished ON webhook_deliveries(updated_at) WHERE status <> 'pending';
@@ -3,7 +3,9 @@ module github.com/TechBowl-japan/go-stations
 go 1.16
 
 require (
-	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/BurntSushi/toml v1.2.1
+	github.com/google/go-cmp v0.5.9
 	github.com/jstemmer/go-junit-report v0.9.1
 	github.com/mattn/go-sqlite3 v1.14.7
+	gopkg.in/yaml.v3 v3.0.1
 )
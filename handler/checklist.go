@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// serveChecklist handles requests to /todos/{id}/checklist and below, where
+// segments follow checklist.
+func (h *TODOHandler) serveChecklist(w http.ResponseWriter, r *http.Request, todoID int64, segments []string) {
+	switch {
+	case len(segments) == 0:
+		metrics.SetRoute(r, h.Path+"/{id}/checklist")
+		switch r.Method {
+		case http.MethodGet:
+			items, progress, err := h.svc.ReadChecklist(r.Context(), todoID)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			writeResponse(w, &model.ReadChecklistResponse{Checklist: items, Progress: progress})
+
+		case http.MethodPost:
+			var data model.CreateChecklistItemRequest
+			if err := decodeBody(r, &data); err != nil {
+				writeInvalidJSON(w, r, err)
+				return
+			}
+
+			item, err := h.svc.AddChecklistItem(r.Context(), todoID, data.Text, data.Done, data.Position)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			writeResponse(w, &model.CreateChecklistItemResponse{Item: *item})
+
+		default:
+			writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		}
+
+	case len(segments) == 1 && segments[0] == "order":
+		metrics.SetRoute(r, h.Path+"/{id}/checklist/order")
+		if r.Method != http.MethodPut {
+			writeMethodNotAllowed(w, r, http.MethodPut)
+			return
+		}
+
+		var data model.ReorderChecklistRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		items, progress, err := h.svc.ReorderChecklist(r.Context(), todoID, data.IDs)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.ReadChecklistResponse{Checklist: items, Progress: progress})
+
+	case len(segments) == 1:
+		metrics.SetRoute(r, h.Path+"/{id}/checklist/{item_id}")
+		id, err := strconv.ParseInt(segments[0], 10, 64)
+		if err != nil || id <= 0 {
+			writeNotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPatch:
+			var data model.UpdateChecklistItemRequest
+			if err := decodeBody(r, &data); err != nil {
+				writeInvalidJSON(w, r, err)
+				return
+			}
+
+			item, err := h.svc.UpdateChecklistItem(r.Context(), todoID, id, &model.ChecklistItemPatch{Text: data.Text, Done: data.Done})
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			writeResponse(w, &model.UpdateChecklistItemResponse{Item: *item})
+
+		case http.MethodDelete:
+			if err := h.svc.DeleteChecklistItem(r.Context(), todoID, id); err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			writeResponse(w, &model.DeleteChecklistItemResponse{})
+
+		default:
+			writeMethodNotAllowed(w, r, http.MethodPatch, http.MethodDelete)
+		}
+
+	default:
+		writeNotFound(w, r)
+	}
+}
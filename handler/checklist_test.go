@@ -0,0 +1,102 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestTODOHandlerChecklist(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		// want is the texts of the checklist with "!" for done items and its
+		// progress, or the text and position of the item
+		want string
+	}{
+		{name: "Create todo", method: http.MethodPost, target: "/todos", body: `{"subject":"move"}`, wantStatus: http.StatusOK, want: "[] <nil>"},
+		{name: "Add item", method: http.MethodPost, target: "/todos/1/checklist", body: `{"text":" pack "}`, wantStatus: http.StatusOK, want: "pack@0"},
+		{name: "Add done item", method: http.MethodPost, target: "/todos/1/checklist", body: `{"text":"rent a truck","done":true}`, wantStatus: http.StatusOK, want: "rent a truck!@1"},
+		{name: "Insert item", method: http.MethodPost, target: "/todos/1/checklist", body: `{"text":"find a house","position":0}`, wantStatus: http.StatusOK, want: "find a house@0"},
+		{name: "Add empty item", method: http.MethodPost, target: "/todos/1/checklist", body: `{"text":" "}`, wantStatus: http.StatusBadRequest},
+		{name: "Add item at negative position", method: http.MethodPost, target: "/todos/1/checklist", body: `{"text":"clean","position":-1}`, wantStatus: http.StatusBadRequest},
+		{name: "Add item to missing todo", method: http.MethodPost, target: "/todos/99/checklist", body: `{"text":"clean"}`, wantStatus: http.StatusNotFound},
+		{name: "Read checklist", method: http.MethodGet, target: "/todos/1/checklist", wantStatus: http.StatusOK, want: "[find a house pack rent a truck!] 1/3 done"},
+		{name: "Get todo with checklist", method: http.MethodGet, target: "/todos/1", wantStatus: http.StatusOK, want: "[find a house pack rent a truck!] 1/3 done"},
+		{name: "Check item", method: http.MethodPatch, target: "/todos/1/checklist/1", body: `{"done":true}`, wantStatus: http.StatusOK, want: "pack!@1"},
+		{name: "Rename item", method: http.MethodPatch, target: "/todos/1/checklist/3", body: `{"text":"find a flat"}`, wantStatus: http.StatusOK, want: "find a flat@0"},
+		{name: "Rename item empty", method: http.MethodPatch, target: "/todos/1/checklist/3", body: `{"text":""}`, wantStatus: http.StatusBadRequest},
+		{name: "Check missing item", method: http.MethodPatch, target: "/todos/1/checklist/99", body: `{"done":true}`, wantStatus: http.StatusNotFound},
+		{name: "Reorder checklist", method: http.MethodPut, target: "/todos/1/checklist/order", body: `{"ids":[3,2,1]}`, wantStatus: http.StatusOK, want: "[find a flat rent a truck! pack!] 2/3 done"},
+		{name: "Reorder without an item", method: http.MethodPut, target: "/todos/1/checklist/order", body: `{"ids":[3,2]}`, wantStatus: http.StatusBadRequest},
+		{name: "Delete item", method: http.MethodDelete, target: "/todos/1/checklist/2", wantStatus: http.StatusOK},
+		{name: "Read checklist after delete", method: http.MethodGet, target: "/todos/1/checklist", wantStatus: http.StatusOK, want: "[find a flat pack!] 1/2 done"},
+		{name: "Delete missing item", method: http.MethodDelete, target: "/todos/1/checklist/2", wantStatus: http.StatusNotFound},
+		{name: "Method not allowed", method: http.MethodPut, target: "/todos/1/checklist/1", wantStatus: http.StatusMethodNotAllowed},
+		{name: "Unknown path", method: http.MethodGet, target: "/todos/1/checklist/1/done", wantStatus: http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.want == "" {
+			continue
+		}
+
+		var res struct {
+			TODO      *model.TODO            `json:"todo"`
+			Item      *model.ChecklistItem   `json:"item"`
+			Checklist []*model.ChecklistItem `json:"checklist"`
+			Progress  *model.TODOProgress    `json:"progress"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		checklist, progress := res.Checklist, res.Progress
+		if res.TODO != nil {
+			checklist, progress = res.TODO.Checklist, res.TODO.Progress
+		}
+		texts := make([]string, len(checklist))
+		for i, item := range checklist {
+			texts[i] = item.Text
+			if item.Done {
+				texts[i] += "!"
+			}
+		}
+		given := fmt.Sprint(texts, " ", progress)
+		if res.Item != nil {
+			given = res.Item.Text
+			if res.Item.Done {
+				given += "!"
+			}
+			given += fmt.Sprint("@", res.Item.Position)
+		}
+		if given != c.want {
+			t.Errorf("%s: unexpected result, given = %s, expected = %s", c.name, given, c.want)
+		}
+	}
+}
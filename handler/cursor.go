@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// sortFields maps the names taken by the sort query parameter to the fields,
+// where due is the name sort took before due_at.
+var sortFields = map[string]model.TODOSortField{
+	"id":         model.TODOSortID,
+	"priority":   model.TODOSortPriority,
+	"created_at": model.TODOSortCreatedAt,
+	"updated_at": model.TODOSortUpdatedAt,
+	"subject":    model.TODOSortSubject,
+	"due_at":     model.TODOSortDueAt,
+	"due":        model.TODOSortDueAt,
+}
+
+// parseSort parses the sort query parameter, comma separated fields each
+// optionally followed by :asc or :desc. Without a direction, due_at and
+// subject are ascending, and the others descending.
+func parseSort(s string) ([]model.TODOSortKey, error) {
+	var keys []model.TODOSortKey
+	for _, term := range strings.Split(s, ",") {
+		name, direction := term, ""
+		if i := strings.IndexByte(term, ':'); i >= 0 {
+			name, direction = term[:i], term[i+1:]
+		}
+
+		field, ok := sortFields[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.New("must be fields of id, priority, created_at, updated_at, subject or due_at, each optionally followed by :asc or :desc")
+		}
+		key := model.TODOSortKey{Field: field, Desc: field != model.TODOSortDueAt && field != model.TODOSortSubject}
+		switch direction {
+		case "asc":
+			key.Desc = false
+		case "desc":
+			key.Desc = true
+		case "":
+		default:
+			return nil, fmt.Errorf("must have a direction of asc or desc for %s", name)
+		}
+		for _, prev := range keys {
+			if prev.Field == field {
+				return nil, fmt.Errorf("must not have %s twice", field)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// formatSort formats keys in the canonical form of the sort query parameter.
+func formatSort(keys []model.TODOSortKey) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = string(key.Field) + ":asc"
+		if key.Desc {
+			terms[i] = string(key.Field) + ":desc"
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// sortByRank is the order of a listCursor for full-text search hits.
+const sortByRank = "rank"
+
+// A listCursor expresses the last TODO of a page, so that the next page can
+// continue after it. Only the fields sorted by are kept. It is sent to clients
+// as an opaque string signed by encodeCursor, so that a cursor cannot be forged
+// to compare with arbitrary values.
+type listCursor struct {
+	// Sort is the canonical sort the page was listed in, or sortByRank.
+	Sort      string     `json:"sort"`
+	ID        int64      `json:"id"`
+	Priority  int        `json:"priority,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// newListCursor returns the cursor after todo in the order of keys, or by
+// rank if sort is sortByRank.
+func newListCursor(sort string, keys []model.TODOSortKey, todo *model.TODO) *listCursor {
+	c := &listCursor{Sort: sort, ID: todo.ID}
+	if sort == sortByRank {
+		return c
+	}
+	for _, key := range keys {
+		switch key.Field {
+		case model.TODOSortPriority:
+			c.Priority = todo.Priority
+		case model.TODOSortSubject:
+			c.Subject = todo.Subject
+		case model.TODOSortDueAt:
+			c.DueAt = todo.DueAt
+		case model.TODOSortCreatedAt:
+			c.CreatedAt = &todo.CreatedAt
+		case model.TODOSortUpdatedAt:
+			c.UpdatedAt = &todo.UpdatedAt
+		}
+	}
+	return c
+}
+
+// todo returns the TODO the cursor continues after, with the fields kept.
+func (c *listCursor) todo() *model.TODO {
+	todo := &model.TODO{
+		ID:       c.ID,
+		Priority: c.Priority,
+		Subject:  c.Subject,
+		DueAt:    c.DueAt,
+	}
+	if c.CreatedAt != nil {
+		todo.CreatedAt = *c.CreatedAt
+	}
+	if c.UpdatedAt != nil {
+		todo.UpdatedAt = *c.UpdatedAt
+	}
+	return todo
+}
+
+// newCursorKey returns a random key for signing cursors, which are valid until
+// the process exits.
+func newCursorKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("handler: failed to generate cursor key: %v", err))
+	}
+	return key
+}
+
+// encodeCursor encodes c to the opaque string of the cursor query parameter,
+// the JSON of c followed by its HMAC-SHA256 with key, both in base64url.
+func encodeCursor(key []byte, c *listCursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(cursorMAC(key, b)), nil
+}
+
+// decodeCursor decodes the cursor query parameter s of a page listed in sort,
+// signed with key.
+func decodeCursor(key []byte, s, sort string) (*listCursor, error) {
+	// a forged cursor is told no more than a malformed one
+	malformed := errors.New("is malformed")
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return nil, malformed
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s[:i])
+	if err != nil {
+		return nil, malformed
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(s[i+1:])
+	if err != nil || !hmac.Equal(mac, cursorMAC(key, b)) {
+		return nil, malformed
+	}
+
+	var c listCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return nil, malformed
+	}
+	if c.Sort != sort {
+		return nil, errors.New("was given for another sort or q")
+	}
+	return &c, nil
+}
+
+// cursorMAC returns the HMAC-SHA256 of the cursor JSON b with key.
+func cursorMAC(key, b []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// writeError writes err as a problem response.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, problemFor(err))
+}
+
+// problemFor returns the problem of err. This is the only place which decides
+// the status code and error code of an error.
+func problemFor(err error) *model.ProblemResponse {
+	var (
+		notFound           *model.ErrNotFound
+		validation         *model.ErrValidation
+		preconditionFailed *model.ErrPreconditionFailed
+		conflict           *model.ErrConflict
+		sqliteErr          sqlite3.Error
+	)
+	switch {
+	case errors.As(err, &validation):
+		return &model.ProblemResponse{
+			Status:        http.StatusBadRequest,
+			Code:          model.ErrorCodeValidationFailed,
+			Detail:        "The request has invalid fields.",
+			InvalidParams: validation.Params,
+		}
+	case errors.As(err, &notFound):
+		return &model.ProblemResponse{
+			Status: http.StatusNotFound,
+			Code:   model.ErrorCodeNotFound,
+			Detail: notFoundDetail(notFound),
+		}
+	case errors.As(err, &preconditionFailed):
+		return &model.ProblemResponse{
+			Status: http.StatusPreconditionFailed,
+			Code:   model.ErrorCodePreconditionFailed,
+			Detail: "The TODO was changed since the version of If-Match.",
+		}
+	case errors.As(err, &conflict):
+		return &model.ProblemResponse{
+			Status: http.StatusConflict,
+			Code:   model.ErrorCodeConflict,
+			Detail: conflict.What,
+		}
+	case errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint:
+		return &model.ProblemResponse{
+			Status: http.StatusBadRequest,
+			Code:   model.ErrorCodeConstraintViolation,
+			Detail: "The request violates a constraint of the TODO.",
+		}
+	case errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked):
+		log.Println(err)
+		return &model.ProblemResponse{
+			Status: http.StatusServiceUnavailable,
+			Code:   model.ErrorCodeDatabaseUnavailable,
+			Detail: "The database is busy, retry later.",
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Println(err)
+		return &model.ProblemResponse{
+			Status: http.StatusServiceUnavailable,
+			Code:   model.ErrorCodeTimeout,
+			Detail: "The request timed out.",
+		}
+	default:
+		log.Println(err)
+		return &model.ProblemResponse{
+			Status: http.StatusInternalServerError,
+			Code:   model.ErrorCodeInternal,
+		}
+	}
+}
+
+// notFoundDetail tells what was not found by err.
+func notFoundDetail(err *model.ErrNotFound) string {
+	switch err.Resource {
+	case model.ResourceTag:
+		return "Tag not found."
+	case model.ResourceProject:
+		return "Project not found."
+	case model.ResourceChecklistItem:
+		return "Checklist item not found."
+	case model.ResourceWebhook:
+		return "Webhook not found."
+	case model.ResourceWebhookDelivery:
+		return "Webhook delivery not found."
+	default:
+		return "TODO not found."
+	}
+}
+
+// writeInvalidJSON writes a problem response for a request body which is not
+// valid JSON.
+func writeInvalidJSON(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, invalidJSONProblem(err))
+}
+
+// invalidJSONProblem returns the problem of a message which is not valid JSON.
+func invalidJSONProblem(err error) *model.ProblemResponse {
+	return &model.ProblemResponse{
+		Status: http.StatusBadRequest,
+		Code:   model.ErrorCodeInvalidJSON,
+		Detail: "Failed to parse JSON: " + err.Error(),
+	}
+}
+
+// writeNotFound writes a problem response for a path which has no resource.
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, &model.ProblemResponse{
+		Status: http.StatusNotFound,
+		Code:   model.ErrorCodeNotFound,
+		Detail: "No resource at this path.",
+	})
+}
+
+// writeMethodNotAllowed writes a problem response for a method which the path
+// does not accept.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	for _, m := range allowed {
+		w.Header().Add("Allow", m)
+	}
+	writeProblem(w, r, &model.ProblemResponse{
+		Status: http.StatusMethodNotAllowed,
+		Code:   model.ErrorCodeMethodNotAllowed,
+	})
+}
+
+// writeUnsupportedMediaType writes a problem response for a request body in a
+// media type which the path does not accept.
+func writeUnsupportedMediaType(w http.ResponseWriter, r *http.Request, accepted ...string) {
+	writeProblem(w, r, &model.ProblemResponse{
+		Status: http.StatusUnsupportedMediaType,
+		Code:   model.ErrorCodeUnsupportedMedia,
+		Detail: "The body must be one of " + strings.Join(accepted, ", ") + ".",
+	})
+}
+
+// writeProblem fills the common fields of p and writes it.
+func writeProblem(w http.ResponseWriter, r *http.Request, p *model.ProblemResponse) {
+	fillProblem(r, p)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Println(err)
+	}
+}
+
+// fillProblem fills the common fields of p about r.
+func fillProblem(r *http.Request, p *model.ProblemResponse) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.RequestIDFromContext(r.Context())
+}
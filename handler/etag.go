@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// etag returns the strong entity tag of todo, which is its quoted version.
+func etag(todo *model.TODO) string {
+	return `"` + strconv.FormatInt(todo.Version, 10) + `"`
+}
+
+// setETag sets the ETag header of todo.
+func setETag(w http.ResponseWriter, todo *model.TODO) {
+	w.Header().Set("ETag", etag(todo))
+}
+
+// parseETags splits an If-Match or If-None-Match header into entity tags.
+// wildcard reports whether it is "*".
+func parseETags(header string) (tags []string, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		switch tag {
+		case "":
+		case "*":
+			return nil, true
+		default:
+			tags = append(tags, tag)
+		}
+	}
+	return tags, false
+}
+
+// noneMatch reports whether the If-None-Match header of r does not match todo,
+// comparing entity tags weakly as RFC 7232 requires. It is true without the
+// header.
+func noneMatch(r *http.Request, todo *model.TODO) bool {
+	tags, wildcard := parseETags(r.Header.Get("If-None-Match"))
+	if wildcard {
+		return false
+	}
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == etag(todo) {
+			return false
+		}
+	}
+	return true
+}
+
+// ifMatchVersion returns the version of the TODO by id which the If-Match
+// header of r requires, or 0 if it has no condition. A single strong tag is
+// passed down as is, so that the version is checked in the same statement as
+// the change. Otherwise the current version is compared here.
+func (h *TODOHandler) ifMatchVersion(ctx context.Context, r *http.Request, id int64) (int64, error) {
+	tags, wildcard := parseETags(r.Header.Get("If-Match"))
+	if wildcard || len(tags) == 0 {
+		return 0, nil
+	}
+
+	if len(tags) == 1 {
+		v, err := strconv.ParseInt(strings.Trim(tags[0], `"`), 10, 64)
+		if err == nil && v > 0 && tags[0] == `"`+strconv.FormatInt(v, 10)+`"` {
+			return v, nil
+		}
+	}
+
+	todo, err := h.svc.GetTODO(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range tags {
+		// weak tags never match If-Match
+		if tag == etag(todo) {
+			return todo.Version, nil
+		}
+	}
+	return 0, &model.ErrPreconditionFailed{ID: id}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// eventRetry is the reconnection time suggested to EventSource clients.
+const eventRetry = 3 * time.Second
+
+// serveEvents handles requests to /todos/events, streaming the changes of
+// TODOs as Server-Sent Events. A client resuming with Last-Event-ID is sent
+// the events it missed first, or a reset event if they are no longer kept, to
+// read the TODOs again. A client falling too far behind is disconnected to
+// resume likewise. The ids sent are prefixed by the epoch of the events, so
+// that the ones from before a restart reset the client rather than match other
+// events.
+func (h *TODOHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.New("handler: response writer does not implement http.Flusher"))
+		return
+	}
+
+	var epoch, lastID int64
+	if lastIDStr := r.Header.Get("Last-Event-ID"); len(lastIDStr) != 0 {
+		var err error
+		if epoch, lastID, err = parseEventID(lastIDStr); err != nil {
+			writeError(w, r, model.NewErrValidation("Last-Event-ID", "must be an event id"))
+			return
+		}
+	}
+
+	events := h.svc.Events()
+	sub, replay, complete := events.Subscribe(epoch, lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// reverse proxies like nginx would buffer the stream otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds()); err != nil {
+		return
+	}
+	if !complete {
+		if _, err := fmt.Fprintf(w, "id: %d-%d\nevent: reset\ndata: {}\n\n", events.Epoch(), sub.LastID); err != nil {
+			return
+		}
+	}
+	for _, e := range replay {
+		if err := writeEvent(w, events.Epoch(), e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.Shutdown:
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, events.Epoch(), e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// a comment line, which clients ignore
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes e of epoch as a Server-Sent Event, named by its type with
+// its JSON as the data.
+func writeEvent(w io.Writer, epoch int64, e *model.TODOEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d-%d\nevent: %s\ndata: %s\n\n", epoch, e.ID, e.Type, data)
+	return err
+}
+
+// parseEventID parses the id of a Server-Sent Event written by writeEvent. An
+// id without epoch, as sent before the ids had one, is of epoch 0, which
+// never matches.
+func parseEventID(s string) (epoch, id int64, err error) {
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if epoch, err = strconv.ParseInt(s[:i], 10, 64); err != nil {
+			return 0, 0, err
+		}
+		s = s[i+1:]
+	}
+	if id, err = strconv.ParseInt(s, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if epoch < 0 || id < 0 {
+		return 0, 0, errors.New("handler: negative event id")
+	}
+	return epoch, id, nil
+}
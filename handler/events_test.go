@@ -0,0 +1,261 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestTODOHandlerEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	h := handler.NewTODOHandler(svc)
+	h.HeartbeatInterval = 50 * time.Millisecond
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// open connects to the stream and skips to after the retry field
+	open := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/todos/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("failed to connect, err =", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected response, status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		r := bufio.NewReader(resp.Body)
+		if given := readEvent(t, r); !strings.HasPrefix(given, "retry: ") {
+			t.Fatalf("unexpected first event, given = %q", given)
+		}
+		return resp, r
+	}
+
+	epoch := svc.Events().Epoch()
+	resp, r := open("")
+	created, err := svc.CreateTODO(ctx, "watch", "")
+	if err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	if _, err := svc.MarkTODODone(ctx, created.ID); err != nil {
+		t.Fatal("failed to complete todo, err =", err)
+	}
+	// only the TODO moved to the trash is published, once
+	if err := svc.DeleteTODO(ctx, []int64{created.ID, 99, created.ID}); err != nil {
+		t.Fatal("failed to delete todo, err =", err)
+	}
+
+	for _, want := range []struct {
+		id      int64
+		typ     model.TODOEventType
+		hasTODO bool
+	}{
+		{1, model.TODOEventCreated, true},
+		{2, model.TODOEventUpdated, true},
+		{3, model.TODOEventDeleted, false},
+	} {
+		given := readEvent(t, r)
+		prefix := fmt.Sprintf("id: %d-%d\nevent: %s\ndata: ", epoch, want.id, want.typ)
+		if !strings.HasPrefix(given, prefix) {
+			t.Fatalf("unexpected event, given = %q, expected prefix = %q", given, prefix)
+		}
+		var e model.TODOEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(given, prefix)), &e); err != nil {
+			t.Fatal("failed to decode event, err =", err)
+		}
+		if e.ID != want.id || e.TODOID != created.ID || (e.TODO != nil) != want.hasTODO {
+			t.Errorf("unexpected event data, given = %+v", e)
+		}
+	}
+	if given := readEvent(t, r); given != ": heartbeat" {
+		t.Errorf("unexpected heartbeat, given = %q", given)
+	}
+	resp.Body.Close()
+
+	// resuming replays the events after Last-Event-ID
+	resp, r = open(fmt.Sprintf("%d-1", epoch))
+	for _, id := range []int64{2, 3} {
+		if given := readEvent(t, r); !strings.HasPrefix(given, fmt.Sprintf("id: %d-%d\n", epoch, id)) {
+			t.Errorf("unexpected replayed event, given = %q, expected id = %d", given, id)
+		}
+	}
+	resp.Body.Close()
+
+	// an unknown id resets the client to the latest event, as does one of
+	// another process, although the same id is kept here
+	stale := service.NewTODOService(repository.NewMemoryTODORepository()).Events().Epoch()
+	for _, lastEventID := range []string{fmt.Sprintf("%d-99", epoch), fmt.Sprintf("%d-1", stale), "1"} {
+		resp, r = open(lastEventID)
+		if given, want := readEvent(t, r), fmt.Sprintf("id: %d-3\nevent: reset\ndata: {}", epoch); given != want {
+			t.Errorf("unexpected reset event for %q, given = %q, expected = %q", lastEventID, given, want)
+		}
+		resp.Body.Close()
+	}
+
+	for name, c := range map[string]struct {
+		method      string
+		lastEventID string
+		wantStatus  int
+	}{
+		"Invalid Last-Event-ID":       {method: http.MethodGet, lastEventID: "x", wantStatus: http.StatusBadRequest},
+		"Invalid Last-Event-ID epoch": {method: http.MethodGet, lastEventID: "x-1", wantStatus: http.StatusBadRequest},
+		"Post":                        {method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(c.method, "/todos/events", nil)
+		req.Header.Set("Last-Event-ID", c.lastEventID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d", name, rec.Code, c.wantStatus)
+		}
+	}
+}
+
+func TestTODOHandlerEventsAtomic(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	sub, _, _ := svc.Events().Subscribe(0, 0)
+	defer sub.Close()
+
+	// the changes of a failed unit of work are neither kept nor published
+	errAbort := errors.New("abort")
+	err := svc.Atomic(ctx, func(svc *service.TODOService) error {
+		if _, err := svc.CreateTODO(ctx, "discarded", ""); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("unexpected error, given = %v, expected = %v", err, errAbort)
+	}
+	if n, err := svc.CountTODO(ctx); err != nil || n != 0 {
+		t.Errorf("unexpected todos after failure, given = %d, err = %v", n, err)
+	}
+
+	// the changes of a kept unit of work are published only once it returns
+	err = svc.Atomic(ctx, func(svc *service.TODOService) error {
+		todo, err := svc.CreateTODO(ctx, "kept", "")
+		if err != nil {
+			return err
+		}
+		subject := "patched"
+		if _, err := svc.PatchTODO(ctx, todo.ID, &model.TODOPatch{Subject: &subject}); err != nil {
+			return err
+		}
+		if len(sub.C()) != 0 {
+			t.Error("unexpected event published before the unit of work returns")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("failed to run unit of work, err =", err)
+	}
+
+	for _, want := range []string{"todo.created kept", "todo.updated patched"} {
+		select {
+		case e := <-sub.C():
+			if given := fmt.Sprintf("%s %s", e.Type, e.TODO.Subject); given != want {
+				t.Errorf("unexpected event, given = %s, expected = %s", given, want)
+			}
+		default:
+			t.Fatalf("missing event, expected = %s", want)
+		}
+	}
+}
+
+func TestTODOHandlerEventsCascade(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	tags := service.NewTagService(svc)
+	projects := service.NewProjectService(svc)
+	sub, _, _ := svc.Events().Subscribe(0, 0)
+	defer sub.Close()
+
+	project, err := projects.CreateProject(ctx, "work", "")
+	if err != nil {
+		t.Fatal("failed to create project, err =", err)
+	}
+	todo, err := svc.CreateTODO(ctx, "tagged", "", service.WithTags([]string{"tag"}), service.WithProject(&project.ID))
+	if err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	tag, err := tags.CreateTag(ctx, "other")
+	if err != nil {
+		t.Fatal("failed to create tag, err =", err)
+	}
+	read, err := tags.ReadTags(ctx)
+	if err != nil || len(read) != 2 || read[1].ID == tag.ID {
+		t.Fatalf("unexpected tags, given = %+v, err = %v", read, err)
+	}
+
+	// the TODOs changed along with their tag or project are published
+	if _, err := tags.RenameTag(ctx, read[1].ID, "renamed"); err != nil {
+		t.Fatal("failed to rename tag, err =", err)
+	}
+	if err := tags.DeleteTag(ctx, tag.ID); err != nil {
+		t.Fatal("failed to delete tag, err =", err)
+	}
+	if err := projects.DeleteProject(ctx, project.ID, true); err != nil {
+		t.Fatal("failed to delete project, err =", err)
+	}
+
+	for _, want := range []string{"todo.created [tag]", "todo.updated [renamed]", "todo.deleted"} {
+		select {
+		case e := <-sub.C():
+			given := string(e.Type)
+			if e.TODO != nil {
+				given += fmt.Sprintf(" %v", e.TODO.Tags)
+			}
+			if e.TODOID != todo.ID || given != want {
+				t.Errorf("unexpected event, given = %d %s, expected = %d %s", e.TODOID, given, todo.ID, want)
+			}
+		default:
+			t.Fatalf("missing event, expected = %s", want)
+		}
+	}
+	if len(sub.C()) != 0 {
+		t.Errorf("unexpected events, given = %d more", len(sub.C()))
+	}
+}
+
+// readEvent reads the lines of an event up to the blank line ending it.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("failed to read event, err =", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A MetricsHandler implements the endpoint of metrics in the Prometheus text
+// exposition format.
+type MetricsHandler struct {
+	http *metrics.HTTP
+	db   *sql.DB
+	svc  *service.TODOService
+	Path string
+}
+
+// NewMetricsHandler returns MetricsHandler based http.Handler.
+func NewMetricsHandler(m *metrics.HTTP, db *sql.DB, svc *service.TODOService) *MetricsHandler {
+	return &MetricsHandler{
+		http: m,
+		db:   db,
+		svc:  svc,
+		Path: "/metrics",
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	// count first, so that a failure can still be responded as an error
+	statuses := []model.TODOStatus{model.TODOStatusOpen, model.TODOStatusDone}
+	counts := make([]int64, len(statuses))
+	for i, status := range statuses {
+		n, err := h.svc.CountTODO(r.Context(), service.WithStatus(status))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		counts[i] = n
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+
+	h.http.Write(mw)
+	metrics.WriteDBStats(mw, h.db.Stats())
+
+	mw.Header("todos", metrics.TypeGauge, "Number of TODOs by status.")
+	for i, status := range statuses {
+		mw.Sample("todos", metrics.Labels{"status": string(status)}, float64(counts[i]))
+	}
+
+	if err := mw.Flush(); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,70 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestHandlerRoutes(t *testing.T) {
+	t.Parallel()
+
+	repo := repository.NewMemoryTODORepository()
+	svc := service.NewTODOService(repo)
+	todoHandler := handler.NewTODOHandler(svc)
+	projectHandler := handler.NewProjectHandler(service.NewProjectService(svc), todoHandler)
+	webhookHandler := handler.NewWebhookHandler(service.NewWebhookService(repo))
+
+	// the handlers are instrumented as the router does
+	m := metrics.NewHTTP()
+	mux := http.NewServeMux()
+	mux.Handle("/todos", m.Instrument("/todos", todoHandler))
+	mux.Handle("/todos/", m.Instrument("/todos/{id}", todoHandler))
+	mux.Handle("/projects/", m.Instrument("/projects/{id}", projectHandler))
+	mux.Handle("/webhooks/", m.Instrument("/webhooks/{id}", webhookHandler))
+
+	cases := []struct {
+		method, target, body, wantRoute string
+	}{
+		{method: http.MethodPost, target: "/todos", body: `{"subject":"move"}`, wantRoute: "/todos"},
+		{method: http.MethodGet, target: "/todos/1", wantRoute: "/todos/{id}"},
+		{method: http.MethodPut, target: "/todos/1/done", wantRoute: "/todos/{id}/done"},
+		{method: http.MethodPut, target: "/todos/1/undone", wantRoute: "/todos/{id}/undone"},
+		{method: http.MethodGet, target: "/todos/1/checklist", wantRoute: "/todos/{id}/checklist"},
+		{method: http.MethodPut, target: "/todos/1/checklist/order", body: `{"ids":[]}`, wantRoute: "/todos/{id}/checklist/order"},
+		{method: http.MethodDelete, target: "/todos/1/checklist/1", wantRoute: "/todos/{id}/checklist/{item_id}"},
+		{method: http.MethodPost, target: "/todos/1/restore", wantRoute: "/todos/{id}/restore"},
+		{method: http.MethodGet, target: "/todos/trash", wantRoute: "/todos/trash"},
+		{method: http.MethodDelete, target: "/todos/trash/1", wantRoute: "/todos/trash/{id}"},
+		{method: http.MethodGet, target: "/projects/1/todos", wantRoute: "/projects/{id}/todos"},
+		{method: http.MethodGet, target: "/webhooks/1/deliveries", wantRoute: "/webhooks/{id}/deliveries"},
+		// unknown paths keep the route given to Instrument
+		{method: http.MethodGet, target: "/todos/1/unknown", wantRoute: "/todos/{id}"},
+	}
+
+	for _, c := range cases {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, c.target, strings.NewReader(c.body)))
+	}
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	m.Write(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal("failed to write metrics, err =", err)
+	}
+	got := buf.String()
+
+	for _, c := range cases {
+		want := `method="` + c.method + `",route="` + c.wantRoute + `"}`
+		if !strings.Contains(got, want) {
+			t.Errorf("%s %s: missing route, expected = %q, given =\n%s", c.method, c.target, want, got)
+		}
+	}
+}
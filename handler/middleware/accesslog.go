@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// An AccessLogEntry expresses a line of the access log.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	LatencyMS  float64   `json:"latency_ms"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog returns Middleware which writes an AccessLogEntry to sink as a
+// line of JSON after each request. Place it inside RequestID to log the ID.
+func AccessLog(sink io.Writer) Middleware {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(sink)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			entry := &AccessLogEntry{
+				Time:       start,
+				RequestID:  RequestIDFromContext(r.Context()),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     rec.statusCode(),
+				Bytes:      rec.bytes,
+				LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err := encoder.Encode(entry); err != nil {
+				log.Println("middleware: failed to write access log, err =", err)
+			}
+		})
+	}
+}
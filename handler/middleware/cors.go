@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS returns Middleware which allows browsers on origins to call the API.
+// An origin of "*" allows any origin. Preflight requests from allowed origins
+// are answered here without reaching next. It does nothing if origins is
+// empty.
+func CORS(origins []string) Middleware {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !allowed["*"] && !allowed[origin] {
+				// without the CORS headers the browser rejects the response
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Expose-Headers", RequestIDHeader+", ETag")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
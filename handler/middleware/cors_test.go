@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	cases := map[string]struct {
+		origins    []string
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantAllow  string
+	}{
+		"Disabled":          {method: http.MethodGet, origin: "https://a.example", wantStatus: http.StatusOK},
+		"Allowed":           {origins: []string{"https://a.example"}, method: http.MethodGet, origin: "https://a.example", wantStatus: http.StatusOK, wantAllow: "https://a.example"},
+		"Not allowed":       {origins: []string{"https://a.example"}, method: http.MethodGet, origin: "https://b.example", wantStatus: http.StatusOK},
+		"Wildcard":          {origins: []string{"*"}, method: http.MethodGet, origin: "https://b.example", wantStatus: http.StatusOK, wantAllow: "https://b.example"},
+		"Same origin":       {origins: []string{"*"}, method: http.MethodGet, wantStatus: http.StatusOK},
+		"Preflight":         {origins: []string{"https://a.example/"}, method: http.MethodOptions, origin: "https://a.example", preflight: true, wantStatus: http.StatusNoContent, wantAllow: "https://a.example"},
+		"Preflight refused": {origins: []string{"https://a.example"}, method: http.MethodOptions, origin: "https://b.example", preflight: true, wantStatus: http.StatusOK},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(c.method, "/todos", nil)
+			if c.origin != "" {
+				req.Header.Set("Origin", c.origin)
+			}
+			if c.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+				req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+			}
+			rec := httptest.NewRecorder()
+			middleware.CORS(c.origins)(ok).ServeHTTP(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("unexpected status, given = %d, expected = %d", rec.Code, c.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != c.wantAllow {
+				t.Errorf("unexpected allowed origin, given = %s, expected = %s", got, c.wantAllow)
+			}
+			if c.preflight && c.wantAllow != "" && rec.Header().Get("Access-Control-Allow-Headers") != "Content-Type" {
+				t.Errorf("unexpected allowed headers, given = %s", rec.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+)
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	t.Parallel()
+
+	var (
+		sink  bytes.Buffer
+		seen  string
+		inner = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = middleware.RequestIDFromContext(r.Context())
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+		})
+	)
+	h := middleware.Chain(inner, middleware.RequestID, middleware.AccessLog(&sink))
+
+	cases := map[string]struct {
+		requestID string
+		wantKept  bool
+	}{
+		"Given":   {requestID: "abc-123", wantKept: true},
+		"Missing": {requestID: ""},
+		"Unsafe":  {requestID: "bad\"id\n"},
+	}
+
+	// cases run one by one since they share the sink
+	for name, c := range cases {
+		sink.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/todos?q=x", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if c.requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, c.requestID)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(middleware.RequestIDHeader)
+		if id == "" || id != seen {
+			t.Errorf("%s: unexpected request id, given = %s, expected = %s", name, id, seen)
+		}
+		if (id == c.requestID) != c.wantKept {
+			t.Errorf("%s: unexpected request id, given = %s, kept = %t", name, id, c.wantKept)
+		}
+
+		var entry middleware.AccessLogEntry
+		if err := json.Unmarshal(sink.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: failed to decode access log, err = %v, log = %s", name, err, sink.String())
+		}
+		if entry.RequestID != id || entry.Method != http.MethodPost || entry.Path != "/todos" ||
+			entry.Status != http.StatusCreated || entry.Bytes != 5 || entry.RemoteAddr != "192.0.2.1:1234" ||
+			entry.LatencyMS < 0 || entry.Time.IsZero() {
+			t.Errorf("%s: unexpected access log, given = %+v", name, entry)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	var order []string
+	mw := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := middleware.Chain(http.NotFoundHandler(), mw("first"), mw("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("unexpected order, given = %v, expected = [first second]", order)
+	}
+}
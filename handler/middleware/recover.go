@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// Recover returns Middleware which recovers a panic in next, logs it with the
+// stack trace and the request ID to logger, and responds 500 Internal Server
+// Error as a problem if nothing has been written yet. onPanic is called for
+// every recovered panic unless it is nil. Place it inside RequestID and
+// AccessLog so that both see the request as failed.
+func Recover(logger *log.Logger, onPanic func()) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				// net/http uses ErrAbortHandler to abort a response on purpose
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				if onPanic != nil {
+					onPanic()
+				}
+				id := RequestIDFromContext(r.Context())
+				logger.Printf("middleware: recovered panic, request_id = %s, method = %s, path = %s, err = %v\n%s",
+					id, r.Method, r.URL.Path, v, debug.Stack())
+
+				if rec.written() {
+					// too late to change the status, so cut the response off
+					panic(http.ErrAbortHandler)
+				}
+				writeInternalError(w, r, id)
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// writeInternalError writes the same problem response as the handler package
+// does for an unexpected error.
+func writeInternalError(w http.ResponseWriter, r *http.Request, requestID string) {
+	p := &model.ProblemResponse{
+		Type:      "about:blank",
+		Title:     http.StatusText(http.StatusInternalServerError),
+		Status:    http.StatusInternalServerError,
+		Instance:  r.URL.Path,
+		Code:      model.ErrorCodeInternal,
+		RequestID: requestID,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Println(err)
+	}
+}
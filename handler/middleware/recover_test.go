@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		handler    http.HandlerFunc
+		wantStatus int
+		wantPanics int
+		wantAbort  bool
+	}{
+		"No panic": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+		},
+		"Nil dereference": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var todo *model.TODO
+				w.Write([]byte(todo.Subject))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantPanics: 1,
+		},
+		"Panic after write": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			wantStatus: http.StatusAccepted,
+			wantPanics: 1,
+			wantAbort:  true,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				logs   bytes.Buffer
+				panics int
+			)
+			h := middleware.Chain(c.handler,
+				middleware.RequestID,
+				middleware.Recover(log.New(&logs, "", 0), func() { panics++ }),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+			req.Header.Set(middleware.RequestIDHeader, "panic-request")
+			rec := httptest.NewRecorder()
+
+			aborted := func() (aborted bool) {
+				defer func() {
+					aborted = recover() == http.ErrAbortHandler
+				}()
+				h.ServeHTTP(rec, req)
+				return false
+			}()
+
+			if aborted != c.wantAbort {
+				t.Errorf("unexpected abort, given = %t, expected = %t", aborted, c.wantAbort)
+			}
+			if rec.Code != c.wantStatus {
+				t.Errorf("unexpected status, given = %d, expected = %d", rec.Code, c.wantStatus)
+			}
+			if panics != c.wantPanics {
+				t.Errorf("unexpected panics, given = %d, expected = %d", panics, c.wantPanics)
+			}
+			if c.wantPanics == 0 {
+				return
+			}
+
+			if got := logs.String(); !strings.Contains(got, "request_id = panic-request") || !strings.Contains(got, "goroutine ") {
+				t.Errorf("unexpected log, given = %s", got)
+			}
+			if c.wantAbort {
+				return
+			}
+			var p model.ProblemResponse
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatal("failed to decode response, err =", err)
+			}
+			if p.Status != http.StatusInternalServerError || p.Code != model.ErrorCodeInternal || p.RequestID != "panic-request" {
+				t.Errorf("unexpected problem, given = %+v", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// Media types of PATCH request bodies.
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// parseMergePatch parses a JSON Merge Patch (RFC 7396) to the fields of a TODO
+// it changes. Removing description empties it, removing due_at, tags or
+// project_id clears them, removing priority lowers it to the default, and
+// removing subject leaves it empty to fail validation.
+func parseMergePatch(body []byte) (*model.TODOPatch, error) {
+	var members map[string]interface{}
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		// a patch other than an object replaces the whole TODO
+		return nil, model.NewErrValidation("patch", "must be a JSON object")
+	}
+
+	var (
+		patch   model.TODOPatch
+		invalid = &model.ErrValidation{}
+	)
+	for name, v := range members {
+		setPatchField(&patch, name, v, invalid)
+	}
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	return &patch, nil
+}
+
+// A jsonPatchOperation expresses an operation of JSON Patch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies a JSON Patch (RFC 6902) to the patchable fields of
+// todo, and returns the fields it changes. An operation which cannot be
+// applied, like a failing test, is *model.ErrConflict.
+func applyJSONPatch(todo *model.TODO, body []byte) (*model.TODOPatch, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, model.NewErrValidation("patch", "must be an array of JSON Patch operations")
+	}
+
+	invalid := &model.ErrValidation{}
+	for i, op := range ops {
+		name := fmt.Sprintf("[%d]", i)
+		switch op.Op {
+		case "add", "replace", "test":
+			// null is a value, while a missing member is not
+			if len(op.Value) == 0 {
+				invalid.Add(name+".value", "must be given")
+			}
+		case "move", "copy":
+			if op.From == nil {
+				invalid.Add(name+".from", "must be given")
+			} else if _, err := parsePointer(*op.From); err != nil {
+				invalid.Add(name+".from", err.Error())
+			}
+		case "remove":
+		default:
+			invalid.Add(name+".op", "must be one of add, remove, replace, move, copy or test")
+		}
+		if op.Path == nil {
+			invalid.Add(name+".path", "must be given")
+		} else if _, err := parsePointer(*op.Path); err != nil {
+			invalid.Add(name+".path", err.Error())
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"subject":     todo.Subject,
+		"description": todo.Description,
+	}
+	if todo.DueAt != nil {
+		fields["due_at"] = todo.DueAt.Format(time.RFC3339)
+	}
+	// tags is always an array, so that tags can be added with /tags/-
+	tags := make([]interface{}, len(todo.Tags))
+	for i, tag := range todo.Tags {
+		tags[i] = tag
+	}
+	fields["tags"] = tags
+	if todo.ProjectID != nil {
+		// as a JSON number is decoded, to be compared by test
+		fields["project_id"] = float64(*todo.ProjectID)
+	}
+	fields["priority"] = float64(todo.Priority)
+	var doc interface{} = fields
+	for i, op := range ops {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, &model.ErrConflict{What: fmt.Sprintf("JSON Patch operation %d (%s) failed: %v", i, op.Op, err)}
+		}
+	}
+
+	result, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, model.NewErrValidation("patch", "must result in a JSON object")
+	}
+	// every field is set as in the result, and removed ones are emptied
+	var patch model.TODOPatch
+	for _, name := range []string{"subject", "description", "due_at", "tags", "project_id", "priority"} {
+		if _, ok := result[name]; !ok {
+			setPatchField(&patch, name, nil, invalid)
+		}
+	}
+	for name, v := range result {
+		setPatchField(&patch, name, v, invalid)
+	}
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	return &patch, nil
+}
+
+// setPatchField sets the field of patch by its JSON name to the decoded JSON
+// value v, where nil removes the field. An invalid field is added to invalid.
+func setPatchField(patch *model.TODOPatch, name string, v interface{}, invalid *model.ErrValidation) {
+	s, isString := v.(string)
+	switch name {
+	case "subject", "description":
+		if v != nil && !isString {
+			invalid.Add(name, "must be a string or null")
+			return
+		}
+		if name == "subject" {
+			patch.Subject = &s
+		} else {
+			patch.Description = &s
+		}
+	case "due_at":
+		if v != nil && !isString {
+			invalid.Add(name, "must be a string or null")
+			return
+		}
+		var dueAt *time.Time
+		if v != nil {
+			t, err := parseTime(s)
+			if err != nil {
+				invalid.Add(name, err.Error())
+				return
+			}
+			dueAt = &t
+		}
+		patch.DueAt = &dueAt
+	case "tags":
+		values, ok := v.([]interface{})
+		if v != nil && !ok {
+			invalid.Add(name, "must be an array of strings or null")
+			return
+		}
+		tags := make([]string, len(values))
+		for i, value := range values {
+			if tags[i], ok = value.(string); !ok {
+				invalid.Add(name, "must be an array of strings or null")
+				return
+			}
+		}
+		patch.Tags = &tags
+	case "project_id":
+		n, isNumber := v.(float64)
+		if v != nil && (!isNumber || n != math.Trunc(n) || n < 1 || n > math.MaxInt64) {
+			invalid.Add(name, "must be a positive integer or null")
+			return
+		}
+		var projectID *int64
+		if v != nil {
+			id := int64(n)
+			projectID = &id
+		}
+		patch.ProjectID = &projectID
+	case "priority":
+		n, isNumber := v.(float64)
+		if v != nil && (!isNumber || n != math.Trunc(n) || math.Abs(n) > math.MaxInt32) {
+			invalid.Add(name, "must be an integer or null")
+			return
+		}
+		priority := int(n)
+		patch.Priority = &priority
+	default:
+		invalid.Add(name, "cannot be patched")
+	}
+}
+
+// applyJSONPatchOperation applies a validated op to doc and returns the result.
+func applyJSONPatchOperation(doc interface{}, op jsonPatchOperation) (interface{}, error) {
+	path, _ := parsePointer(*op.Path)
+
+	var value interface{}
+	if len(op.Value) != 0 {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err := pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "move":
+		from, _ := parsePointer(*op.From)
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, fmt.Errorf("cannot move %s into itself", *op.From)
+		}
+		doc, v, err := pointerRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "copy":
+		from, _ := parsePointer(*op.From)
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// copy by value, so that later operations do not change both
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	default: // test
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, value) {
+			return nil, fmt.Errorf("value at %s differs", *op.Path)
+		}
+		return doc, nil
+	}
+}
+
+// parsePointer parses a JSON Pointer (RFC 6901) to its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("must be a JSON Pointer starting with /")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// pointerGet returns the value at path in doc.
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%q does not exist in a scalar", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds value at path in doc, inserting into an array.
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	return pointerModify(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			i, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", token)
+		}
+	}, value)
+}
+
+// pointerRemove removes the value at path in doc and returns it as well.
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed interface{}
+	doc, err := pointerModify(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			removed = v
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%q does not exist in a scalar", token)
+		}
+	}, nil)
+	return doc, removed, err
+}
+
+// pointerModify replaces the parent container of path in doc with what fn
+// returns for it and the last token of path. An empty path is replaced with
+// root.
+func pointerModify(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error), root interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return root, nil
+	}
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerModify(child, path[1:], fn, root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(node)-1)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+// arrayIndex parses token as an array index up to max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("index %d is out of range", i)
+	}
+	return i, nil
+}
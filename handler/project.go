@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A ProjectHandler implements handling REST endpoints of projects. The TODOs
+// of a project are listed by its TODOHandler.
+type ProjectHandler struct {
+	svc   *service.ProjectService
+	todos *TODOHandler
+	Path  string
+}
+
+// NewProjectHandler returns ProjectHandler based http.Handler, which lists the
+// TODOs of a project with todos.
+func NewProjectHandler(svc *service.ProjectService, todos *TODOHandler) *ProjectHandler {
+	return &ProjectHandler{
+		svc:   svc,
+		todos: todos,
+		Path:  "/projects",
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *ProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Path), "/")
+	if rest == "" {
+		h.serveCollection(w, r)
+		return
+	}
+
+	segments := strings.Split(rest, "/")
+	id, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil || id <= 0 {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		h.serveResource(w, r, id)
+	case len(segments) == 2 && segments[1] == "todos":
+		metrics.SetRoute(r, h.Path+"/{id}/todos")
+		h.serveTODOs(w, r, id)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// serveCollection handles requests to /projects.
+func (h *ProjectHandler) serveCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		projects, err := h.svc.ReadProjects(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.ReadProjectResponse{Projects: projects})
+
+	case http.MethodPost:
+		var data model.CreateProjectRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		project, err := h.svc.CreateProject(r.Context(), data.Name, data.Description)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.CreateProjectResponse{Project: *project})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// serveResource handles requests to /projects/{id}.
+func (h *ProjectHandler) serveResource(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+		project, err := h.svc.GetProject(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.GetProjectResponse{Project: *project})
+
+	case http.MethodPut:
+		var data model.UpdateProjectRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		project, err := h.svc.UpdateProject(r.Context(), id, data.Name, data.Description)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.UpdateProjectResponse{Project: *project})
+
+	case http.MethodDelete:
+		var cascade bool
+		if cascadeStr := r.URL.Query().Get("cascade"); len(cascadeStr) != 0 {
+			var err error
+			if cascade, err = strconv.ParseBool(cascadeStr); err != nil {
+				writeError(w, r, model.NewErrValidation("cascade", "must be true or false"))
+				return
+			}
+		}
+
+		if err := h.svc.DeleteProject(r.Context(), id, cascade); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.DeleteProjectResponse{})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// serveTODOs handles requests to /projects/{id}/todos, which takes the same
+// query parameters as listing /todos.
+func (h *ProjectHandler) serveTODOs(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	// a missing project is not found rather than empty
+	if _, err := h.svc.GetProject(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.todos.serveList(w, r, service.InProject(id))
+}
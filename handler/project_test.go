@@ -0,0 +1,122 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestProjectHandler(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	todoHandler := handler.NewTODOHandler(svc)
+	projectHandler := handler.NewProjectHandler(service.NewProjectService(svc), todoHandler)
+	mux := http.NewServeMux()
+	mux.Handle("/todos", todoHandler)
+	mux.Handle("/todos/", todoHandler)
+	mux.Handle("/projects", projectHandler)
+	mux.Handle("/projects/", projectHandler)
+
+	// each case runs in order against the same handlers
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		// want is the project of the TODO, the counts of the project, or the
+		// ids of the TODOs or projects listed
+		want string
+	}{
+		{name: "Create project", method: http.MethodPost, target: "/projects", body: `{"name":" work ","description":"at the office"}`, wantStatus: http.StatusOK, want: "work:0/0"},
+		{name: "Create another project", method: http.MethodPost, target: "/projects", body: `{"name":"home"}`, wantStatus: http.StatusOK, want: "home:0/0"},
+		{name: "Create empty project", method: http.MethodPost, target: "/projects", body: `{"name":" "}`, wantStatus: http.StatusBadRequest},
+		{name: "Create todo in project", method: http.MethodPost, target: "/todos", body: `{"subject":"first","project_id":1}`, wantStatus: http.StatusOK, want: "1"},
+		{name: "Create another todo in project", method: http.MethodPost, target: "/todos", body: `{"subject":"second","project_id":1}`, wantStatus: http.StatusOK, want: "1"},
+		{name: "Create todo without project", method: http.MethodPost, target: "/todos", body: `{"subject":"third"}`, wantStatus: http.StatusOK, want: "<nil>"},
+		{name: "Create todo in missing project", method: http.MethodPost, target: "/todos", body: `{"subject":"fourth","project_id":99}`, wantStatus: http.StatusBadRequest},
+		{name: "Mark todo done", method: http.MethodPost, target: "/todos/2/done", wantStatus: http.StatusOK, want: "1"},
+		{name: "Get project", method: http.MethodGet, target: "/projects/1", wantStatus: http.StatusOK, want: "work:1/1"},
+		{name: "List projects", method: http.MethodGet, target: "/projects", wantStatus: http.StatusOK, want: "[1 2]"},
+		{name: "List todos of project", method: http.MethodGet, target: "/projects/1/todos", wantStatus: http.StatusOK, want: "[2 1]"},
+		{name: "Page todos of project", method: http.MethodGet, target: "/projects/1/todos?prev_id=2&size=1", wantStatus: http.StatusOK, want: "[1]"},
+		{name: "Filter todos of project", method: http.MethodGet, target: "/projects/1/todos?status=open", wantStatus: http.StatusOK, want: "[1]"},
+		{name: "List todos of missing project", method: http.MethodGet, target: "/projects/99/todos", wantStatus: http.StatusNotFound},
+		{name: "Post todos of project", method: http.MethodPost, target: "/projects/1/todos", wantStatus: http.StatusMethodNotAllowed},
+		{name: "Patch project", method: http.MethodPatch, target: "/todos/3", contentType: "application/merge-patch+json", body: `{"project_id":2}`, wantStatus: http.StatusOK, want: "2"},
+		{name: "Patch invalid project", method: http.MethodPatch, target: "/todos/3", contentType: "application/merge-patch+json", body: `{"project_id":1.5}`, wantStatus: http.StatusBadRequest},
+		{name: "Patch project by JSON Patch", method: http.MethodPatch, target: "/todos/3", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/project_id","value":2},{"op":"replace","path":"/project_id","value":1}]`, wantStatus: http.StatusOK, want: "1"},
+		{name: "Update project", method: http.MethodPut, target: "/projects/2", body: `{"name":"house"}`, wantStatus: http.StatusOK, want: "house:0/0"},
+		{name: "Update missing project", method: http.MethodPut, target: "/projects/99", body: `{"name":"house"}`, wantStatus: http.StatusNotFound},
+		{name: "Delete project with todos", method: http.MethodDelete, target: "/projects/1", wantStatus: http.StatusConflict},
+		{name: "Delete by invalid cascade", method: http.MethodDelete, target: "/projects/1?cascade=yes!", wantStatus: http.StatusBadRequest},
+		{name: "Delete project in cascade", method: http.MethodDelete, target: "/projects/1?cascade=true", wantStatus: http.StatusOK},
+		{name: "List todos after cascade", method: http.MethodGet, target: "/todos", wantStatus: http.StatusOK, want: "[]"},
+		{name: "Delete empty project", method: http.MethodDelete, target: "/projects/2", wantStatus: http.StatusOK},
+		{name: "Get deleted project", method: http.MethodGet, target: "/projects/2", wantStatus: http.StatusNotFound},
+		{name: "Method not allowed", method: http.MethodPatch, target: "/projects", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			TODO     *model.TODO      `json:"todo"`
+			TODOs    []*model.TODO    `json:"todos"`
+			Project  *model.Project   `json:"project"`
+			Projects []*model.Project `json:"projects"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		var given string
+		switch {
+		case res.TODO != nil && res.TODO.ProjectID != nil:
+			given = fmt.Sprint(*res.TODO.ProjectID)
+		case res.TODO != nil:
+			given = "<nil>"
+		case res.Project != nil:
+			given = fmt.Sprintf("%s:%d/%d", res.Project.Name, res.Project.OpenCount, res.Project.DoneCount)
+		case res.Projects != nil:
+			ids := make([]int64, len(res.Projects))
+			for i, project := range res.Projects {
+				ids[i] = project.ID
+			}
+			given = fmt.Sprint(ids)
+		case res.TODOs != nil:
+			ids := make([]int64, len(res.TODOs))
+			for i, todo := range res.TODOs {
+				ids[i] = todo.ID
+			}
+			given = fmt.Sprint(ids)
+		}
+		if c.want != "" && given != c.want {
+			t.Errorf("%s: unexpected result, given = %s, expected = %s", c.name, given, c.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A LivenessHandler implements the liveness check endpoint. It reports only
+// that the process can serve HTTP, so that a busy database never gets the
+// process restarted.
+type LivenessHandler struct {
+	Path string
+}
+
+// NewLivenessHandler returns LivenessHandler based http.Handler.
+func NewLivenessHandler() *LivenessHandler {
+	return &LivenessHandler{
+		Path: "/healthz/live",
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *LivenessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, &model.LivenessResponse{Status: model.HealthStatusOK})
+}
+
+// A ReadinessHandler implements the readiness check endpoint. It checks the
+// dependencies needed to handle requests, and reports not ready once shutdown
+// is closed.
+type ReadinessHandler struct {
+	db       *sql.DB
+	shutdown <-chan struct{}
+	timeout  time.Duration
+	Path     string
+}
+
+// NewReadinessHandler returns ReadinessHandler based http.Handler.
+// shutdown may be nil if the server never shuts down gracefully.
+func NewReadinessHandler(db *sql.DB, shutdown <-chan struct{}) *ReadinessHandler {
+	return &ReadinessHandler{
+		db:       db,
+		shutdown: shutdown,
+		timeout:  2 * time.Second,
+		Path:     "/healthz/ready",
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-h.shutdown:
+		writeResponseStatus(w, http.StatusServiceUnavailable, &model.ReadinessResponse{Status: model.HealthStatusShuttingDown, Checks: []model.HealthCheck{}})
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	res := &model.ReadinessResponse{
+		Status: model.HealthStatusOK,
+		Checks: []model.HealthCheck{
+			runCheck(ctx, "database", h.checkDatabase),
+			runCheck(ctx, "migrations", h.checkMigrations),
+			runCheck(ctx, "disk", h.checkDisk),
+		},
+	}
+
+	status := http.StatusOK
+	for _, c := range res.Checks {
+		if c.Status != model.HealthStatusOK {
+			res.Status = model.HealthStatusFailed
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeResponseStatus(w, status, res)
+}
+
+// runCheck runs check and times it. check returns a message on success, and
+// an error on failure.
+func runCheck(ctx context.Context, name string, check func(ctx context.Context) (string, error)) model.HealthCheck {
+	start := time.Now()
+	message, err := check(ctx)
+	c := model.HealthCheck{
+		Name:       name,
+		Status:     model.HealthStatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Message:    message,
+	}
+	if err != nil {
+		c.Status = model.HealthStatusFailed
+		c.Message = err.Error()
+	}
+	return c
+}
+
+func (h *ReadinessHandler) checkDatabase(ctx context.Context) (string, error) {
+	return "", h.db.PingContext(ctx)
+}
+
+func (h *ReadinessHandler) checkMigrations(ctx context.Context) (string, error) {
+	status, err := db.Status(ctx, h.db)
+	if err != nil {
+		return "", err
+	}
+	if status.Current != status.Latest {
+		return "", fmt.Errorf("database is at version %d of %d", status.Current, status.Latest)
+	}
+	return fmt.Sprintf("version %d", status.Current), nil
+}
+
+// checkDisk writes a file next to the database file, which fails when the
+// disk is full or read only.
+func (h *ReadinessHandler) checkDisk(ctx context.Context) (string, error) {
+	var (
+		seq        int
+		name, file string
+	)
+	if err := h.db.QueryRowContext(ctx, `PRAGMA database_list`).Scan(&seq, &name, &file); err != nil {
+		return "", err
+	}
+	if file == "" {
+		return "in-memory database", nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(file), ".readiness-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return "", nil
+}
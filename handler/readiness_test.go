@@ -0,0 +1,78 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	t.Parallel()
+
+	closed := make(chan struct{})
+	close(closed)
+
+	cases := map[string]struct {
+		shutdown   <-chan struct{}
+		closeDB    bool
+		wantStatus int
+		wantBody   string
+		wantFailed []string
+	}{
+		"Ready":         {wantStatus: http.StatusOK, wantBody: model.HealthStatusOK},
+		"Shutting down": {shutdown: closed, wantStatus: http.StatusServiceUnavailable, wantBody: model.HealthStatusShuttingDown},
+		"Database closed": {
+			closeDB:    true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   model.HealthStatusFailed,
+			wantFailed: []string{"database", "migrations", "disk"},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := db.NewDB(filepath.Join(t.TempDir(), "readiness_test.db"))
+			if err != nil {
+				t.Fatal("failed to create db, err =", err)
+			}
+			if c.closeDB {
+				d.Close()
+			} else {
+				t.Cleanup(func() { d.Close() })
+			}
+
+			rec := httptest.NewRecorder()
+			handler.NewReadinessHandler(d, c.shutdown).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz/ready", nil))
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("unexpected status, given = %d, expected = %d", rec.Code, c.wantStatus)
+			}
+			var res model.ReadinessResponse
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal("failed to decode response, err =", err)
+			}
+			if res.Status != c.wantBody {
+				t.Errorf("unexpected status in body, given = %s, expected = %s", res.Status, c.wantBody)
+			}
+
+			var failed []string
+			for _, check := range res.Checks {
+				if check.Status != model.HealthStatusOK {
+					failed = append(failed, check.Name)
+				}
+			}
+			if len(failed) != len(c.wantFailed) {
+				t.Errorf("unexpected failed checks, given = %v, expected = %v", failed, c.wantFailed)
+			}
+		})
+	}
+}
@@ -3,16 +3,140 @@ package router
 import (
 	"database/sql"
 	"net/http"
+	"sync"
 
 	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/repository"
 	"github.com/TechBowl-japan/go-stations/service"
 )
 
-func NewRouter(todoDB *sql.DB) *http.ServeMux {
+// An Option configures the router returned by NewRouter.
+type Option func(*options)
+
+type options struct {
+	shutdown        <-chan struct{}
+	allowedOrigins  []string
+	wsConns         *sync.WaitGroup
+	httpMetrics     *metrics.HTTP
+	defaultPageSize int64
+	maxPageSize     int64
+	cursorKey       []byte
+}
+
+// WithShutdown returns Option which reports the server not ready once shutdown
+// is closed, so that load balancers stop sending requests while it drains.
+func WithShutdown(shutdown <-chan struct{}) Option {
+	return func(o *options) {
+		o.shutdown = shutdown
+	}
+}
+
+// WithAllowedOrigins returns Option which lets pages on origins connect to the
+// WebSocket endpoint besides the same origin, like CORS does for the others.
+func WithAllowedOrigins(origins []string) Option {
+	return func(o *options) {
+		o.allowedOrigins = origins
+	}
+}
+
+// WithWSConns returns Option which counts the WebSocket connections being
+// served in conns, which the server does not wait for on shutdown.
+func WithWSConns(conns *sync.WaitGroup) Option {
+	return func(o *options) {
+		o.wsConns = conns
+	}
+}
+
+// WithHTTPMetrics returns Option which records HTTP metrics to m instead of a
+// new metrics.HTTP, so that middlewares outside the router can share it.
+func WithHTTPMetrics(m *metrics.HTTP) Option {
+	return func(o *options) {
+		o.httpMetrics = m
+	}
+}
+
+// WithPageSize returns Option which lists defaultSize TODOs when size is not
+// given and rejects a size larger than maxSize.
+func WithPageSize(defaultSize, maxSize int64) Option {
+	return func(o *options) {
+		o.defaultPageSize = defaultSize
+		o.maxPageSize = maxSize
+	}
+}
+
+// WithCursorKey returns Option which signs the cursors of pages with key
+// instead of a random one, so that they stay valid across restarts.
+func WithCursorKey(key []byte) Option {
+	return func(o *options) {
+		o.cursorKey = key
+	}
+}
+
+func NewRouter(todoDB *sql.DB, opts ...Option) *http.ServeMux {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// register routes
 	mux := http.NewServeMux()
-	mux.HandleFunc(handler.NewHealthzHandler().Path, handler.NewHealthzHandler().ServeHTTP)
-	todoService := service.NewTODOService(todoDB)
-	mux.HandleFunc(handler.NewTODOHandler(todoService).Path, handler.NewTODOHandler(todoService).ServeHTTP)
+	httpMetrics := o.httpMetrics
+	if httpMetrics == nil {
+		httpMetrics = metrics.NewHTTP()
+	}
+
+	healthzHandler := handler.NewHealthzHandler()
+	mux.Handle(healthzHandler.Path, httpMetrics.Instrument(healthzHandler.Path, healthzHandler))
+	livenessHandler := handler.NewLivenessHandler()
+	mux.Handle(livenessHandler.Path, httpMetrics.Instrument(livenessHandler.Path, livenessHandler))
+	readinessHandler := handler.NewReadinessHandler(todoDB, o.shutdown)
+	mux.Handle(readinessHandler.Path, httpMetrics.Instrument(readinessHandler.Path, readinessHandler))
+
+	todoRepository := repository.NewSQLiteTODORepository(todoDB)
+	todoService := service.NewTODOService(todoRepository)
+	todoHandler := handler.NewTODOHandler(todoService)
+	if o.defaultPageSize > 0 {
+		todoHandler.DefaultPageSize = o.defaultPageSize
+	}
+	if o.maxPageSize > 0 {
+		todoHandler.MaxPageSize = o.maxPageSize
+	}
+	if len(o.cursorKey) != 0 {
+		todoHandler.CursorKey = o.cursorKey
+	}
+	todoHandler.Shutdown = o.shutdown
+	// "/todos/" also routes single resources like /todos/{id}, and the
+	// handler labels the sub-routes like /todos/{id}/done on its own
+	mux.Handle(todoHandler.Path, httpMetrics.Instrument(todoHandler.Path, todoHandler))
+	mux.Handle(todoHandler.Path+"/", httpMetrics.Instrument(todoHandler.Path+"/{id}", todoHandler))
+	// the event stream has a route of its own, not to be taken for /todos/{id}
+	mux.Handle(todoHandler.Path+"/events", httpMetrics.InstrumentStream(todoHandler.Path+"/events", todoHandler))
+
+	tagHandler := handler.NewTagHandler(service.NewTagService(todoService))
+	mux.Handle(tagHandler.Path, httpMetrics.Instrument(tagHandler.Path, tagHandler))
+	mux.Handle(tagHandler.Path+"/", httpMetrics.Instrument(tagHandler.Path+"/{id}", tagHandler))
+
+	// "/projects/" also routes the TODOs of a project like /projects/{id}/todos,
+	// labelled by the handler
+	projectHandler := handler.NewProjectHandler(service.NewProjectService(todoService), todoHandler)
+	mux.Handle(projectHandler.Path, httpMetrics.Instrument(projectHandler.Path, projectHandler))
+	mux.Handle(projectHandler.Path+"/", httpMetrics.Instrument(projectHandler.Path+"/{id}", projectHandler))
+
+	// "/webhooks/" also routes the delivery log like /webhooks/{id}/deliveries,
+	// labelled by the handler
+	webhookHandler := handler.NewWebhookHandler(service.NewWebhookService(todoRepository))
+	mux.Handle(webhookHandler.Path, httpMetrics.Instrument(webhookHandler.Path, webhookHandler))
+	mux.Handle(webhookHandler.Path+"/", httpMetrics.Instrument(webhookHandler.Path+"/{id}", webhookHandler))
+
+	wsHandler := handler.NewWSHandler(todoService)
+	wsHandler.Shutdown = o.shutdown
+	wsHandler.AllowedOrigins = o.allowedOrigins
+	wsHandler.Conns = o.wsConns
+	mux.Handle(wsHandler.Path, httpMetrics.InstrumentStream(wsHandler.Path, wsHandler))
+
+	metricsHandler := handler.NewMetricsHandler(httpMetrics, todoDB, todoService)
+	mux.Handle(metricsHandler.Path, httpMetrics.Instrument(metricsHandler.Path, metricsHandler))
+
 	return mux
 }
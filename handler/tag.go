@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A TagHandler implements handling REST endpoints of tags.
+type TagHandler struct {
+	svc  *service.TagService
+	Path string
+}
+
+// NewTagHandler returns TagHandler based http.Handler.
+func NewTagHandler(svc *service.TagService) *TagHandler {
+	return &TagHandler{
+		svc:  svc,
+		Path: "/tags",
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *TagHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Path), "/")
+	if rest == "" {
+		h.serveCollection(w, r)
+		return
+	}
+
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 {
+		writeNotFound(w, r)
+		return
+	}
+
+	h.serveResource(w, r, id)
+}
+
+// serveCollection handles requests to /tags.
+func (h *TagHandler) serveCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := h.svc.ReadTags(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.ReadTagResponse{Tags: tags})
+
+	case http.MethodPost:
+		var data model.CreateTagRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		tag, err := h.svc.CreateTag(r.Context(), data.Name)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.CreateTagResponse{Tag: *tag})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// serveResource handles requests to /tags/{id}.
+func (h *TagHandler) serveResource(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+		tag, err := h.svc.GetTag(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.GetTagResponse{Tag: *tag})
+
+	case http.MethodPut:
+		var data model.UpdateTagRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		tag, err := h.svc.RenameTag(r.Context(), id, data.Name)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.UpdateTagResponse{Tag: *tag})
+
+	case http.MethodDelete:
+		if err := h.svc.DeleteTag(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.DeleteTagResponse{})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,111 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestTagHandler(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	mux := http.NewServeMux()
+	mux.Handle("/todos", handler.NewTODOHandler(svc))
+	mux.Handle("/todos/", handler.NewTODOHandler(svc))
+	mux.Handle("/tags", handler.NewTagHandler(service.NewTagService(svc)))
+	mux.Handle("/tags/", handler.NewTagHandler(service.NewTagService(svc)))
+
+	// each case runs in order against the same handlers
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		// wantTags is the tags of the TODO, or the names of the tags listed
+		wantTags string
+		// wantIDs is the ids of the TODOs listed
+		wantIDs string
+	}{
+		{name: "Create tag", method: http.MethodPost, target: "/tags", body: `{"name":" work "}`, wantStatus: http.StatusOK},
+		{name: "Create duplicated tag", method: http.MethodPost, target: "/tags", body: `{"name":"WORK"}`, wantStatus: http.StatusConflict},
+		{name: "Create empty tag", method: http.MethodPost, target: "/tags", body: `{"name":" "}`, wantStatus: http.StatusBadRequest},
+		{name: "Create todo with tags", method: http.MethodPost, target: "/todos", body: `{"subject":"first","tags":["Work","urgent"]}`, wantStatus: http.StatusOK, wantTags: "[urgent work]"},
+		{name: "Create todo with a tag", method: http.MethodPost, target: "/todos", body: `{"subject":"second","tags":["home"]}`, wantStatus: http.StatusOK, wantTags: "[home]"},
+		{name: "Create todo without tags", method: http.MethodPost, target: "/todos", body: `{"subject":"third"}`, wantStatus: http.StatusOK, wantTags: "[]"},
+		{name: "Create todo with empty tag", method: http.MethodPost, target: "/todos", body: `{"subject":"fourth","tags":[""]}`, wantStatus: http.StatusBadRequest},
+		{name: "List tags", method: http.MethodGet, target: "/tags", wantStatus: http.StatusOK, wantTags: "[home urgent work]"},
+		{name: "Filter by all tags", method: http.MethodGet, target: "/todos?tag=work&tag=urgent", wantStatus: http.StatusOK, wantIDs: "[1]"},
+		{name: "Filter by any tag", method: http.MethodGet, target: "/todos?tag=urgent&tag=home&tag_match=any", wantStatus: http.StatusOK, wantIDs: "[2 1]"},
+		{name: "Filter by invalid match", method: http.MethodGet, target: "/todos?tag=work&tag_match=some", wantStatus: http.StatusBadRequest},
+		{name: "Patch tags", method: http.MethodPatch, target: "/todos/3", contentType: "application/merge-patch+json", body: `{"tags":["home","later"]}`, wantStatus: http.StatusOK, wantTags: "[home later]"},
+		{name: "Patch tags by JSON Patch", method: http.MethodPatch, target: "/todos/3", contentType: "application/json-patch+json", body: `[{"op":"add","path":"/tags/-","value":"work"},{"op":"remove","path":"/tags/0"}]`, wantStatus: http.StatusOK, wantTags: "[later work]"},
+		{name: "Patch invalid tags", method: http.MethodPatch, target: "/todos/3", contentType: "application/merge-patch+json", body: `{"tags":"home"}`, wantStatus: http.StatusBadRequest},
+		{name: "Rename tag", method: http.MethodPut, target: "/tags/1", body: `{"name":"job"}`, wantStatus: http.StatusOK},
+		{name: "Rename to taken name", method: http.MethodPut, target: "/tags/1", body: `{"name":"Home"}`, wantStatus: http.StatusConflict},
+		{name: "Get renamed tags", method: http.MethodGet, target: "/todos/1", wantStatus: http.StatusOK, wantTags: "[job urgent]"},
+		{name: "Update clears tags", method: http.MethodPut, target: "/todos/2", body: `{"subject":"second"}`, wantStatus: http.StatusOK, wantTags: "[]"},
+		{name: "Delete tag", method: http.MethodDelete, target: "/tags/1", wantStatus: http.StatusOK},
+		{name: "Get deleted tag", method: http.MethodGet, target: "/tags/1", wantStatus: http.StatusNotFound},
+		{name: "Get without deleted tag", method: http.MethodGet, target: "/todos/3", wantStatus: http.StatusOK, wantTags: "[later]"},
+		{name: "Method not allowed", method: http.MethodPatch, target: "/tags/2", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			TODO  *model.TODO   `json:"todo"`
+			TODOs []*model.TODO `json:"todos"`
+			Tags  []*model.Tag  `json:"tags"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		var given string
+		switch {
+		case res.TODO != nil && c.wantTags != "":
+			given = fmt.Sprint(res.TODO.Tags)
+		case res.Tags != nil:
+			names := make([]string, len(res.Tags))
+			for i, tag := range res.Tags {
+				names[i] = tag.Name
+			}
+			given = fmt.Sprint(names)
+		case res.TODOs != nil:
+			ids := make([]int64, len(res.TODOs))
+			for i, todo := range res.TODOs {
+				ids[i] = todo.ID
+			}
+			given = fmt.Sprint(ids)
+		}
+		if want := c.wantTags + c.wantIDs; want != "" && given != want {
+			t.Errorf("%s: unexpected result, given = %s, expected = %s", c.name, given, want)
+		}
+	}
+}
@@ -3,11 +3,18 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/TechBowl-japan/go-stations/metrics"
 	"github.com/TechBowl-japan/go-stations/model"
 	"github.com/TechBowl-japan/go-stations/service"
 )
@@ -16,171 +23,558 @@ import (
 type TODOHandler struct {
 	svc  *service.TODOService
 	Path string
+	// DefaultPageSize is the number of TODOs listed when size is not given,
+	// and MaxPageSize is the largest size accepted.
+	DefaultPageSize int64
+	MaxPageSize     int64
+	// CursorKey signs the cursors of pages with HMAC-SHA256. It is random
+	// unless set, and then cursors are only valid until the process exits.
+	CursorKey []byte
+	// HeartbeatInterval is how often an idle event stream is written to, so
+	// that proxies do not close it.
+	HeartbeatInterval time.Duration
+	// Shutdown ends the event streams once closed, so that shutting down the
+	// server does not wait for them.
+	Shutdown <-chan struct{}
 }
 
 // NewTODOHandler returns TODOHandler based http.Handler.
 func NewTODOHandler(svc *service.TODOService) *TODOHandler {
 	return &TODOHandler{
-		svc:  svc,
-		Path: "/todos",
+		svc:               svc,
+		Path:              "/todos",
+		DefaultPageSize:   10,
+		MaxPageSize:       100,
+		CursorKey:         newCursorKey(),
+		HeartbeatInterval: 15 * time.Second,
 	}
 }
 
 // ServeHTTP implements http.Handler interface
 func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Path), "/")
+	if rest == "" {
+		h.serveCollection(w, r)
+		return
+	}
+
+	segments := strings.Split(rest, "/")
+	if segments[0] == "trash" {
+		h.serveTrash(w, r, segments[1:])
+		return
+	}
+	if segments[0] == "events" && len(segments) == 1 {
+		h.serveEvents(w, r)
+		return
+	}
+
+	id, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil || id <= 0 {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		h.serveResource(w, r, id)
+	case len(segments) == 2 && (segments[1] == "done" || segments[1] == "undone"):
+		metrics.SetRoute(r, h.Path+"/{id}/"+segments[1])
+		h.serveCompletion(w, r, id, segments[1] == "done")
+	case len(segments) == 2 && segments[1] == "restore":
+		metrics.SetRoute(r, h.Path+"/{id}/restore")
+		h.serveRestore(w, r, id)
+	case segments[1] == "checklist":
+		h.serveChecklist(w, r, id, segments[2:])
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// serveCollection handles requests to /todos.
+func (h *TODOHandler) serveCollection(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// GET method process
-		prevIDStr := r.URL.Query().Get("prev_id")
-		sizeStr := r.URL.Query().Get("size")
-		var prevID int64 = 0
-		var size int64 = 10
-		if len(prevIDStr) != 0 {
-			var err error
-			prevID, err = strconv.ParseInt(prevIDStr, 10, 64)
-			if err != nil {
-				http.Error(w, "Invalid prev_id parameter", http.StatusBadRequest)
-				return
-			}
+		h.serveList(w, r)
+
+	case http.MethodPost:
+		var data model.CreateTODORequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
 		}
-		if len(sizeStr) != 0 {
-			var err error
-			size, err = strconv.ParseInt(sizeStr, 10, 64)
-			if err != nil {
-				http.Error(w, "Invalid Size", http.StatusBadRequest)
-				return
-			}
+
+		invalid := &model.ErrValidation{}
+		if len(data.Subject) == 0 {
+			invalid.Add("subject", "must not be empty")
+		}
+		dueAt := dueAtOption(data.DueAt, invalid)
+		if err := invalid.Err(); err != nil {
+			writeError(w, r, err)
+			return
 		}
 
-		readTodoResponse, err := h.svc.ReadTODO(r.Context(), prevID, size)
+		createTodoResponse, err := h.Create(r.Context(), &data, dueAt, service.WithTags(data.Tags), service.WithProject(data.ProjectID), service.WithPriority(data.Priority))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
-		err = encoder.Encode(map[string]interface{}{"todos": readTodoResponse})
-		if err != nil {
-			http.Error(w, "encode response data to json format", http.StatusBadRequest)
+		setETag(w, &createTodoResponse.TODO)
+		writeResponse(w, createTodoResponse)
+
+	case http.MethodPut:
+		var data model.UpdateTODORequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
 			return
 		}
 
-	case http.MethodPost:
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		invalid := &model.ErrValidation{}
+		if data.ID <= 0 {
+			invalid.Add("id", "must be 1 or more")
+		}
+		if len(data.Subject) == 0 {
+			invalid.Add("subject", "must not be empty")
+		}
+		dueAt := dueAtOption(data.DueAt, invalid)
+		if err := invalid.Err(); err != nil {
+			writeError(w, r, err)
 			return
 		}
-		defer r.Body.Close()
 
-		var data model.CreateTODORequest
-		err = json.Unmarshal(body, &data)
-		if err != nil {
-			http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+		h.serveUpdate(w, r, &data, dueAt, service.WithTags(data.Tags), service.WithProject(data.ProjectID), service.WithPriority(data.Priority))
+
+	case http.MethodDelete:
+		var data model.DeleteTODORequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
 			return
 		}
 
-		if len(data.Subject) == 0 {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+		if len(data.IDs) == 0 {
+			writeError(w, r, model.NewErrValidation("ids", "must not be empty"))
 			return
 		}
 
-		createTodoResponse, err := h.Create(r.Context(), &data)
+		deleteTodoResponse, err := h.Delete(r.Context(), &data)
 		if err != nil {
-			http.Error(w, "Failed to create TODO", http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
-		err = encoder.Encode(createTodoResponse)
+		writeResponse(w, deleteTodoResponse)
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// serveList handles requests listing TODOs with the query parameters
+// prev_id, cursor, size, status, q, due_before, due_after, overdue, tag,
+// tag_match, sort and total. opts narrow down the TODOs further. A page
+// followed by more TODOs comes with the cursor of the next one, also linked
+// by the Link header.
+func (h *TODOHandler) serveList(w http.ResponseWriter, r *http.Request, opts ...service.ReadOption) {
+	query := r.URL.Query()
+	var prevID int64 = 0
+	var size int64 = h.DefaultPageSize
+	status := model.TODOStatusAll
+
+	invalid := &model.ErrValidation{}
+	if prevIDStr := query.Get("prev_id"); len(prevIDStr) != 0 {
+		var err error
+		prevID, err = strconv.ParseInt(prevIDStr, 10, 64)
 		if err != nil {
-			log.Println(err)
-			return
+			invalid.Add("prev_id", "must be an integer")
+		}
+	}
+	if sizeStr := query.Get("size"); len(sizeStr) != 0 {
+		var err error
+		size, err = strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			invalid.Add("size", "must be an integer")
+		} else if size < 1 || size > h.MaxPageSize {
+			// an empty page could not tell where the next one starts
+			invalid.Add("size", fmt.Sprintf("must be between 1 and %d", h.MaxPageSize))
+		}
+	}
+	if statusStr := query.Get("status"); len(statusStr) != 0 {
+		status = model.TODOStatus(statusStr)
+	}
+	switch status {
+	case model.TODOStatusOpen, model.TODOStatusDone, model.TODOStatusAll:
+	default:
+		invalid.Add("status", "must be one of open, done or all")
+	}
+	q := strings.TrimSpace(query.Get("q"))
+	opts = append(opts, service.WithStatus(status), service.WithQuery(q))
+
+	if dueBefore := query.Get("due_before"); len(dueBefore) != 0 {
+		if t, err := parseTime(dueBefore); err != nil {
+			invalid.Add("due_before", err.Error())
+		} else {
+			opts = append(opts, service.DueBefore(t))
+		}
+	}
+	if dueAfter := query.Get("due_after"); len(dueAfter) != 0 {
+		if t, err := parseTime(dueAfter); err != nil {
+			invalid.Add("due_after", err.Error())
+		} else {
+			opts = append(opts, service.DueAfter(t))
+		}
+	}
+	if overdue := query.Get("overdue"); len(overdue) != 0 {
+		if v, err := strconv.ParseBool(overdue); err != nil {
+			invalid.Add("overdue", "must be true or false")
+		} else if v {
+			opts = append(opts, service.Overdue())
+		}
+	}
+	if tags := query["tag"]; len(tags) != 0 {
+		switch tagMatch := query.Get("tag_match"); tagMatch {
+		case "all", "":
+			opts = append(opts, service.Tagged(tags, false))
+		case "any":
+			opts = append(opts, service.Tagged(tags, true))
+		default:
+			invalid.Add("tag_match", "must be one of all or any")
+		}
+	}
+	var sortKeys []model.TODOSortKey
+	if sortStr := query.Get("sort"); len(sortStr) != 0 {
+		keys, err := parseSort(sortStr)
+		switch {
+		case err != nil:
+			invalid.Add("sort", err.Error())
+		case q != "":
+			invalid.Add("sort", "cannot be given with q, whose hits are ordered by relevance")
+		default:
+			sortKeys = keys
+			opts = append(opts, service.SortBy(keys...))
 		}
+	}
+	sort := formatSort(sortKeys)
+	if q != "" {
+		sort = sortByRank
+	}
+	if cursorStr := query.Get("cursor"); len(cursorStr) != 0 {
+		c, err := decodeCursor(h.CursorKey, cursorStr, sort)
+		switch {
+		case err != nil:
+			invalid.Add("cursor", err.Error())
+		case query.Get("prev_id") != "":
+			invalid.Add("cursor", "cannot be given with prev_id")
+		case sort == sortByRank:
+			// hits are continued by the rank of the last one for the same q
+			prevID = c.ID
+		default:
+			opts = append(opts, service.After(c.todo()))
+		}
+	}
+	var total bool
+	if totalStr := query.Get("total"); len(totalStr) != 0 {
+		var err error
+		if total, err = strconv.ParseBool(totalStr); err != nil {
+			invalid.Add("total", "must be true or false")
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	case http.MethodPut:
-		body, err := io.ReadAll(r.Body)
+	// one more TODO tells whether the page is followed by more
+	readTodoResponse, err := h.svc.ReadTODO(r.Context(), prevID, size+1, opts...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := &model.ReadTODOResponse{TODOs: readTodoResponse}
+	if int64(len(readTodoResponse)) > size {
+		resp.TODOs, resp.HasMore = readTodoResponse[:size], true
+	}
+	if n := len(resp.TODOs); resp.HasMore && n != 0 {
+		resp.NextCursor, err = encodeCursor(h.CursorKey, newListCursor(sort, sortKeys, resp.TODOs[n-1]))
 		if err != nil {
-			http.Error(w, "Faild to read request body.", http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
-		defer r.Body.Close()
-
-		var data model.UpdateTODORequest
-		err = json.Unmarshal(body, &data)
+	}
+	if total {
+		n, err := h.svc.CountTODO(r.Context(), opts...)
 		if err != nil {
-			http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
+		resp.Total = &n
+	}
+
+	setPageLinks(w, r, resp.NextCursor)
+	writeResponse(w, resp)
+}
+
+// setPageLinks sets the Link header (RFC 8288) of a page listed by r to the
+// first page, and to the next one after cursor unless it is empty.
+func setPageLinks(w http.ResponseWriter, r *http.Request, cursor string) {
+	query := r.URL.Query()
+	query.Del("prev_id")
+	query.Del("cursor")
+	link := func(query url.Values, rel string) string {
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return "<" + u.String() + `>; rel="` + rel + `"`
+	}
 
-		if data.ID == 0 {
-			http.Error(w, "Invalid ID: ID is more than 1.", http.StatusBadRequest)
+	links := []string{link(query, "first")}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+		links = append(links, link(query, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// serveResource handles requests to /todos/{id}.
+func (h *TODOHandler) serveResource(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+		getTodoResponse, err := h.Get(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
-		if len(data.Subject) == 0 {
-			http.Error(w, "Invaild Subject: The length of Subject is more than 1.", http.StatusBadRequest)
+		setETag(w, &getTodoResponse.TODO)
+		if !noneMatch(r, &getTodoResponse.TODO) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
+		writeResponse(w, getTodoResponse)
 
-		updateTodoResponse, err := h.Update(r.Context(), &data)
-		if err != nil {
-			http.Error(w, "Failed to update TODO.", http.StatusBadRequest)
+	case http.MethodPatch:
+		h.servePatch(w, r, id)
+
+	case http.MethodPut:
+		var data model.UpdateTODORequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
-		err = encoder.Encode(updateTodoResponse)
-		if err != nil {
-			log.Println(err)
+		invalid := &model.ErrValidation{}
+		// the id in the path wins, but a conflicting id in the body is a client bug
+		if data.ID != 0 && data.ID != id {
+			invalid.Add("id", "must match the id in the path")
+		}
+		data.ID = id
+		if len(data.Subject) == 0 {
+			invalid.Add("subject", "must not be empty")
+		}
+		dueAt := dueAtOption(data.DueAt, invalid)
+		if err := invalid.Err(); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
+		h.serveUpdate(w, r, &data, dueAt, service.WithTags(data.Tags), service.WithProject(data.ProjectID), service.WithPriority(data.Priority))
+
 	case http.MethodDelete:
-		body, err := io.ReadAll(r.Body)
+		version, err := h.ifMatchVersion(r.Context(), r, id)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
-		defer r.Body.Close()
 
-		var data model.DeleteTODORequest
-		err = json.Unmarshal(body, &data)
+		deleteTodoResponse, err := h.Delete(r.Context(), &model.DeleteTODORequest{IDs: []int64{id}}, service.IfVersion(version))
 		if err != nil {
-			http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 
-		if len(data.IDs) == 0 {
-			http.Error(w, "IDs is empty array.", http.StatusBadRequest)
+		writeResponse(w, deleteTodoResponse)
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// serveCompletion handles requests to /todos/{id}/done and /todos/{id}/undone.
+func (h *TODOHandler) serveCompletion(w http.ResponseWriter, r *http.Request, id int64, done bool) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	doneTodoResponse, err := h.Done(r.Context(), id, done)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, &doneTodoResponse.TODO)
+	writeResponse(w, doneTodoResponse)
+}
+
+// servePatch handles PATCH requests to /todos/{id} in JSON Merge Patch, or
+// JSON Patch. A plain JSON body is taken as JSON Merge Patch.
+func (h *TODOHandler) servePatch(w http.ResponseWriter, r *http.Request, id int64) {
+	var mediaType string
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			mediaType = contentType
+		}
+	}
+	switch mediaType {
+	case mediaTypeMergePatch, mediaTypeJSONPatch, "application/json", "":
+	default:
+		w.Header().Set("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch)
+		writeUnsupportedMediaType(w, r, mediaTypeMergePatch, mediaTypeJSONPatch)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeInvalidJSON(w, r, err)
+		return
+	}
+	if !json.Valid(body) {
+		writeInvalidJSON(w, r, errors.New("invalid JSON"))
+		return
+	}
+
+	version, err := h.ifMatchVersion(r.Context(), r, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var patch *model.TODOPatch
+	if mediaType == mediaTypeJSONPatch {
+		// JSON Patch is applied to the current TODO, so the change must
+		// be made to the same version
+		var todo *model.TODO
+		todo, err = h.svc.GetTODO(r.Context(), id)
+		if err == nil && version != 0 && todo.Version != version {
+			err = &model.ErrPreconditionFailed{ID: id}
+		}
+		if err == nil {
+			version = todo.Version
+			patch, err = applyJSONPatch(todo, body)
+		}
+	} else {
+		patch, err = parseMergePatch(body)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	todo, err := h.svc.PatchTODO(r.Context(), id, patch, service.IfVersion(version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, todo)
+	writeResponse(w, &model.UpdateTODOResponse{TODO: *todo})
+}
+
+// serveRestore handles requests to /todos/{id}/restore.
+func (h *TODOHandler) serveRestore(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	todo, err := h.svc.RestoreTODO(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, todo)
+	writeResponse(w, &model.RestoreTODOResponse{TODO: *todo})
+}
+
+// serveTrash handles requests to /todos/trash and /todos/trash/{id}.
+func (h *TODOHandler) serveTrash(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0:
+		metrics.SetRoute(r, h.Path+"/trash")
+		switch r.Method {
+		case http.MethodGet:
+			h.serveList(w, r, service.InTrash())
+
+		case http.MethodDelete:
+			var data model.PurgeTODORequest
+			if err := decodeBody(r, &data); err != nil {
+				writeInvalidJSON(w, r, err)
+				return
+			}
+
+			if len(data.IDs) == 0 {
+				writeError(w, r, model.NewErrValidation("ids", "must not be empty"))
+				return
+			}
+
+			if err := h.svc.PurgeTODO(r.Context(), data.IDs); err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			writeResponse(w, &model.PurgeTODOResponse{})
+
+		default:
+			writeMethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+
+	case len(segments) == 1:
+		metrics.SetRoute(r, h.Path+"/trash/{id}")
+		id, err := strconv.ParseInt(segments[0], 10, 64)
+		if err != nil || id <= 0 {
+			writeNotFound(w, r)
 			return
 		}
 
-		deleteTodoResponse, err := h.Delete(r.Context(), &data)
-		if err != nil {
-			http.Error(w, "TODO not found", http.StatusNotFound)
+		if r.Method != http.MethodDelete {
+			writeMethodNotAllowed(w, r, http.MethodDelete)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
-		err = encoder.Encode(deleteTodoResponse)
-		if err != nil {
-			log.Println(err)
+		if err := h.svc.PurgeTODO(r.Context(), []int64{id}); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
+		writeResponse(w, &model.PurgeTODOResponse{})
+
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeNotFound(w, r)
+	}
+}
+
+// serveUpdate updates the TODO by a validated request, honoring If-Match.
+// opts set the optional fields parsed from the request.
+func (h *TODOHandler) serveUpdate(w http.ResponseWriter, r *http.Request, data *model.UpdateTODORequest, opts ...service.WriteOption) {
+	version, err := h.ifMatchVersion(r.Context(), r, data.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updateTodoResponse, err := h.Update(r.Context(), data, append(opts, service.IfVersion(version))...)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+
+	setETag(w, &updateTodoResponse.TODO)
+	writeResponse(w, updateTodoResponse)
 }
 
 // Create handles the endpoint that creates the TODO.
-func (h *TODOHandler) Create(ctx context.Context, req *model.CreateTODORequest) (*model.CreateTODOResponse, error) {
-	todo, err := h.svc.CreateTODO(ctx, req.Subject, req.Description)
+func (h *TODOHandler) Create(ctx context.Context, req *model.CreateTODORequest, opts ...service.WriteOption) (*model.CreateTODOResponse, error) {
+	todo, err := h.svc.CreateTODO(ctx, req.Subject, req.Description, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -196,20 +590,113 @@ func (h *TODOHandler) Create(ctx context.Context, req *model.CreateTODORequest)
 // 	return &model.ReadTODOResponse{TODOs: todos}, nil
 // }
 
+// Get handles the endpoint that reads the TODO.
+func (h *TODOHandler) Get(ctx context.Context, id int64) (*model.GetTODOResponse, error) {
+	todo, err := h.svc.GetTODO(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GetTODOResponse{TODO: *todo}, nil
+}
+
 // Update handles the endpoint that updates the TODO.
-func (h *TODOHandler) Update(ctx context.Context, req *model.UpdateTODORequest) (*model.UpdateTODOResponse, error) {
-	todo, err := h.svc.UpdateTODO(ctx, req.ID, req.Subject, req.Description)
+func (h *TODOHandler) Update(ctx context.Context, req *model.UpdateTODORequest, opts ...service.WriteOption) (*model.UpdateTODOResponse, error) {
+	todo, err := h.svc.UpdateTODO(ctx, req.ID, req.Subject, req.Description, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &model.UpdateTODOResponse{TODO: *todo}, nil
 }
 
+// Done handles the endpoints that mark the TODO done or undone.
+func (h *TODOHandler) Done(ctx context.Context, id int64, done bool) (*model.DoneTODOResponse, error) {
+	var (
+		todo *model.TODO
+		err  error
+	)
+	if done {
+		todo, err = h.svc.MarkTODODone(ctx, id)
+	} else {
+		todo, err = h.svc.MarkTODOUndone(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model.DoneTODOResponse{TODO: *todo}, nil
+}
+
 // Delete handles the endpoint that deletes the TODOs.
-func (h *TODOHandler) Delete(ctx context.Context, req *model.DeleteTODORequest) (*model.DeleteTODOResponse, error) {
-	err := h.svc.DeleteTODO(ctx, req.IDs)
+func (h *TODOHandler) Delete(ctx context.Context, req *model.DeleteTODORequest, opts ...service.WriteOption) (*model.DeleteTODOResponse, error) {
+	err := h.svc.DeleteTODO(ctx, req.IDs, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &model.DeleteTODOResponse{}, nil
 }
+
+// timeLayouts are the layouts parseTime accepts. The ones without an offset
+// are in the configured time zone.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime parses s as an RFC 3339 date-time. An offset may be omitted, and so
+// may the time, to give a time in the configured time zone.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("must be an RFC 3339 date-time")
+}
+
+// dueAtOption parses due_at of a request into WriteOption. An invalid due_at
+// is added to invalid.
+func dueAtOption(dueAt *string, invalid *model.ErrValidation) service.WriteOption {
+	if dueAt == nil {
+		return service.WithDueAt(nil)
+	}
+	t, err := parseTime(*dueAt)
+	if err != nil {
+		invalid.Add("due_at", err.Error())
+		return service.WithDueAt(nil)
+	}
+	return service.WithDueAt(&t)
+}
+
+// decodeBody decodes the JSON request body into v.
+func decodeBody(r *http.Request, v interface{}) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// readBody reads the whole request body.
+func readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+
+	return io.ReadAll(r.Body)
+}
+
+// writeResponse writes v as a JSON response with 200 OK.
+func writeResponse(w http.ResponseWriter, v interface{}) {
+	writeResponseStatus(w, http.StatusOK, v)
+}
+
+// writeResponseStatus writes v as a JSON response with status. The status code
+// has already been sent when encoding fails, so the error is only logged.
+func writeResponseStatus(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
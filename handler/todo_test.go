@@ -0,0 +1,738 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestTODOHandler(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantTODOs  int
+	}{
+		{name: "Create", method: http.MethodPost, target: "/todos", body: `{"subject":"first"}`, wantStatus: http.StatusOK},
+		{name: "Create second", method: http.MethodPost, target: "/todos", body: `{"subject":"second"}`, wantStatus: http.StatusOK},
+		{name: "Create without subject", method: http.MethodPost, target: "/todos", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Get", method: http.MethodGet, target: "/todos/1", wantStatus: http.StatusOK},
+		{name: "Get missing", method: http.MethodGet, target: "/todos/100", wantStatus: http.StatusNotFound},
+		{name: "Get invalid id", method: http.MethodGet, target: "/todos/abc", wantStatus: http.StatusNotFound},
+		{name: "Update", method: http.MethodPut, target: "/todos/1", body: `{"subject":"updated"}`, wantStatus: http.StatusOK},
+		{name: "Update missing", method: http.MethodPut, target: "/todos/100", body: `{"subject":"updated"}`, wantStatus: http.StatusNotFound},
+		{name: "Done", method: http.MethodPost, target: "/todos/2/done", wantStatus: http.StatusOK},
+		{name: "List", method: http.MethodGet, target: "/todos", wantStatus: http.StatusOK, wantTODOs: 2},
+		{name: "List open", method: http.MethodGet, target: "/todos?status=open", wantStatus: http.StatusOK, wantTODOs: 1},
+		{name: "List invalid status", method: http.MethodGet, target: "/todos?status=unknown", wantStatus: http.StatusBadRequest},
+		{name: "Delete", method: http.MethodDelete, target: "/todos/1", wantStatus: http.StatusOK},
+		{name: "Delete missing", method: http.MethodDelete, target: "/todos/1", wantStatus: http.StatusNotFound},
+		{name: "List after delete", method: http.MethodGet, target: "/todos", wantStatus: http.StatusOK, wantTODOs: 1},
+		{name: "List trash", method: http.MethodGet, target: "/todos/trash", wantStatus: http.StatusOK, wantTODOs: 1},
+		{name: "Restore", method: http.MethodPost, target: "/todos/1/restore", wantStatus: http.StatusOK},
+		{name: "Restore not trashed", method: http.MethodPost, target: "/todos/1/restore", wantStatus: http.StatusNotFound},
+		{name: "List after restore", method: http.MethodGet, target: "/todos", wantStatus: http.StatusOK, wantTODOs: 2},
+		{name: "Purge not trashed", method: http.MethodDelete, target: "/todos/trash/1", wantStatus: http.StatusNotFound},
+		{name: "Delete again", method: http.MethodDelete, target: "/todos", body: `{"ids":[1,2]}`, wantStatus: http.StatusOK},
+		{name: "Purge", method: http.MethodDelete, target: "/todos/trash/1", wantStatus: http.StatusOK},
+		{name: "Purge without ids", method: http.MethodDelete, target: "/todos/trash", body: `{"ids":[]}`, wantStatus: http.StatusBadRequest},
+		{name: "Purge bulk", method: http.MethodDelete, target: "/todos/trash", body: `{"ids":[1,2]}`, wantStatus: http.StatusOK},
+		{name: "Restore purged", method: http.MethodPost, target: "/todos/2/restore", wantStatus: http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+
+		if c.wantTODOs == 0 {
+			continue
+		}
+		var res struct {
+			TODOs []json.RawMessage `json:"todos"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+		if len(res.TODOs) != c.wantTODOs {
+			t.Errorf("%s: unexpected todos, given = %d, expected = %d", c.name, len(res.TODOs), c.wantTODOs)
+		}
+	}
+}
+
+func TestTODOHandlerProblem(t *testing.T) {
+	t.Parallel()
+
+	h := middleware.RequestID(handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository())))
+
+	cases := map[string]struct {
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   model.ErrorCode
+		wantParams []string
+		wantDetail string
+	}{
+		"Invalid JSON": {
+			method: http.MethodPost, target: "/todos", body: `{`,
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrorCodeInvalidJSON,
+		},
+		"Invalid fields": {
+			method: http.MethodPut, target: "/todos", body: `{}`,
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrorCodeValidationFailed, wantParams: []string{"id", "subject"},
+		},
+		"Invalid query": {
+			method: http.MethodGet, target: "/todos?size=a&status=b",
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrorCodeValidationFailed, wantParams: []string{"size", "status"},
+		},
+		"Size too large": {
+			method: http.MethodGet, target: "/todos?size=101",
+			wantStatus: http.StatusBadRequest, wantCode: model.ErrorCodeValidationFailed, wantParams: []string{"size"},
+		},
+		"Not found": {
+			method: http.MethodGet, target: "/todos/1",
+			wantStatus: http.StatusNotFound, wantCode: model.ErrorCodeNotFound, wantDetail: "TODO not found.",
+		},
+		"Checklist of missing todo": {
+			method: http.MethodGet, target: "/todos/1/checklist",
+			wantStatus: http.StatusNotFound, wantCode: model.ErrorCodeNotFound, wantDetail: "TODO not found.",
+		},
+		"Method not allowed": {
+			method: http.MethodPost, target: "/todos/1",
+			wantStatus: http.StatusMethodNotAllowed, wantCode: model.ErrorCodeMethodNotAllowed,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			req.Header.Set(middleware.RequestIDHeader, "test-request")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("unexpected status, given = %d, expected = %d", rec.Code, c.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("unexpected content type, given = %s, expected = application/problem+json", ct)
+			}
+
+			var p model.ProblemResponse
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatal("failed to decode response, err =", err)
+			}
+			if p.Status != c.wantStatus || p.Code != c.wantCode || p.RequestID != "test-request" {
+				t.Errorf("unexpected problem, given = %+v", p)
+			}
+			if c.wantDetail != "" && p.Detail != c.wantDetail {
+				t.Errorf("unexpected detail, given = %q, expected = %q", p.Detail, c.wantDetail)
+			}
+			if len(p.InvalidParams) != len(c.wantParams) {
+				t.Fatalf("unexpected invalid params, given = %+v, expected = %v", p.InvalidParams, c.wantParams)
+			}
+			for i, name := range c.wantParams {
+				if p.InvalidParams[i].Name != name {
+					t.Errorf("unexpected invalid param, given = %s, expected = %s", p.InvalidParams[i].Name, name)
+				}
+			}
+		})
+	}
+}
+
+func TestTODOHandlerGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	h := handler.NewTODOHandler(svc)
+	for _, subject := range []string{"kept", "trashed"} {
+		if _, err := svc.CreateTODO(ctx, subject, ""); err != nil {
+			t.Fatal("failed to create todo, err =", err)
+		}
+	}
+	if err := svc.DeleteTODO(ctx, []int64{2}); err != nil {
+		t.Fatal("failed to delete todo, err =", err)
+	}
+
+	cases := map[string]struct {
+		target      string
+		wantStatus  int
+		wantSubject string
+	}{
+		"Found":        {target: "/todos/1", wantStatus: http.StatusOK, wantSubject: "kept"},
+		"Unknown id":   {target: "/todos/3", wantStatus: http.StatusNotFound},
+		"Trashed":      {target: "/todos/2", wantStatus: http.StatusNotFound},
+		"Id too large": {target: "/todos/99999999999999999999", wantStatus: http.StatusNotFound},
+	}
+
+	for name, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d", name, rec.Code, c.wantStatus)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			var p model.ProblemResponse
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil || p.Code != model.ErrorCodeNotFound {
+				t.Errorf("%s: unexpected problem, given = %+v, err = %v", name, p, err)
+			}
+			continue
+		}
+		var res model.GetTODOResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", name, err)
+			continue
+		}
+		if res.TODO.Subject != c.wantSubject {
+			t.Errorf("%s: unexpected subject, given = %s, expected = %s", name, res.TODO.Subject, c.wantSubject)
+		}
+	}
+
+	var notFound *model.ErrNotFound
+	if _, err := svc.GetTODO(ctx, 3); !errors.As(err, &notFound) {
+		t.Errorf("unexpected error of unknown id, given = %v, expected = *model.ErrNotFound", err)
+	}
+}
+
+func TestTODOHandlerConditional(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		header     http.Header
+		body       string
+		wantStatus int
+		wantETag   string
+	}{
+		{name: "Create", method: http.MethodPost, target: "/todos", body: `{"subject":"first"}`, wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "Get", method: http.MethodGet, target: "/todos/1", wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "Get not modified", method: http.MethodGet, target: "/todos/1", header: http.Header{"If-None-Match": {`W/"1"`}}, wantStatus: http.StatusNotModified, wantETag: `"1"`},
+		{name: "Get modified", method: http.MethodGet, target: "/todos/1", header: http.Header{"If-None-Match": {`"0", "2"`}}, wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "Update", method: http.MethodPut, target: "/todos/1", header: http.Header{"If-Match": {`"1"`}}, body: `{"subject":"mine"}`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "Update stale", method: http.MethodPut, target: "/todos/1", header: http.Header{"If-Match": {`"1"`}}, body: `{"subject":"theirs"}`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Update weak", method: http.MethodPut, target: "/todos/1", header: http.Header{"If-Match": {`W/"2"`}}, body: `{"subject":"theirs"}`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Update any of", method: http.MethodPatch, target: "/todos/1", header: http.Header{"If-Match": {`"1", "2"`}}, body: `{"subject":"mine again"}`, wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "Update collection", method: http.MethodPut, target: "/todos", header: http.Header{"If-Match": {`"2"`}}, body: `{"id":1,"subject":"theirs"}`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Update missing", method: http.MethodPut, target: "/todos/100", header: http.Header{"If-Match": {`"1"`}}, body: `{"subject":"theirs"}`, wantStatus: http.StatusNotFound},
+		{name: "Done", method: http.MethodPost, target: "/todos/1/done", wantStatus: http.StatusOK, wantETag: `"4"`},
+		{name: "Delete stale", method: http.MethodDelete, target: "/todos/1", header: http.Header{"If-Match": {`"3"`}}, wantStatus: http.StatusPreconditionFailed},
+		{name: "Delete", method: http.MethodDelete, target: "/todos/1", header: http.Header{"If-Match": {`"4"`}}, wantStatus: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		for name, values := range c.header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); c.wantETag != "" && etag != c.wantETag {
+			t.Errorf("%s: unexpected etag, given = %s, expected = %s", c.name, etag, c.wantETag)
+		}
+		if c.wantStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: unexpected body, given = %s", c.name, rec.Body)
+		}
+	}
+}
+
+func TestTODOHandlerCompletion(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler. The version is only
+	// bumped by a transition, not by marking a TODO in the state it is.
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantETag   string
+		wantDone   bool
+	}{
+		{name: "Create", method: http.MethodPost, target: "/todos", wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "Done", method: http.MethodPost, target: "/todos/1/done", wantStatus: http.StatusOK, wantETag: `"2"`, wantDone: true},
+		{name: "Done again", method: http.MethodPost, target: "/todos/1/done", wantStatus: http.StatusOK, wantETag: `"2"`, wantDone: true},
+		{name: "Get done", method: http.MethodGet, target: "/todos/1", wantStatus: http.StatusOK, wantETag: `"2"`, wantDone: true},
+		{name: "Undone", method: http.MethodPost, target: "/todos/1/undone", wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "Undone again", method: http.MethodPost, target: "/todos/1/undone", wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "Done once more", method: http.MethodPost, target: "/todos/1/done", wantStatus: http.StatusOK, wantETag: `"4"`, wantDone: true},
+		{name: "Done missing", method: http.MethodPost, target: "/todos/100/done", wantStatus: http.StatusNotFound},
+		{name: "Undone missing", method: http.MethodPost, target: "/todos/100/undone", wantStatus: http.StatusNotFound},
+		{name: "Done by GET", method: http.MethodGet, target: "/todos/1/done", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		body := ""
+		if c.target == "/todos" {
+			body = `{"subject":"first"}`
+		}
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); etag != c.wantETag {
+			t.Errorf("%s: unexpected etag, given = %s, expected = %s", c.name, etag, c.wantETag)
+		}
+		var res struct {
+			TODO model.TODO `json:"todo"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+		if done := res.TODO.CompletedAt != nil; done != c.wantDone {
+			t.Errorf("%s: unexpected completed_at, given = %v, expected done = %t", c.name, res.TODO.CompletedAt, c.wantDone)
+		}
+	}
+}
+
+func TestTODOHandlerPatch(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+	create := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"subject":"subject","description":"description"}`))
+	h.ServeHTTP(httptest.NewRecorder(), create)
+
+	const (
+		mergePatch = "application/merge-patch+json"
+		jsonPatch  = "application/json-patch+json"
+	)
+
+	// each case runs in order against the same TODO
+	cases := []struct {
+		name            string
+		contentType     string
+		ifMatch         string
+		body            string
+		wantStatus      int
+		wantSubject     string
+		wantDescription string
+	}{
+		{name: "Merge subject only", contentType: mergePatch, body: `{"subject":"merged"}`, wantStatus: http.StatusOK, wantSubject: "merged", wantDescription: "description"},
+		{name: "Plain JSON as merge", contentType: "application/json; charset=utf-8", body: `{"description":"plain"}`, wantStatus: http.StatusOK, wantSubject: "merged", wantDescription: "plain"},
+		{name: "Merge null description", contentType: mergePatch, body: `{"description":null}`, wantStatus: http.StatusOK, wantSubject: "merged", wantDescription: ""},
+		{name: "Merge null subject", contentType: mergePatch, body: `{"subject":null}`, wantStatus: http.StatusBadRequest},
+		{name: "Merge read-only field", contentType: mergePatch, body: `{"id":2}`, wantStatus: http.StatusBadRequest},
+		{name: "Merge not object", contentType: mergePatch, body: `["subject"]`, wantStatus: http.StatusBadRequest},
+		{name: "Merge stale", contentType: mergePatch, ifMatch: `"1"`, body: `{"subject":"stale"}`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Invalid JSON", contentType: mergePatch, body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "Unsupported media type", contentType: "text/plain", body: `subject`, wantStatus: http.StatusUnsupportedMediaType},
+		{
+			name: "JSON Patch", contentType: jsonPatch,
+			body:       `[{"op":"test","path":"/subject","value":"merged"},{"op":"replace","path":"/subject","value":"patched"},{"op":"add","path":"/description","value":"added"}]`,
+			wantStatus: http.StatusOK, wantSubject: "patched", wantDescription: "added",
+		},
+		{
+			name: "JSON Patch move and copy", contentType: jsonPatch,
+			body:       `[{"op":"move","from":"/description","path":"/subject"},{"op":"copy","from":"/subject","path":"/description"}]`,
+			wantStatus: http.StatusOK, wantSubject: "added", wantDescription: "added",
+		},
+		{name: "JSON Patch remove", contentType: jsonPatch, body: `[{"op":"remove","path":"/description"}]`, wantStatus: http.StatusOK, wantSubject: "added", wantDescription: ""},
+		{name: "JSON Patch test fails", contentType: jsonPatch, body: `[{"op":"test","path":"/subject","value":"other"},{"op":"replace","path":"/subject","value":"x"}]`, wantStatus: http.StatusConflict},
+		{name: "JSON Patch missing path", contentType: jsonPatch, body: `[{"op":"replace","path":"/nothing","value":"x"}]`, wantStatus: http.StatusConflict},
+		{name: "JSON Patch unknown field", contentType: jsonPatch, body: `[{"op":"add","path":"/id","value":2}]`, wantStatus: http.StatusBadRequest},
+		{name: "JSON Patch removes subject", contentType: jsonPatch, body: `[{"op":"remove","path":"/subject"}]`, wantStatus: http.StatusBadRequest},
+		{name: "JSON Patch invalid op", contentType: jsonPatch, body: `[{"op":"merge","path":"/subject"},{"op":"add","path":"subject","value":"x"}]`, wantStatus: http.StatusBadRequest},
+		{name: "JSON Patch not array", contentType: jsonPatch, body: `{"subject":"x"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		if c.ifMatch != "" {
+			req.Header.Set("If-Match", c.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res model.UpdateTODOResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+		if res.TODO.Subject != c.wantSubject || res.TODO.Description != c.wantDescription {
+			t.Errorf("%s: unexpected todo, given = %q/%q, expected = %q/%q",
+				c.name, res.TODO.Subject, res.TODO.Description, c.wantSubject, c.wantDescription)
+		}
+	}
+}
+
+func TestTODOHandlerPatchTags(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+	create := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"subject":"subject"}`))
+	h.ServeHTTP(httptest.NewRecorder(), create)
+
+	// each case runs in order against the same TODO. Tags differing in the
+	// case of ASCII letters only are the same, while the others are not, like
+	// the NOCASE collation of SQLite.
+	cases := []struct {
+		name     string
+		body     string
+		wantETag string
+		wantTags []string
+	}{
+		{name: "Add tags", body: `{"tags":["work","Äpfel"]}`, wantETag: `"2"`, wantTags: []string{"work", "Äpfel"}},
+		{name: "Same tags in ASCII case", body: `{"tags":["WORK","Äpfel"]}`, wantETag: `"2"`, wantTags: []string{"work", "Äpfel"}},
+		{name: "Other tags in non-ASCII case", body: `{"tags":["work","äpfel"]}`, wantETag: `"3"`, wantTags: []string{"work", "äpfel"}},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, http.StatusOK, rec.Body)
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); etag != c.wantETag {
+			t.Errorf("%s: unexpected etag, given = %s, expected = %s", c.name, etag, c.wantETag)
+		}
+		var res model.UpdateTODOResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+		if fmt.Sprint(res.TODO.Tags) != fmt.Sprint(c.wantTags) {
+			t.Errorf("%s: unexpected tags, given = %v, expected = %v", c.name, res.TODO.Tags, c.wantTags)
+		}
+	}
+}
+
+func TestTODOHandlerDue(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// an offset may be omitted to give a time in the configured time zone
+	local, err := time.ParseInLocation("2006-01-02T15:04:05", "2030-01-02T09:00:00", time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	// each case runs in order against the same handler
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantDueAt  string
+		wantIDs    []int64
+	}{
+		{name: "Create with offset", method: http.MethodPost, target: "/todos", body: `{"subject":"first","due_at":"2030-01-01T09:00:00+09:00"}`, wantStatus: http.StatusOK, wantDueAt: "2030-01-01T00:00:00Z"},
+		{name: "Create without offset", method: http.MethodPost, target: "/todos", body: `{"subject":"second","due_at":"2030-01-02T09:00:00"}`, wantStatus: http.StatusOK, wantDueAt: local.Format(time.RFC3339)},
+		{name: "Create without due", method: http.MethodPost, target: "/todos", body: `{"subject":"third"}`, wantStatus: http.StatusOK},
+		{name: "Create overdue", method: http.MethodPost, target: "/todos", body: `{"subject":"fourth","due_at":"` + past + `"}`, wantStatus: http.StatusOK, wantDueAt: past},
+		{name: "Create invalid due", method: http.MethodPost, target: "/todos", body: `{"subject":"fifth","due_at":"tomorrow"}`, wantStatus: http.StatusBadRequest},
+		{name: "Overdue", method: http.MethodGet, target: "/todos?overdue=true", wantStatus: http.StatusOK, wantIDs: []int64{4}},
+		{name: "Due before", method: http.MethodGet, target: "/todos?due_before=2030-01-02", wantStatus: http.StatusOK, wantIDs: []int64{4, 1}},
+		{name: "Due after", method: http.MethodGet, target: "/todos?due_after=2030-01-01T00:00:00Z", wantStatus: http.StatusOK, wantIDs: []int64{2, 1}},
+		{name: "Sort by due", method: http.MethodGet, target: "/todos?sort=due", wantStatus: http.StatusOK, wantIDs: []int64{4, 1, 2, 3}},
+		{name: "Sort by due after prev", method: http.MethodGet, target: "/todos?sort=due&prev_id=1", wantStatus: http.StatusOK, wantIDs: []int64{2, 3}},
+		{name: "Invalid filters", method: http.MethodGet, target: "/todos?due_before=x&overdue=maybe&sort=title", wantStatus: http.StatusBadRequest},
+		{name: "Sort with query", method: http.MethodGet, target: "/todos?sort=due&q=first", wantStatus: http.StatusBadRequest},
+		{name: "Update clears due", method: http.MethodPut, target: "/todos/1", body: `{"subject":"first"}`, wantStatus: http.StatusOK},
+		{name: "Patch sets due", method: http.MethodPatch, target: "/todos/3", body: `{"due_at":"2030-01-03T00:00:00Z"}`, wantStatus: http.StatusOK, wantDueAt: "2030-01-03T00:00:00Z"},
+		{name: "Patch clears due", method: http.MethodPatch, target: "/todos/2", body: `{"due_at":null}`, wantStatus: http.StatusOK},
+		{name: "Patch invalid due", method: http.MethodPatch, target: "/todos/2", body: `{"due_at":"2030-13-01"}`, wantStatus: http.StatusBadRequest},
+		{name: "Done overdue", method: http.MethodPost, target: "/todos/4/done", wantStatus: http.StatusOK, wantDueAt: past},
+		{name: "No longer overdue", method: http.MethodGet, target: "/todos?overdue=true", wantStatus: http.StatusOK, wantIDs: []int64{}},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			TODO  *model.TODO   `json:"todo"`
+			TODOs []*model.TODO `json:"todos"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		if c.method == http.MethodGet {
+			ids := make([]int64, len(res.TODOs))
+			for i, todo := range res.TODOs {
+				ids[i] = todo.ID
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.wantIDs) {
+				t.Errorf("%s: unexpected ids, given = %v, expected = %v", c.name, ids, c.wantIDs)
+			}
+			continue
+		}
+
+		var given string
+		if res.TODO.DueAt != nil {
+			given = res.TODO.DueAt.UTC().Format(time.RFC3339)
+		}
+		want := c.wantDueAt
+		if want != "" {
+			wantAt, _ := time.Parse(time.RFC3339, want)
+			want = wantAt.UTC().Format(time.RFC3339)
+		}
+		if given != want {
+			t.Errorf("%s: unexpected due_at, given = %q, expected = %q", c.name, given, want)
+		}
+	}
+}
+
+func TestTODOHandlerSort(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewTODOHandler(service.NewTODOService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler, and withCursor appends
+	// the last next_cursor given
+	cases := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		withCursor   bool
+		wantStatus   int
+		wantPriority int
+		wantIDs      []int64
+		wantCursor   bool
+	}{
+		{name: "Create without priority", method: http.MethodPost, target: "/todos", body: `{"subject":"low"}`, wantStatus: http.StatusOK},
+		{name: "Create highest", method: http.MethodPost, target: "/todos", body: `{"subject":"high","priority":4}`, wantStatus: http.StatusOK, wantPriority: 4},
+		{name: "Create middle", method: http.MethodPost, target: "/todos", body: `{"subject":"mid","priority":2}`, wantStatus: http.StatusOK, wantPriority: 2},
+		{name: "Create another highest", method: http.MethodPost, target: "/todos", body: `{"subject":"also high","priority":4}`, wantStatus: http.StatusOK, wantPriority: 4},
+		{name: "Create too high", method: http.MethodPost, target: "/todos", body: `{"subject":"urgent","priority":5}`, wantStatus: http.StatusBadRequest},
+		{name: "Create negative", method: http.MethodPost, target: "/todos", body: `{"subject":"never","priority":-1}`, wantStatus: http.StatusBadRequest},
+		{name: "First page", method: http.MethodGet, target: "/todos?sort=priority&size=2", wantStatus: http.StatusOK, wantIDs: []int64{4, 2}, wantCursor: true},
+		{name: "Cursor for another sort", method: http.MethodGet, target: "/todos?sort=subject&size=2", withCursor: true, wantStatus: http.StatusBadRequest},
+		{name: "Cursor with prev_id", method: http.MethodGet, target: "/todos?sort=priority&size=2&prev_id=2", withCursor: true, wantStatus: http.StatusBadRequest},
+		{name: "Last page", method: http.MethodGet, target: "/todos?sort=priority&size=2", withCursor: true, wantStatus: http.StatusOK, wantIDs: []int64{3, 1}},
+		{name: "Malformed cursor", method: http.MethodGet, target: "/todos?sort=priority&cursor=x", wantStatus: http.StatusBadRequest},
+		{name: "Ascending then subject", method: http.MethodGet, target: "/todos?sort=priority:asc,subject", wantStatus: http.StatusOK, wantIDs: []int64{1, 3, 4, 2}},
+		{name: "Descending subject", method: http.MethodGet, target: "/todos?sort=subject:desc,priority", wantStatus: http.StatusOK, wantIDs: []int64{3, 1, 2, 4}},
+		{name: "Invalid direction", method: http.MethodGet, target: "/todos?sort=priority:up", wantStatus: http.StatusBadRequest},
+		{name: "Repeated field", method: http.MethodGet, target: "/todos?sort=priority,priority:asc", wantStatus: http.StatusBadRequest},
+		{name: "Patch priority", method: http.MethodPatch, target: "/todos/1", body: `{"priority":3}`, wantStatus: http.StatusOK, wantPriority: 3},
+		{name: "Patch invalid priority", method: http.MethodPatch, target: "/todos/1", body: `{"priority":1.5}`, wantStatus: http.StatusBadRequest},
+		{name: "Patch clears priority", method: http.MethodPatch, target: "/todos/1", body: `{"priority":null}`, wantStatus: http.StatusOK},
+		{name: "Update clears priority", method: http.MethodPut, target: "/todos/3", body: `{"subject":"mid"}`, wantStatus: http.StatusOK},
+	}
+
+	var cursor string
+	for _, c := range cases {
+		target := c.target
+		if c.withCursor {
+			target += "&cursor=" + cursor
+		}
+		req := httptest.NewRequest(c.method, target, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			TODO       *model.TODO   `json:"todo"`
+			TODOs      []*model.TODO `json:"todos"`
+			NextCursor string        `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		if c.method == http.MethodGet {
+			ids := make([]int64, len(res.TODOs))
+			for i, todo := range res.TODOs {
+				ids[i] = todo.ID
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.wantIDs) {
+				t.Errorf("%s: unexpected ids, given = %v, expected = %v", c.name, ids, c.wantIDs)
+			}
+			if (res.NextCursor != "") != c.wantCursor {
+				t.Errorf("%s: unexpected next_cursor, given = %q, expected one = %t", c.name, res.NextCursor, c.wantCursor)
+			}
+			if res.NextCursor != "" {
+				cursor = res.NextCursor
+			}
+			continue
+		}
+
+		if res.TODO.Priority != c.wantPriority {
+			t.Errorf("%s: unexpected priority, given = %d, expected = %d", c.name, res.TODO.Priority, c.wantPriority)
+		}
+	}
+}
+
+func TestTODOHandlerPages(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	h := handler.NewTODOHandler(svc)
+	for i := 1; i <= 5; i++ {
+		if _, err := svc.CreateTODO(context.Background(), fmt.Sprint("todo ", i), ""); err != nil {
+			t.Fatal("failed to create todo, err =", err)
+		}
+	}
+
+	type page struct {
+		TODOs      []*model.TODO `json:"todos"`
+		HasMore    bool          `json:"has_more"`
+		NextCursor string        `json:"next_cursor"`
+		Total      *int64        `json:"total"`
+	}
+	get := func(target string) (*httptest.ResponseRecorder, *page) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var p page
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("%s: failed to decode response, err = %v", target, err)
+			}
+		}
+		return rec, &p
+	}
+	nextLink := regexp.MustCompile(`<([^>]*)>; rel="next"`)
+
+	// the next link is followed until the last page
+	target := "/todos?size=2&total=true"
+	var ids []int64
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("too many pages, ids =", ids)
+		}
+		rec, p := get(target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status, given = %d, body = %s", target, rec.Code, rec.Body)
+		}
+		if p.Total == nil || *p.Total != 5 {
+			t.Errorf("%s: unexpected total, given = %v, expected = 5", target, p.Total)
+		}
+		link := rec.Header().Get("Link")
+		if !strings.Contains(link, `</todos?size=2&total=true>; rel="first"`) {
+			t.Errorf("%s: missing first link, given = %q", target, link)
+		}
+		target = ""
+		if m := nextLink.FindStringSubmatch(link); m != nil {
+			target = m[1]
+		}
+		if p.HasMore != (target != "") || p.HasMore != (p.NextCursor != "") {
+			t.Errorf("unexpected has_more = %t, next_cursor = %q, Link = %q", p.HasMore, p.NextCursor, link)
+		}
+		for _, todo := range p.TODOs {
+			ids = append(ids, todo.ID)
+		}
+	}
+	if fmt.Sprint(ids) != "[5 4 3 2 1]" {
+		t.Errorf("unexpected ids, given = %v, expected = [5 4 3 2 1]", ids)
+	}
+
+	_, first := get("/todos?size=2")
+	if first.Total != nil {
+		t.Errorf("unexpected total, given = %d, expected none", *first.Total)
+	}
+	// the first character of the signature is changed
+	dot := strings.IndexByte(first.NextCursor, '.')
+	tampered := first.NextCursor[:dot+1] + "A" + first.NextCursor[dot+2:]
+	if first.NextCursor[dot+1] == 'A' {
+		tampered = first.NextCursor[:dot+1] + "B" + first.NextCursor[dot+2:]
+	}
+	other := handler.NewTODOHandler(svc)
+	for name, target := range map[string]string{
+		"Tampered cursor":       "/todos?size=2&cursor=" + tampered,
+		"Unsigned cursor":       "/todos?size=2&cursor=" + strings.Split(first.NextCursor, ".")[0],
+		"Negative size":         "/todos?size=-1",
+		"Size over the maximum": "/todos?size=101",
+		"Invalid total":         "/todos?total=maybe",
+	} {
+		if rec, _ := get(target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+	rec := httptest.NewRecorder()
+	other.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todos?size=2&cursor="+first.NextCursor, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("cursor of another key: unexpected status, given = %d, expected = %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec, _ := get("/todos?size=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty page: unexpected status, given = %d, expected = %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A WebhookHandler implements handling REST endpoints of webhooks and their
+// delivery logs. The secret of a webhook is only returned when created.
+type WebhookHandler struct {
+	svc  *service.WebhookService
+	Path string
+	// DefaultPageSize is the number of deliveries listed when size is not
+	// given, and MaxPageSize is the largest size accepted.
+	DefaultPageSize int64
+	MaxPageSize     int64
+}
+
+// NewWebhookHandler returns WebhookHandler based http.Handler.
+func NewWebhookHandler(svc *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		svc:             svc,
+		Path:            "/webhooks",
+		DefaultPageSize: 20,
+		MaxPageSize:     100,
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Path), "/")
+	if rest == "" {
+		h.serveCollection(w, r)
+		return
+	}
+
+	segments := strings.Split(rest, "/")
+	id, err := strconv.ParseInt(segments[0], 10, 64)
+	if err != nil || id <= 0 {
+		writeNotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		h.serveResource(w, r, id)
+	case len(segments) == 2 && segments[1] == "deliveries":
+		metrics.SetRoute(r, h.Path+"/{id}/deliveries")
+		h.serveDeliveries(w, r, id)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// serveCollection handles requests to /webhooks.
+func (h *WebhookHandler) serveCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.svc.ReadWebhooks(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		for _, hook := range hooks {
+			hook.Secret = ""
+		}
+		writeResponse(w, &model.ReadWebhookResponse{Webhooks: hooks})
+
+	case http.MethodPost:
+		var data model.CreateWebhookRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		hook, err := h.svc.CreateWebhook(r.Context(), data.URL, data.Events, data.Active == nil || *data.Active, data.Secret)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.CreateWebhookResponse{Webhook: *hook})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// serveResource handles requests to /webhooks/{id}.
+func (h *WebhookHandler) serveResource(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+		hook, err := h.svc.GetWebhook(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		hook.Secret = ""
+		writeResponse(w, &model.GetWebhookResponse{Webhook: *hook})
+
+	case http.MethodPut:
+		var data model.UpdateWebhookRequest
+		if err := decodeBody(r, &data); err != nil {
+			writeInvalidJSON(w, r, err)
+			return
+		}
+
+		hook, err := h.svc.UpdateWebhook(r.Context(), id, data.URL, data.Events, data.Active == nil || *data.Active, data.Secret)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		hook.Secret = ""
+		writeResponse(w, &model.UpdateWebhookResponse{Webhook: *hook})
+
+	case http.MethodDelete:
+		if err := h.svc.DeleteWebhook(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeResponse(w, &model.DeleteWebhookResponse{})
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// serveDeliveries handles requests to /webhooks/{id}/deliveries, which lists
+// the deliveries the latest first with the query parameters prev_id and size.
+func (h *WebhookHandler) serveDeliveries(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	var prevID int64 = 0
+	var size int64 = h.DefaultPageSize
+
+	invalid := &model.ErrValidation{}
+	if prevIDStr := query.Get("prev_id"); len(prevIDStr) != 0 {
+		var err error
+		prevID, err = strconv.ParseInt(prevIDStr, 10, 64)
+		if err != nil {
+			invalid.Add("prev_id", "must be an integer")
+		}
+	}
+	if sizeStr := query.Get("size"); len(sizeStr) != 0 {
+		var err error
+		size, err = strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			invalid.Add("size", "must be an integer")
+		} else if size < 0 || size > h.MaxPageSize {
+			invalid.Add("size", fmt.Sprintf("must be between 0 and %d", h.MaxPageSize))
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	deliveries, err := h.svc.ReadDeliveries(r.Context(), id, prevID, size)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResponse(w, &model.ReadWebhookDeliveryResponse{Deliveries: deliveries})
+}
@@ -0,0 +1,307 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	t.Parallel()
+
+	h := handler.NewWebhookHandler(service.NewWebhookService(repository.NewMemoryTODORepository()))
+
+	// each case runs in order against the same handler
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		// want is the webhook like "url [events] active secret", or the ids
+		// of the webhooks or deliveries listed
+		want string
+	}{
+		{name: "Create webhook", method: http.MethodPost, target: "/webhooks", body: `{"url":"http://example.com/hook","events":["todo.created"]}`, wantStatus: http.StatusOK, want: "http://example.com/hook [todo.created] true secret"},
+		{name: "Create inactive webhook with secret", method: http.MethodPost, target: "/webhooks", body: `{"url":"https://example.com/all","active":false,"secret":"0123456789abcdef"}`, wantStatus: http.StatusOK, want: "https://example.com/all [] false secret"},
+		{name: "Create webhook of relative URL", method: http.MethodPost, target: "/webhooks", body: `{"url":"/hook"}`, wantStatus: http.StatusBadRequest},
+		{name: "Create webhook of unknown event", method: http.MethodPost, target: "/webhooks", body: `{"url":"http://example.com","events":["todo.read"]}`, wantStatus: http.StatusBadRequest},
+		{name: "Create webhook of duplicate events", method: http.MethodPost, target: "/webhooks", body: `{"url":"http://example.com","events":["todo.created","todo.created"]}`, wantStatus: http.StatusBadRequest},
+		{name: "Create webhook of short secret", method: http.MethodPost, target: "/webhooks", body: `{"url":"http://example.com","secret":"short"}`, wantStatus: http.StatusBadRequest},
+		{name: "Create webhook of invalid JSON", method: http.MethodPost, target: "/webhooks", body: `{"url":1}`, wantStatus: http.StatusBadRequest},
+		{name: "Get webhook", method: http.MethodGet, target: "/webhooks/1", wantStatus: http.StatusOK, want: "http://example.com/hook [todo.created] true -"},
+		{name: "List webhooks", method: http.MethodGet, target: "/webhooks", wantStatus: http.StatusOK, want: "[1 2]"},
+		{name: "Update webhook", method: http.MethodPut, target: "/webhooks/1", body: `{"url":"http://example.com/hook2","events":["todo.created","todo.deleted"],"active":false}`, wantStatus: http.StatusOK, want: "http://example.com/hook2 [todo.created todo.deleted] false -"},
+		{name: "Update missing webhook", method: http.MethodPut, target: "/webhooks/99", body: `{"url":"http://example.com"}`, wantStatus: http.StatusNotFound},
+		{name: "List deliveries", method: http.MethodGet, target: "/webhooks/1/deliveries", wantStatus: http.StatusOK, want: "[]"},
+		{name: "List deliveries of invalid size", method: http.MethodGet, target: "/webhooks/1/deliveries?size=1000&prev_id=x", wantStatus: http.StatusBadRequest},
+		{name: "List deliveries of missing webhook", method: http.MethodGet, target: "/webhooks/99/deliveries", wantStatus: http.StatusNotFound},
+		{name: "Post deliveries", method: http.MethodPost, target: "/webhooks/1/deliveries", wantStatus: http.StatusMethodNotAllowed},
+		{name: "Unknown subresource", method: http.MethodGet, target: "/webhooks/1/events", wantStatus: http.StatusNotFound},
+		{name: "Delete webhook", method: http.MethodDelete, target: "/webhooks/2", wantStatus: http.StatusOK},
+		{name: "Get deleted webhook", method: http.MethodGet, target: "/webhooks/2", wantStatus: http.StatusNotFound},
+		{name: "Method not allowed", method: http.MethodPatch, target: "/webhooks", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d, body = %s", c.name, rec.Code, c.wantStatus, rec.Body)
+			continue
+		}
+		if c.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			Webhook    *model.Webhook           `json:"webhook"`
+			Webhooks   []*model.Webhook         `json:"webhooks"`
+			Deliveries []*model.WebhookDelivery `json:"deliveries"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s: failed to decode response, err = %v", c.name, err)
+			continue
+		}
+
+		var given string
+		switch {
+		case res.Webhook != nil:
+			secret := "-"
+			if res.Webhook.Secret != "" {
+				secret = "secret"
+			}
+			given = fmt.Sprintf("%s %v %t %s", res.Webhook.URL, res.Webhook.Events, res.Webhook.Active, secret)
+		case res.Webhooks != nil:
+			ids := make([]int64, len(res.Webhooks))
+			for i, hook := range res.Webhooks {
+				if hook.Secret != "" {
+					t.Errorf("%s: unexpected secret of webhook %d", c.name, hook.ID)
+				}
+				ids[i] = hook.ID
+			}
+			given = fmt.Sprint(ids)
+		case res.Deliveries != nil:
+			ids := make([]int64, len(res.Deliveries))
+			for i, delivery := range res.Deliveries {
+				ids[i] = delivery.ID
+			}
+			given = fmt.Sprint(ids)
+		}
+		if c.want != "" && given != c.want {
+			t.Errorf("%s: unexpected result, given = %s, expected = %s", c.name, given, c.want)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := repository.NewMemoryTODORepository()
+	todoService := service.NewTODOService(repo)
+	webhookService := service.NewWebhookService(repo)
+	webhookService.MaxAttempts = 2
+	// retried at once, until the backoff is checked
+	webhookService.MinBackoff = 0
+	h := handler.NewWebhookHandler(webhookService)
+
+	const secret = "0123456789abcdef"
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+	)
+	// the flaky receiver fails the first attempt of every delivery
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error("failed to read delivery, err =", err)
+			return
+		}
+		timestamp, err := strconv.ParseInt(r.Header.Get(service.WebhookTimestampHeader), 10, 64)
+		if err != nil || r.Header.Get(service.WebhookSignatureHeader) != "sha256="+service.SignWebhook(secret, timestamp, body) {
+			t.Errorf("unexpected signature, given = %q", r.Header.Get(service.WebhookSignatureHeader))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event model.TODOEvent
+		if err := json.Unmarshal(body, &event); err != nil || string(event.Type) != r.Header.Get(service.WebhookEventHeader) {
+			t.Errorf("unexpected event, given = %s, err = %v", body, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		id := r.Header.Get(service.WebhookDeliveryHeader)
+		attempts[id]++
+		if attempts[id] == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flaky.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	if _, err := webhookService.CreateWebhook(ctx, flaky.URL, nil, true, secret); err != nil {
+		t.Fatal("failed to create webhook, err =", err)
+	}
+	if _, err := webhookService.CreateWebhook(ctx, down.URL, []model.TODOEventType{model.TODOEventCreated}, true, ""); err != nil {
+		t.Fatal("failed to create webhook, err =", err)
+	}
+
+	todo, err := todoService.CreateTODO(ctx, "first", "")
+	if err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	if err := todoService.DeleteTODO(ctx, []int64{todo.ID}); err != nil {
+		t.Fatal("failed to delete todo, err =", err)
+	}
+
+	// both the webhooks fail at first, then the flaky one succeeds and the
+	// down one runs out of attempts
+	for i, want := range []int{3, 3, 0} {
+		if n, err := webhookService.DeliverWebhooks(ctx); err != nil || n != want {
+			t.Errorf("unexpected deliveries of pass %d, given = %d, err = %v, expected = %d", i+1, n, err, want)
+		}
+	}
+
+	// deliveries returns the delivery log of the webhook by id like
+	// "type:status/attempts/code".
+	deliveries := func(id int64) ([]*model.WebhookDelivery, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", id), nil))
+		var res model.ReadWebhookDeliveryResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal("failed to decode deliveries, err =", err)
+		}
+		given := make([]string, len(res.Deliveries))
+		for i, d := range res.Deliveries {
+			given[i] = fmt.Sprintf("%s:%s/%d/%d", d.Event.Type, d.Status, d.Attempts, d.LastStatusCode)
+		}
+		return res.Deliveries, strings.Join(given, " ")
+	}
+	for id, want := range map[int64]string{
+		1: "todo.deleted:succeeded/2/204 todo.created:succeeded/2/204",
+		2: "todo.created:failed/2/503",
+	} {
+		if _, given := deliveries(id); given != want {
+			t.Errorf("unexpected deliveries of webhook %d, given = %s, expected = %s", id, given, want)
+		}
+	}
+
+	// a failed attempt is retried after the backoff
+	webhookService.MinBackoff = time.Hour
+	if _, err := todoService.CreateTODO(ctx, "second", ""); err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	for i, want := range []int{2, 0} {
+		if n, err := webhookService.DeliverWebhooks(ctx); err != nil || n != want {
+			t.Errorf("unexpected deliveries of backoff pass %d, given = %d, err = %v, expected = %d", i+1, n, err, want)
+		}
+	}
+	list, given := deliveries(1)
+	if !strings.HasPrefix(given, "todo.created:pending/1/500 ") || list[0].Event.TODO == nil || list[0].Event.TODO.Subject != "second" {
+		t.Fatalf("unexpected deliveries, given = %s", given)
+	}
+	if next := list[0].NextAttemptAt; next == nil || time.Until(*next) < 59*time.Minute || time.Until(*next) > time.Hour {
+		t.Errorf("unexpected next attempt, given = %v", next)
+	}
+
+	// the finished deliveries are pruned after the retention, and the pending
+	// ones kept
+	webhookService.DeliveryRetention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := webhookService.DeliverWebhooks(ctx); err != nil {
+		t.Fatal("failed to deliver webhooks, err =", err)
+	}
+	for id, want := range map[int64]string{
+		1: "todo.created:pending/1/500",
+		2: "todo.created:pending/1/503",
+	} {
+		if _, given := deliveries(id); given != want {
+			t.Errorf("unexpected deliveries of webhook %d after pruning, given = %s, expected = %s", id, given, want)
+		}
+	}
+}
+
+func TestWebhookDeliverySlow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := repository.NewMemoryTODORepository()
+	todoService := service.NewTODOService(repo)
+	webhookService := service.NewWebhookService(repo)
+	webhookService.Client = &http.Client{Timeout: time.Minute}
+	webhookService.Concurrency = 2
+	h := handler.NewWebhookHandler(webhookService)
+
+	// the slow receiver holds the attempt until released
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+
+	if _, err := webhookService.CreateWebhook(ctx, slow.URL, nil, true, ""); err != nil {
+		t.Fatal("failed to create webhook, err =", err)
+	}
+	if _, err := todoService.CreateTODO(ctx, "slow", ""); err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := webhookService.DeliverWebhooks(ctx)
+		done <- result{n: n, err: err}
+	}()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery was not attempted")
+	}
+
+	// a batch of 100 on 2 workers may take 50 timeouts, so the delivery in
+	// flight is leased at least that long and not attempted again
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/1/deliveries", nil))
+	var res model.ReadWebhookDeliveryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal("failed to decode deliveries, err =", err)
+	}
+	if len(res.Deliveries) != 1 || res.Deliveries[0].NextAttemptAt == nil || time.Until(*res.Deliveries[0].NextAttemptAt) < 50*time.Minute {
+		t.Errorf("unexpected lease, given = %+v", res.Deliveries)
+	}
+	if n, err := webhookService.DeliverWebhooks(ctx); err != nil || n != 0 {
+		t.Errorf("unexpected deliveries during the attempt, given = %d, err = %v, expected = 0", n, err)
+	}
+
+	close(release)
+	if r := <-done; r.err != nil || r.n != 1 {
+		t.Errorf("unexpected deliveries, given = %d, err = %v, expected = 1", r.n, r.err)
+	}
+}
@@ -0,0 +1,484 @@
+// Package websocket implements the part of the WebSocket protocol (RFC 6455)
+// which the handlers need: the opening handshake of a server, messages which
+// are not fragmented when written, pings and the closing handshake. Dial is a
+// minimal client for tests.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Opcode values of frames.
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xa
+)
+
+// Status codes of closing a connection.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	CloseTryAgainLater   = 1013
+)
+
+// acceptGUID is appended to the key of a handshake to compute the accept key.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Limits of frames.
+const (
+	// maxControlPayload is the largest payload of a control frame.
+	maxControlPayload = 125
+	// defaultMaxMessageSize is the largest message read unless set otherwise.
+	defaultMaxMessageSize = 1 << 20
+	// closeTimeout is how long writing the close frame may take.
+	closeTimeout = time.Second
+)
+
+// ErrCloseSent is returned writing a message after the close frame was sent.
+var ErrCloseSent = errors.New("websocket: close frame already sent")
+
+// An Opcode tells the kind of a frame.
+type Opcode byte
+
+// A CloseError expresses that the connection was closed with a status code,
+// by the peer or on a protocol error.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with %d, %s", e.Code, e.Reason)
+}
+
+// A HandshakeError expresses that a request is not a valid opening handshake.
+// Nothing has been written for the request then, so that the caller can
+// respond with Status.
+type HandshakeError struct {
+	Status int
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: " + e.Reason
+}
+
+// Upgrade completes the opening handshake of r and takes over its connection.
+// If r is not a valid handshake, it returns HandshakeError having set the
+// headers telling the protocol expected to w.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, &HandshakeError{Status: http.StatusMethodNotAllowed, Reason: "method must be GET"}
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, &HandshakeError{Status: http.StatusUpgradeRequired, Reason: "request must upgrade to websocket"}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, &HandshakeError{Status: http.StatusUpgradeRequired, Reason: "Sec-WebSocket-Version must be 13"}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, &HandshakeError{Status: http.StatusBadRequest, Reason: "Sec-WebSocket-Key must be 16 bytes in base64"}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: response writer does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// the deadlines of the server are for requests, not for a connection
+	// living as long as the client wants
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if rw.Reader.Buffered() > 0 {
+		// a client must wait for the handshake before sending frames
+		conn.Close()
+		return nil, errors.New("websocket: client sent data before handshake")
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := io.WriteString(conn, response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newConn(conn, rw.Reader, false), nil
+}
+
+// Dial opens a connection to the WebSocket server at rawURL, a ws or http
+// URL. It is meant for tests, so it supports neither TLS nor proxies.
+func Dial(rawURL string) (*Conn, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch req.URL.Scheme {
+	case "ws", "http":
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", req.URL.Scheme)
+	}
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed with status %d", resp.StatusCode)
+	}
+
+	return newConn(conn, br, true), nil
+}
+
+// acceptKey returns Sec-WebSocket-Accept for Sec-WebSocket-Key key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma separated header of h has token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A Conn is a WebSocket connection. Messages may be written by multiple
+// goroutines, but read by only one.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// client masks the frames written, and expects them unmasked to read.
+	client bool
+
+	// MaxMessageSize is the largest message in bytes which ReadMessage
+	// accepts. A larger one closes the connection.
+	MaxMessageSize int64
+	// ReadTimeout is how long ReadMessage waits for each frame, including
+	// pongs, if positive. A peer answering pings keeps the connection alive.
+	ReadTimeout time.Duration
+	// WriteTimeout is how long writing each frame may take, if positive.
+	WriteTimeout time.Duration
+
+	// mu serializes writing frames.
+	mu        sync.Mutex
+	closeSent bool
+	// deadlineMu guards closing and the write deadline, so that Close can
+	// cut off a write blocked on a peer not reading.
+	deadlineMu sync.Mutex
+	closing    bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		client:         client,
+		MaxMessageSize: defaultMaxMessageSize,
+	}
+}
+
+// ReadMessage reads the next text or binary message. It answers pings and
+// the closing handshake on the way. A close frame from the peer or a protocol
+// error returns CloseError after the connection is closed.
+func (c *Conn) ReadMessage() (Opcode, []byte, error) {
+	var (
+		op      Opcode
+		message []byte
+	)
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			code, reason := CloseNoStatus, ""
+			switch {
+			case len(payload) == 1:
+				return 0, nil, c.fail(CloseProtocolError, "invalid close frame")
+			case len(payload) >= 2:
+				code, reason = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+			}
+			c.Close(code, "")
+			return 0, nil, &CloseError{Code: code, Reason: reason}
+		case OpContinuation:
+			if op == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case OpText, OpBinary:
+			if op != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "fragmented message interrupted")
+			}
+			op = frameOp
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(message)+len(payload)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if op == OpText && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, "text is not valid UTF-8")
+		}
+		return op, message, nil
+	}
+}
+
+// readFrame reads a frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, op Opcode, payload []byte, err error) {
+	if c.ReadTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout)); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	op = Opcode(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, "frame masked wrongly")
+	}
+
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= OpClose && (!fin || size > maxControlPayload) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	// the payload is allocated only once it cannot make a message too big
+	if size > uint64(c.MaxMessageSize) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage writes data as a single frame of op, which must not be
+// OpClose; Close sends that.
+func (c *Conn) WriteMessage(op Opcode, data []byte) error {
+	if op == OpClose || op == OpContinuation {
+		return fmt.Errorf("websocket: cannot write a message of opcode %d", op)
+	}
+	if op >= OpClose && len(data) > maxControlPayload {
+		return errors.New("websocket: control frame too big")
+	}
+	return c.writeFrame(op, data)
+}
+
+// Close sends the close frame with code and reason unless it has been sent,
+// and closes the connection. code CloseNoStatus sends no status code.
+func (c *Conn) Close(code int, reason string) error {
+	c.deadlineMu.Lock()
+	c.closing = true
+	// a blocked write fails by then, and so does the close frame if the peer
+	// is not reading
+	c.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	c.deadlineMu.Unlock()
+
+	c.mu.Lock()
+	if !c.closeSent {
+		var payload []byte
+		if code != CloseNoStatus {
+			if len(reason) > maxControlPayload-2 {
+				reason = reason[:maxControlPayload-2]
+			}
+			payload = make([]byte, 2+len(reason))
+			binary.BigEndian.PutUint16(payload, uint16(code))
+			copy(payload[2:], reason)
+		}
+		c.writeFrameLocked(OpClose, payload)
+		c.closeSent = true
+	}
+	c.mu.Unlock()
+
+	return c.conn.Close()
+}
+
+// fail closes the connection on a protocol error, and returns CloseError for
+// it.
+func (c *Conn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// writeFrame writes a final frame of op with payload.
+func (c *Conn) writeFrame(op Opcode, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if err := c.setWriteDeadline(); err != nil {
+		return err
+	}
+	return c.writeFrameLocked(op, payload)
+}
+
+// setWriteDeadline sets the deadline of writing a frame by WriteTimeout,
+// unless Close has set it already.
+func (c *Conn) setWriteDeadline() error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	if c.closing {
+		return ErrCloseSent
+	}
+	if c.WriteTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+}
+
+// writeFrameLocked writes a frame like writeFrame. c.mu must be locked.
+func (c *Conn) writeFrameLocked(op Opcode, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(op))
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch size := len(payload); {
+	case size <= 125:
+		frame = append(frame, maskBit|byte(size))
+	case size <= 0xffff:
+		frame = append(frame, maskBit|126, byte(size>>8), byte(size))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(size))
+	}
+
+	if !c.client {
+		frame = append(frame, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConn(t *testing.T) {
+	t.Parallel()
+
+	// the server echoes every message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Error("failed to upgrade, err =", err)
+			return
+		}
+		conn.MaxMessageSize = 16
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	dial := func() *Conn {
+		conn, err := Dial("ws" + strings.TrimPrefix(srv.URL, "http"))
+		if err != nil {
+			t.Fatal("failed to dial, err =", err)
+		}
+		conn.ReadTimeout = 5 * time.Second
+		return conn
+	}
+
+	conn := dial()
+	defer conn.Close(CloseNormal, "")
+
+	if err := conn.WriteMessage(OpText, []byte("hello")); err != nil {
+		t.Fatal("failed to write message, err =", err)
+	}
+	if op, data, err := conn.ReadMessage(); err != nil || op != OpText || string(data) != "hello" {
+		t.Errorf("unexpected echo, op = %d, data = %q, err = %v", op, data, err)
+	}
+
+	// a fragmented message with a ping in between
+	writeRawFrame(t, conn, false, OpBinary, "frag")
+	writeRawFrame(t, conn, true, OpPing, "hi")
+	writeRawFrame(t, conn, true, OpContinuation, "ment")
+	var pong [4]byte
+	if _, err := io.ReadFull(conn.br, pong[:]); err != nil || string(pong[:]) != "\x8a\x02hi" {
+		t.Errorf("unexpected pong, given = %q, err = %v", pong, err)
+	}
+	if op, data, err := conn.ReadMessage(); err != nil || op != OpBinary || string(data) != "fragment" {
+		t.Errorf("unexpected echo, op = %d, data = %q, err = %v", op, data, err)
+	}
+
+	// a text message split inside a rune
+	writeRawFrame(t, conn, false, OpText, "\xe3\x81")
+	writeRawFrame(t, conn, true, OpContinuation, "\x82")
+	if op, data, err := conn.ReadMessage(); err != nil || op != OpText || string(data) != "\u3042" {
+		t.Errorf("unexpected echo, op = %d, data = %q, err = %v", op, data, err)
+	}
+
+	// each case is frames a client sends, which the server must refuse with
+	// wantCode
+	for name, c := range map[string]struct {
+		frames   [][]byte
+		wantCode int
+	}{
+		"Invalid UTF-8":                  {frames: [][]byte{frame(0x80|byte(OpText), true, "\xff")}, wantCode: CloseInvalidPayload},
+		"Invalid UTF-8 across fragments": {frames: [][]byte{frame(byte(OpText), true, "ok\xe3\x81"), frame(0x80|byte(OpContinuation), true, "!")}, wantCode: CloseInvalidPayload},
+		"Too big":                        {frames: [][]byte{frame(0x80|byte(OpText), true, strings.Repeat("x", 17))}, wantCode: CloseMessageTooBig},
+		"Too big across fragments":       {frames: [][]byte{frame(byte(OpBinary), true, strings.Repeat("x", 10)), frame(0x80|byte(OpContinuation), true, strings.Repeat("x", 10))}, wantCode: CloseMessageTooBig},
+		// refused by the length alone, without waiting for the payload
+		"Too big by 16-bit length": {frames: [][]byte{{0x80 | byte(OpBinary), 0x80 | 126, 0x01, 0x00}}, wantCode: CloseMessageTooBig},
+		"Too big by 64-bit length": {frames: [][]byte{{0x80 | byte(OpBinary), 0x80 | 127, 0x80, 0, 0, 0, 0, 0, 0, 0}}, wantCode: CloseMessageTooBig},
+		"Fragmented ping":          {frames: [][]byte{frame(byte(OpPing), true, "hi")}, wantCode: CloseProtocolError},
+		"Fragmented close":         {frames: [][]byte{frame(byte(OpClose), true, "\x03\xe8")}, wantCode: CloseProtocolError},
+		"Too long ping":            {frames: [][]byte{frame(0x80|byte(OpPing), true, strings.Repeat("x", maxControlPayload+1))}, wantCode: CloseProtocolError},
+		"Too long close":           {frames: [][]byte{frame(0x80|byte(OpClose), true, "\x03\xe8"+strings.Repeat("x", maxControlPayload-1))}, wantCode: CloseProtocolError},
+		"Close with a byte":        {frames: [][]byte{frame(0x80|byte(OpClose), true, "\x03")}, wantCode: CloseProtocolError},
+		"Unmasked":                 {frames: [][]byte{frame(0x80|byte(OpText), false, "hello")}, wantCode: CloseProtocolError},
+		"Reserved bit 1":           {frames: [][]byte{frame(0x80|0x40|byte(OpText), true, "hello")}, wantCode: CloseProtocolError},
+		"Reserved bit 2":           {frames: [][]byte{frame(0x80|0x20|byte(OpText), true, "hello")}, wantCode: CloseProtocolError},
+		"Reserved bit 3":           {frames: [][]byte{frame(0x80|0x10|byte(OpText), true, "hello")}, wantCode: CloseProtocolError},
+		"Unknown opcode":           {frames: [][]byte{frame(0x80|0x3, true, "")}, wantCode: CloseProtocolError},
+		"Unknown control opcode":   {frames: [][]byte{frame(0x80|0xb, true, "")}, wantCode: CloseProtocolError},
+		"Stray continuation":       {frames: [][]byte{frame(0x80|byte(OpContinuation), true, "")}, wantCode: CloseProtocolError},
+		"Interrupted fragments":    {frames: [][]byte{frame(byte(OpText), true, "frag"), frame(0x80|byte(OpText), true, "ment")}, wantCode: CloseProtocolError},
+	} {
+		conn := dial()
+		for _, f := range c.frames {
+			if _, err := conn.conn.Write(f); err != nil {
+				t.Fatalf("%s: failed to write frame, err = %v", name, err)
+			}
+		}
+		_, _, err := conn.ReadMessage()
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != c.wantCode {
+			t.Errorf("%s: unexpected error, given = %v, expected code = %d", name, err, c.wantCode)
+		}
+		conn.Close(CloseNormal, "")
+	}
+}
+
+func TestConnClient(t *testing.T) {
+	t.Parallel()
+
+	// a server must not mask its frames
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := newConn(client, bufio.NewReader(client), true)
+	go server.Write(frame(0x80|byte(OpText), true, "hello"))
+	go io.Copy(io.Discard, server)
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseProtocolError {
+		t.Errorf("unexpected error, given = %v, expected code = %d", err, CloseProtocolError)
+	}
+}
+
+// writeRawFrame writes a frame of the client with the zero mask, which may be
+// one WriteMessage refuses to write.
+func writeRawFrame(t *testing.T, c *Conn, fin bool, op Opcode, payload string) {
+	t.Helper()
+
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	if _, err := c.conn.Write(frame(b0, true, payload)); err != nil {
+		t.Fatal("failed to write frame, err =", err)
+	}
+}
+
+// frame returns a frame of the first byte b0, which holds FIN, the reserved
+// bits and the opcode, and payload masked with the zero mask if masked.
+func frame(b0 byte, masked bool, payload string) []byte {
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	f := []byte{b0}
+	switch size := len(payload); {
+	case size <= 125:
+		f = append(f, maskBit|byte(size))
+	case size <= 0xffff:
+		f = append(f, maskBit|126, byte(size>>8), byte(size))
+	default:
+		f = append(f, maskBit|127, 0, 0, 0, 0, byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+	}
+	if masked {
+		f = append(f, 0, 0, 0, 0)
+	}
+	return append(f, payload...)
+}
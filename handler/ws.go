@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler/websocket"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A WSHandler implements the WebSocket endpoint. A client subscribes to the
+// changes of all TODOs or of projects, which are sent as events, and sends
+// commands creating, updating and deleting TODOs, each answered by an ack or
+// an error with the id of the command.
+type WSHandler struct {
+	svc  *service.TODOService
+	Path string
+	// PingInterval is how often a client is pinged. A client sending nothing
+	// for twice as long, not even a pong, is disconnected.
+	PingInterval time.Duration
+	// SendQueueSize is how many messages may wait to be written to a client.
+	// A client falling further behind on events is disconnected with 1013 to
+	// reconnect, and one not reading acks stops being read from.
+	SendQueueSize int
+	// WriteTimeout is how long writing a message to a client may take.
+	WriteTimeout time.Duration
+	// MaxMessageSize is the largest command in bytes.
+	MaxMessageSize int64
+	// Shutdown disconnects the clients with 1001 once closed, so that
+	// shutting down the server does not wait for them.
+	Shutdown <-chan struct{}
+	// Conns, if set, counts the connections being served. http.Server.Shutdown
+	// does not wait for them once hijacked, so the DB must not be closed
+	// before Conns is done.
+	Conns *sync.WaitGroup
+	// AllowedOrigins are the origins of the pages allowed to connect besides
+	// the same origin, or "*" for any origin. Browsers send cookies along
+	// with a WebSocket handshake from any page, and CORS does not apply to it,
+	// so the commands would be open to every site otherwise. Clients sending
+	// no Origin, which are not browsers, are always allowed.
+	AllowedOrigins []string
+}
+
+// NewWSHandler returns WSHandler based http.Handler.
+func NewWSHandler(svc *service.TODOService) *WSHandler {
+	return &WSHandler{
+		svc:            svc,
+		Path:           "/ws",
+		PingInterval:   30 * time.Second,
+		SendQueueSize:  64,
+		WriteTimeout:   10 * time.Second,
+		MaxMessageSize: 64 << 10,
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// counted before the upgrade, while the server still waits for the
+	// request, so that Conns is never added to once it is waited for
+	if h.Conns != nil {
+		h.Conns.Add(1)
+		defer h.Conns.Done()
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" && !h.allowsOrigin(origin, r.Host) {
+		writeProblem(w, r, &model.ProblemResponse{
+			Status: http.StatusForbidden,
+			Code:   model.ErrorCodeForbiddenOrigin,
+			Detail: fmt.Sprintf("origin %q is not allowed to connect", origin),
+		})
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		var handshake *websocket.HandshakeError
+		switch {
+		case errors.As(err, &handshake) && handshake.Status == http.StatusMethodNotAllowed:
+			writeMethodNotAllowed(w, r, http.MethodGet)
+		case errors.As(err, &handshake):
+			writeProblem(w, r, &model.ProblemResponse{
+				Status: handshake.Status,
+				Code:   model.ErrorCodeInvalidHandshake,
+				Detail: handshake.Reason,
+			})
+		default:
+			writeError(w, r, err)
+		}
+		return
+	}
+	conn.MaxMessageSize = h.MaxMessageSize
+	conn.ReadTimeout = 2 * h.PingInterval
+	conn.WriteTimeout = h.WriteTimeout
+
+	c := &wsClient{
+		h:        h,
+		conn:     conn,
+		r:        r,
+		send:     make(chan *model.WSMessage, h.SendQueueSize),
+		closing:  make(chan struct{}),
+		projects: make(map[int64]bool),
+	}
+	c.serve()
+}
+
+// allowsOrigin reports whether a page on origin may connect to host.
+func (h *WSHandler) allowsOrigin(origin, host string) bool {
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range h.AllowedOrigins {
+		if allowed == "*" || strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+
+	// the scheme is not compared, which a proxy in front may change
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, host)
+}
+
+// A wsClient serves a WebSocket connection. Its messages are written by
+// writeLoop only, while forwardEvents and readLoop queue them to send.
+type wsClient struct {
+	h    *WSHandler
+	conn *websocket.Conn
+	// r is the request which opened the connection.
+	r    *http.Request
+	send chan *model.WSMessage
+	// closing is closed once the connection starts closing.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// mu guards the subscriptions, where all is to all TODOs.
+	mu       sync.Mutex
+	all      bool
+	projects map[int64]bool
+}
+
+// serve serves the connection until it is closed.
+func (c *wsClient) serve() {
+	sub, _, _ := c.h.svc.Events().Subscribe(0, 0)
+	defer sub.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.writeLoop()
+	}()
+	go func() {
+		defer wg.Done()
+		c.forwardEvents(sub)
+	}()
+	c.readLoop()
+	wg.Wait()
+}
+
+// close closes the connection with code and reason, and stops serving it.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.conn.Close(code, reason)
+	})
+}
+
+// readLoop runs the commands of the client in order, queueing the answer of
+// each before reading the next one.
+func (c *wsClient) readLoop() {
+	for {
+		op, data, err := c.conn.ReadMessage()
+		if err != nil {
+			// the connection is gone, or has been closed already
+			c.close(websocket.CloseNormal, "")
+			return
+		}
+		if op != websocket.OpText {
+			c.close(websocket.CloseUnsupportedData, "messages must be JSON text")
+			return
+		}
+
+		answer := c.handle(data)
+		select {
+		case c.send <- answer:
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+// forwardEvents queues the events which the client subscribes to. Events are
+// never waited for, so a client too slow to take them is disconnected.
+func (c *wsClient) forwardEvents(sub *service.Subscription) {
+	for {
+		select {
+		case <-c.closing:
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				c.close(websocket.CloseTryAgainLater, "fell behind on events")
+				return
+			}
+			if !c.subscribed(e) {
+				continue
+			}
+			select {
+			case c.send <- &model.WSMessage{Type: model.WSEvent, Event: e}:
+			default:
+				c.close(websocket.CloseTryAgainLater, "fell behind on events")
+				return
+			}
+		}
+	}
+}
+
+// writeLoop writes the queued messages and pings the client.
+func (c *wsClient) writeLoop() {
+	ping := time.NewTicker(c.h.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-c.h.Shutdown:
+			c.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case m := <-c.send:
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Println(err)
+				c.close(websocket.CloseInternalError, "")
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.OpText, data); err != nil {
+				c.close(websocket.CloseTryAgainLater, "write timed out")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteMessage(websocket.OpPing, nil); err != nil {
+				c.close(websocket.CloseTryAgainLater, "write timed out")
+				return
+			}
+		}
+	}
+}
+
+// subscribed reports whether the client subscribes to e. A deletion does
+// not tell the project of the TODO, so it is sent to every subscriber.
+func (c *wsClient) subscribed(e *model.TODOEvent) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.all:
+		return true
+	case e.TODO == nil:
+		return len(c.projects) != 0
+	case e.TODO.ProjectID != nil:
+		return c.projects[*e.TODO.ProjectID]
+	default:
+		return false
+	}
+}
+
+// handle runs the command data, and returns its ack or error.
+func (c *wsClient) handle(data []byte) *model.WSMessage {
+	var cmd model.WSCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return c.problem("", invalidJSONProblem(err))
+	}
+
+	var (
+		todo *model.TODO
+		err  error
+	)
+	switch cmd.Type {
+	case model.WSSubscribe, model.WSUnsubscribe:
+		err = c.subscribe(&cmd)
+	case model.WSCreate:
+		var req model.CreateTODORequest
+		if err := decodeCommandTODO(&cmd, &req); err != nil {
+			return c.problem(cmd.ID, invalidJSONProblem(err))
+		}
+		todo, err = c.create(&req)
+	case model.WSUpdate:
+		var req model.UpdateTODORequest
+		if err := decodeCommandTODO(&cmd, &req); err != nil {
+			return c.problem(cmd.ID, invalidJSONProblem(err))
+		}
+		todo, err = c.update(&req, cmd.Version)
+	case model.WSDelete:
+		err = c.delete(&cmd)
+	default:
+		err = model.NewErrValidation("type", "must be one of subscribe, unsubscribe, create, update or delete")
+	}
+	if err != nil {
+		return c.problem(cmd.ID, problemFor(err))
+	}
+	return &model.WSMessage{Type: model.WSAck, ID: cmd.ID, TODO: todo}
+}
+
+// subscribe subscribes to or unsubscribes from the project of cmd, or all
+// TODOs without one. The project is not looked up, and an unknown one has no
+// events.
+func (c *wsClient) subscribe(cmd *model.WSCommand) error {
+	if cmd.ProjectID != nil && *cmd.ProjectID <= 0 {
+		return model.NewErrValidation("project_id", "must be 1 or more")
+	}
+	on := cmd.Type == model.WSSubscribe
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case cmd.ProjectID == nil:
+		c.all = on
+	case on:
+		c.projects[*cmd.ProjectID] = true
+	default:
+		delete(c.projects, *cmd.ProjectID)
+	}
+	return nil
+}
+
+// create creates a TODO, validating req the same as POST /todos.
+func (c *wsClient) create(req *model.CreateTODORequest) (*model.TODO, error) {
+	invalid := &model.ErrValidation{}
+	if len(req.Subject) == 0 {
+		invalid.Add("subject", "must not be empty")
+	}
+	dueAt := dueAtOption(req.DueAt, invalid)
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.h.svc.CreateTODO(c.r.Context(), req.Subject, req.Description, dueAt, service.WithTags(req.Tags), service.WithProject(req.ProjectID), service.WithPriority(req.Priority))
+}
+
+// update updates a TODO, validating req the same as PUT /todos. version is
+// the version expected like If-Match, or 0 for any.
+func (c *wsClient) update(req *model.UpdateTODORequest, version int64) (*model.TODO, error) {
+	invalid := &model.ErrValidation{}
+	if req.ID <= 0 {
+		invalid.Add("id", "must be 1 or more")
+	}
+	if len(req.Subject) == 0 {
+		invalid.Add("subject", "must not be empty")
+	}
+	if version < 0 {
+		invalid.Add("version", "must be 1 or more")
+	}
+	dueAt := dueAtOption(req.DueAt, invalid)
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.h.svc.UpdateTODO(c.r.Context(), req.ID, req.Subject, req.Description, dueAt, service.WithTags(req.Tags), service.WithProject(req.ProjectID), service.WithPriority(req.Priority), service.IfVersion(version))
+}
+
+// delete moves the TODOs of cmd to the trash, the same as DELETE /todos.
+func (c *wsClient) delete(cmd *model.WSCommand) error {
+	invalid := &model.ErrValidation{}
+	if len(cmd.IDs) == 0 {
+		invalid.Add("ids", "must not be empty")
+	}
+	switch {
+	case cmd.Version < 0:
+		invalid.Add("version", "must be 1 or more")
+	case cmd.Version != 0 && len(cmd.IDs) > 1:
+		invalid.Add("version", "must be given with a single id")
+	}
+	if err := invalid.Err(); err != nil {
+		return err
+	}
+
+	return c.h.svc.DeleteTODO(c.r.Context(), cmd.IDs, service.IfVersion(cmd.Version))
+}
+
+// problem returns the error answering the command by id with p.
+func (c *wsClient) problem(id string, p *model.ProblemResponse) *model.WSMessage {
+	fillProblem(c.r, p)
+	return &model.WSMessage{Type: model.WSError, ID: id, Error: p}
+}
+
+// decodeCommandTODO decodes the TODO of cmd into v, which is left empty to
+// fail validation without one.
+func decodeCommandTODO(cmd *model.WSCommand, v interface{}) error {
+	if len(cmd.TODO) == 0 {
+		return nil
+	}
+	return json.Unmarshal(cmd.TODO, v)
+}
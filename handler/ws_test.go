@@ -0,0 +1,282 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/handler/websocket"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+func TestWSHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	for _, name := range []string{"work", "home"} {
+		if _, err := service.NewProjectService(svc).CreateProject(ctx, name, ""); err != nil {
+			t.Fatal("failed to create project, err =", err)
+		}
+	}
+	h := handler.NewWSHandler(svc)
+	h.AllowedOrigins = []string{"https://app.example.com"}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dialWS(t, srv.URL)
+	defer conn.Close(websocket.CloseNormal, "")
+
+	// each case runs in order on the same connection
+	cases := []struct {
+		name    string
+		command string
+		// want is the ack or the error code answering the command, followed
+		// by the events caused in order, each as type:todo_id
+		want []string
+	}{
+		{name: "Subscribe to project", command: `{"id":"1","type":"subscribe","project_id":1}`, want: []string{"ack"}},
+		{name: "Create todo in project", command: `{"id":"2","type":"create","todo":{"subject":"first","project_id":1}}`, want: []string{"ack", "todo.created:1"}},
+		{name: "Create todo in another project", command: `{"id":"3","type":"create","todo":{"subject":"second","project_id":2}}`, want: []string{"ack"}},
+		{name: "Update todo", command: `{"id":"4","type":"update","todo":{"id":1,"subject":"first!","project_id":1},"version":1}`, want: []string{"ack", "todo.updated:1"}},
+		{name: "Update todo of stale version", command: `{"id":"5","type":"update","todo":{"id":1,"subject":"first?"},"version":1}`, want: []string{"precondition_failed"}},
+		{name: "Update missing todo", command: `{"id":"6","type":"update","todo":{"id":99,"subject":"none"}}`, want: []string{"not_found"}},
+		{name: "Create empty todo", command: `{"id":"7","type":"create","todo":{"subject":""}}`, want: []string{"validation_failed"}},
+		{name: "Create without todo", command: `{"id":"8","type":"create"}`, want: []string{"validation_failed"}},
+		{name: "Create invalid todo", command: `{"id":"9","type":"create","todo":{"subject":1}}`, want: []string{"invalid_json"}},
+		{name: "Invalid JSON", command: `{"id":`, want: []string{"invalid_json"}},
+		{name: "Unknown type", command: `{"id":"10","type":"read"}`, want: []string{"validation_failed"}},
+		{name: "Subscribe to invalid project", command: `{"id":"11","type":"subscribe","project_id":0}`, want: []string{"validation_failed"}},
+		{name: "Delete todos with version", command: `{"id":"12","type":"delete","ids":[1,2],"version":2}`, want: []string{"validation_failed"}},
+		{name: "Delete todo", command: `{"id":"13","type":"delete","ids":[1]}`, want: []string{"ack", "todo.deleted:1"}},
+		{name: "Unsubscribe from project", command: `{"id":"14","type":"unsubscribe","project_id":1}`, want: []string{"ack"}},
+		{name: "Create todo after unsubscribing", command: `{"id":"15","type":"create","todo":{"subject":"third","project_id":1}}`, want: []string{"ack"}},
+		{name: "Subscribe to all", command: `{"id":"16","type":"subscribe"}`, want: []string{"ack"}},
+		{name: "Create todo without project", command: `{"id":"17","type":"create","todo":{"subject":"fourth"}}`, want: []string{"ack", "todo.created:4"}},
+	}
+
+	for _, c := range cases {
+		if err := conn.WriteMessage(websocket.OpText, []byte(c.command)); err != nil {
+			t.Fatalf("%s: failed to send command, err = %v", c.name, err)
+		}
+
+		// the ack may come before or after the events of the command
+		var (
+			answer *model.WSMessage
+			events []string
+		)
+		for i := 0; i < len(c.want); i++ {
+			m := readWSMessage(t, conn)
+			if m.Type == model.WSEvent {
+				events = append(events, fmt.Sprintf("%s:%d", m.Event.Type, m.Event.TODOID))
+				continue
+			}
+			if answer != nil {
+				t.Fatalf("%s: unexpected second answer, given = %+v", c.name, m)
+			}
+			answer = m
+		}
+		if answer == nil {
+			t.Fatalf("%s: no answer, events = %v", c.name, events)
+		}
+
+		var id struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal([]byte(c.command), &id)
+		if answer.ID != id.ID {
+			t.Errorf("%s: unexpected answer id, given = %q, expected = %q", c.name, answer.ID, id.ID)
+		}
+		given := string(answer.Type)
+		if answer.Type == model.WSError {
+			given = string(answer.Error.Code)
+			if answer.Error.Instance != "/" {
+				t.Errorf("%s: unexpected error instance, given = %q", c.name, answer.Error.Instance)
+			}
+		}
+		if given != c.want[0] {
+			t.Errorf("%s: unexpected answer, given = %s, expected = %s", c.name, given, c.want[0])
+		}
+		if strings.Join(events, " ") != strings.Join(c.want[1:], " ") {
+			t.Errorf("%s: unexpected events, given = %v, expected = %v", c.name, events, c.want[1:])
+		}
+		if c.name == "Create todo in project" && (answer.TODO == nil || answer.TODO.Subject != "first") {
+			t.Errorf("%s: unexpected todo, given = %+v", c.name, answer.TODO)
+		}
+	}
+
+	// handshake returns the headers of a valid handshake from a page on origin.
+	handshake := func(origin string) http.Header {
+		return http.Header{
+			"Connection":            {"Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+			"Origin":                {origin},
+		}
+	}
+	for name, c := range map[string]struct {
+		method     string
+		header     http.Header
+		wantStatus int
+	}{
+		"Same origin":     {method: http.MethodGet, header: handshake(srv.URL), wantStatus: http.StatusSwitchingProtocols},
+		"Allowed origin":  {method: http.MethodGet, header: handshake("https://app.example.com/"), wantStatus: http.StatusSwitchingProtocols},
+		"Foreign origin":  {method: http.MethodGet, header: handshake("https://evil.example.com"), wantStatus: http.StatusForbidden},
+		"Not upgrading":   {method: http.MethodGet, wantStatus: http.StatusUpgradeRequired},
+		"Unknown version": {method: http.MethodGet, header: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}}, wantStatus: http.StatusUpgradeRequired},
+		"Post":            {method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(c.method, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range c.header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: failed to request, err = %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.wantStatus {
+			t.Errorf("%s: unexpected status, given = %d, expected = %d", name, resp.StatusCode, c.wantStatus)
+		}
+	}
+}
+
+func TestWSHandlerSlowClient(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	h := handler.NewWSHandler(svc)
+	h.SendQueueSize = 1
+	served := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(served)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	conn := dialWS(t, srv.URL)
+	defer conn.Close(websocket.CloseNormal, "")
+	if err := conn.WriteMessage(websocket.OpText, []byte(`{"id":"1","type":"subscribe"}`)); err != nil {
+		t.Fatal("failed to subscribe, err =", err)
+	}
+	if m := readWSMessage(t, conn); m.Type != model.WSAck {
+		t.Fatalf("unexpected answer, given = %+v", m)
+	}
+
+	// more events than the socket buffers hold, while the client reads none
+	description := strings.Repeat("x", 64<<10)
+	for i := 0; i < 200; i++ {
+		if _, err := svc.CreateTODO(context.Background(), "flood", description); err != nil {
+			t.Fatal("failed to create todo, err =", err)
+		}
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow client was not disconnected")
+	}
+
+	// the client finds the connection closed after the events written
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseTryAgainLater {
+			t.Errorf("unexpected close, given = %v", closeErr)
+		}
+		break
+	}
+}
+
+func TestWSHandlerShutdown(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewTODOService(repository.NewMemoryTODORepository())
+	h := handler.NewWSHandler(svc)
+	shutdown := make(chan struct{})
+	h.Shutdown = shutdown
+	var conns sync.WaitGroup
+	h.Conns = &conns
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dialWS(t, srv.URL)
+	defer conn.Close(websocket.CloseNormal, "")
+	if err := conn.WriteMessage(websocket.OpText, []byte(`{"id":"1","type":"subscribe"}`)); err != nil {
+		t.Fatal("failed to subscribe, err =", err)
+	}
+	if m := readWSMessage(t, conn); m.Type != model.WSAck {
+		t.Fatalf("unexpected answer, given = %+v", m)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		conns.Wait()
+	}()
+	select {
+	case <-waited:
+		t.Fatal("connection was not counted while served")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(shutdown)
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("unexpected close, given = %v", err)
+	}
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was still counted after shutdown")
+	}
+}
+
+// dialWS connects to the WebSocket server at the http URL of srvURL.
+func dialWS(t *testing.T, srvURL string) *websocket.Conn {
+	t.Helper()
+
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(srvURL, "http"))
+	if err != nil {
+		t.Fatal("failed to dial, err =", err)
+	}
+	conn.ReadTimeout = 5 * time.Second
+	return conn
+}
+
+// readWSMessage reads a message sent by the server.
+func readWSMessage(t *testing.T, conn *websocket.Conn) *model.WSMessage {
+	t.Helper()
+
+	op, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal("failed to read message, err =", err)
+	}
+	if op != websocket.OpText {
+		t.Fatalf("unexpected opcode, given = %d", op)
+	}
+	var m model.WSMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal("failed to decode message, err =", err)
+	}
+	return &m
+}
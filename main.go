@@ -1,13 +1,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/TechBowl-japan/go-stations/config"
 	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
 	"github.com/TechBowl-japan/go-stations/handler/router"
+	"github.com/TechBowl-japan/go-stations/metrics"
+	"github.com/TechBowl-japan/go-stations/repository"
+	"github.com/TechBowl-japan/go-stations/service"
 )
 
 func main() {
@@ -17,42 +31,195 @@ func main() {
 	}
 }
 
-func realMain() error {
-	// config values
-	const (
-		defaultPort   = ":8080"
-		defaultDBPath = ".sqlite3/todo.db"
-	)
+func realMain() (err error) {
+	migrateStatus := flag.Bool("migrate-status", false, "print the migration status of the database and exit")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "try pending migrations in a rolled back transaction and exit")
+	printConfig := flag.Bool("print-config", false, "print the effective config as JSON with the secrets redacted and exit")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	// config values
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.Getenv)
+	if err != nil {
+		return err
 	}
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = defaultDBPath
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		// the cursor secret would let the readers forge cursors
+		return encoder.Encode(cfg.Redacted())
 	}
 
 	// set time zone
-	var err error
-	time.Local, err = time.LoadLocation("Asia/Tokyo")
+	time.Local, err = time.LoadLocation(cfg.Timezone)
 	if err != nil {
 		return err
 	}
 
+	if *migrateStatus || *migrateDryRun {
+		return runMigrationCommand(cfg.DBPath, *migrateDryRun)
+	}
+
 	// set up sqlite3
-	todoDB, err := db.NewDB(dbPath)
+	todoDB, err := db.NewDB(cfg.DBPath)
 	if err != nil {
 		return err
 	}
-	defer todoDB.Close()
+	// NOTE: the server and the WebSocket connections, which it does not
+	// track, are drained before this runs, so nothing can still be using the DB.
+	defer func() {
+		if cerr := todoDB.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// purge the trash in background, which must stop before the DB is closed
+	if cfg.TrashRetention > 0 {
+		purgeDone := make(chan struct{})
+		defer func() {
+			stop()
+			<-purgeDone
+		}()
+		go func() {
+			defer close(purgeDone)
+			todoService := service.NewTODOService(repository.NewSQLiteTODORepository(todoDB))
+			todoService.PurgeTrashEvery(ctx, time.Duration(cfg.PurgeInterval), time.Duration(cfg.TrashRetention))
+		}()
+	}
+
+	// deliver the webhooks in background, which must stop before the DB is
+	// closed too
+	if cfg.WebhookInterval > 0 {
+		webhookDone := make(chan struct{})
+		defer func() {
+			stop()
+			<-webhookDone
+		}()
+		go func() {
+			defer close(webhookDone)
+			webhookService := service.NewWebhookService(repository.NewSQLiteTODORepository(todoDB))
+			webhookService.DeliverWebhooksEvery(ctx, time.Duration(cfg.WebhookInterval))
+		}()
+	}
+
+	// the WebSocket connections are closed once ctx is done, and must be
+	// waited for before the DB is closed
+	var wsConns sync.WaitGroup
+	defer func() {
+		stop()
+		wsConns.Wait()
+	}()
 
 	// NOTE: 新しいエンドポイントの登録はrouter.NewRouterの内部で行うようにする
-	mux := router.NewRouter(todoDB)
+	httpMetrics := metrics.NewHTTP()
+	mux := router.NewRouter(todoDB,
+		router.WithShutdown(ctx.Done()),
+		router.WithHTTPMetrics(httpMetrics),
+		router.WithPageSize(cfg.DefaultPageSize, cfg.MaxPageSize),
+		router.WithCursorKey([]byte(cfg.CursorSecret)),
+		router.WithAllowedOrigins(cfg.CORSOrigins),
+		router.WithWSConns(&wsConns),
+	)
+
+	accessLog := io.Discard
+	if cfg.LogsAt(config.LogLevelInfo) {
+		accessLog = os.Stdout
+	}
+
+	srv := &http.Server{
+		Addr: cfg.Addr,
+		Handler: middleware.Chain(mux,
+			middleware.RequestID,
+			middleware.AccessLog(accessLog),
+			middleware.CORS(cfg.CORSOrigins),
+			middleware.Recover(nil, httpMetrics.Panic),
+		),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.IdleTimeout),
+	}
+
+	return serve(ctx, srv, time.Duration(cfg.ShutdownDelay), time.Duration(cfg.ShutdownTimeout))
+}
+
+// serve runs srv until ctx is cancelled. Then it keeps serving for delay while
+// the readiness check fails, so that load balancers stop sending requests,
+// stops accepting new connections and waits up to timeout for in-flight
+// requests to finish.
+func serve(ctx context.Context, srv *http.Server, delay, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		// the listener failed before any shutdown was requested
+		return err
+	case <-ctx.Done():
+	}
 
-	// TODO: サーバーをlistenする
-	http.ListenAndServe(port, mux)
+	if delay > 0 {
+		log.Println("main: shutdown requested, draining for", delay)
+		select {
+		case err := <-errCh:
+			return err
+		case <-time.After(delay):
+		}
+	}
+
+	log.Println("main: shutting down, waiting for in-flight requests up to", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// the deadline passed, so cut the remaining connections
+		if cerr := srv.Close(); cerr != nil {
+			log.Println("main: failed to close server, err =", cerr)
+		}
+		return err
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// runMigrationCommand prints the migration status of the database at dbPath.
+// If dryRun is true, it also checks that the pending migrations apply cleanly.
+func runMigrationCommand(dbPath string, dryRun bool) (err error) {
+	todoDB, err := db.OpenDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := todoDB.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	var status *db.MigrationStatus
+	if dryRun {
+		status, err = db.Migrate(context.Background(), todoDB, true)
+	} else {
+		status, err = db.Status(context.Background(), todoDB)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("current version: %d, latest version: %d\n", status.Current, status.Latest)
+	for _, m := range status.Pending {
+		fmt.Printf("pending: %04d_%s\n", m.Version, m.Name)
+	}
+	if dryRun && len(status.Pending) != 0 {
+		fmt.Println("dry run: all pending migrations applied cleanly and were rolled back")
+	}
 
 	return nil
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// hold is how long the request in flight takes
+		hold    time.Duration
+		delay   time.Duration
+		timeout time.Duration
+		// wantLate tells whether a request made after the shutdown signal is
+		// still served
+		wantLate bool
+		wantErr  error
+	}{
+		"Drained":   {hold: 200 * time.Millisecond, timeout: 5 * time.Second},
+		"Delayed":   {hold: 200 * time.Millisecond, delay: 100 * time.Millisecond, timeout: 5 * time.Second, wantLate: true},
+		"Timed out": {hold: 2 * time.Second, timeout: 100 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			addr := freeAddr(t)
+			started := make(chan struct{})
+			var startOnce sync.Once
+			srv := &http.Server{
+				Addr: addr,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path == "/late" {
+						io.WriteString(w, "late")
+						return
+					}
+					startOnce.Do(func() { close(started) })
+					select {
+					case <-time.After(c.hold):
+					case <-r.Context().Done():
+						return
+					}
+					io.WriteString(w, "done")
+				}),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- serve(ctx, srv, c.delay, c.timeout)
+			}()
+
+			bodyCh := make(chan string, 1)
+			go func() {
+				body, _ := get("http://"+addr+"/", true)
+				bodyCh <- body
+			}()
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("request was not served")
+			}
+
+			cancel()
+			if c.wantLate {
+				if body, err := get("http://"+addr+"/late", false); err != nil || body != "late" {
+					t.Errorf("request during the delay was not served, body = %q, err = %v", body, err)
+				}
+			}
+
+			select {
+			case err := <-errCh:
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("unexpected error, given = %v, expected = %v", err, c.wantErr)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("serve did not return")
+			}
+
+			body := <-bodyCh
+			if c.wantErr == nil && body != "done" {
+				t.Errorf("request in flight was not drained, body = %q", body)
+			}
+			if c.wantErr != nil && body == "done" {
+				t.Errorf("request in flight was not cut, body = %q", body)
+			}
+			if _, err := get("http://"+addr+"/late", false); err == nil {
+				t.Error("request after shutdown was served")
+			}
+		})
+	}
+}
+
+// freeAddr returns a local TCP address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen, err =", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get requests url without keep-alive and returns the body. If retry is true,
+// it retries until the server listens.
+func get(url string, retry bool) (string, error) {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for i := 0; ; i++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			if retry && i < 100 {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import "database/sql"
+
+// WriteDBStats writes the connection pool statistics of database/sql to w.
+func WriteDBStats(w *Writer, stats sql.DBStats) {
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"db_max_open_connections", "Maximum number of open connections to the database.", float64(stats.MaxOpenConnections)},
+		{"db_open_connections", "Number of established connections both in use and idle.", float64(stats.OpenConnections)},
+		{"db_in_use_connections", "Number of connections currently in use.", float64(stats.InUse)},
+		{"db_idle_connections", "Number of idle connections.", float64(stats.Idle)},
+	}
+	for _, g := range gauges {
+		w.Header(g.name, TypeGauge, g.help)
+		w.Sample(g.name, nil, g.value)
+	}
+
+	counters := []struct {
+		name, help string
+		value      float64
+	}{
+		{"db_wait_count_total", "Total number of connections waited for.", float64(stats.WaitCount)},
+		{"db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", stats.WaitDuration.Seconds()},
+		{"db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", float64(stats.MaxIdleClosed)},
+		{"db_max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime.", float64(stats.MaxIdleTimeClosed)},
+		{"db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", float64(stats.MaxLifetimeClosed)},
+	}
+	for _, c := range counters {
+		w.Header(c.name, TypeCounter, c.help)
+		w.Sample(c.name, nil, c.value)
+	}
+}
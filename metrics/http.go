@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram,
+// the same as the default of the Prometheus client libraries.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HTTP collects request counts and latencies per route and method, and the
+// number of recovered panics.
+type HTTP struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[routeKey]*histogram
+	panics    uint64
+}
+
+type routeKey struct {
+	route, method string
+}
+
+type requestKey struct {
+	routeKey
+	code int
+}
+
+type histogram struct {
+	counts []uint64 // cumulative counts are computed on write
+	count  uint64
+	sum    float64
+}
+
+// NewHTTP returns new HTTP with DefaultBuckets.
+func NewHTTP() *HTTP {
+	return &HTTP{
+		buckets:   DefaultBuckets,
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[routeKey]*histogram),
+	}
+}
+
+// Observe records a request to route which was responded with code in d.
+func (m *HTTP) Observe(route, method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rk := routeKey{route: route, method: method}
+	m.requests[requestKey{routeKey: rk, code: code}]++
+
+	h, ok := m.durations[rk]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[rk] = h
+	}
+	seconds := d.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Count records a request to route which was responded with code, leaving its
+// duration out of the latency histogram.
+func (m *HTTP) Count(route, method string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{routeKey: routeKey{route: route, method: method}, code: code}]++
+}
+
+// Panic records a panic recovered while serving a request.
+func (m *HTTP) Panic() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.panics++
+}
+
+// routeContextKey is the context key of the route label Instrument records,
+// which SetRoute replaces.
+type routeContextKey struct{}
+
+// SetRoute replaces the route r is recorded as by Instrument or
+// InstrumentStream, for a handler which tells the sub-routes of a prefix
+// apart, like /todos/{id}/done under /todos/{id}. It does nothing to a request
+// which is not instrumented.
+func SetRoute(r *http.Request, route string) {
+	if p, ok := r.Context().Value(routeContextKey{}).(*string); ok {
+		*p = route
+	}
+}
+
+// withRoute returns r with a route label SetRoute can replace.
+func withRoute(r *http.Request, route *string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey{}, route))
+}
+
+// Instrument returns http.Handler which records every request to next as
+// route, or as the route next sets by SetRoute. route should be a pattern like
+// /todos/{id} rather than the actual path, to keep the number of label values
+// bounded. A request whose handler
+// panics before writing anything is recorded as 500 Internal Server Error,
+// which is what the Recover middleware outside responds, and the panic goes
+// on.
+func (m *HTTP) Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		start := time.Now()
+		label := route
+		returned := false
+		defer func() {
+			m.Observe(label, r.Method, sw.result(returned), time.Since(start))
+		}()
+		next.ServeHTTP(sw, withRoute(r, &label))
+		returned = true
+	})
+}
+
+// InstrumentStream is Instrument for a streaming route, like Server-Sent
+// Events or WebSocket, whose requests last as long as the clients stay. Only
+// the requests are counted, since their durations would skew the latency
+// histogram.
+func (m *HTTP) InstrumentStream(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		label := route
+		returned := false
+		defer func() {
+			m.Count(label, r.Method, sw.result(returned))
+		}()
+		next.ServeHTTP(sw, withRoute(r, &label))
+		returned = true
+	})
+}
+
+// Write writes the collected metrics to w.
+func (m *HTTP) Write(w *Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.routeKey != b.routeKey {
+			return a.routeKey.less(b.routeKey)
+		}
+		return a.code < b.code
+	})
+
+	w.Header("http_requests_total", TypeCounter, "Total number of HTTP requests by route, method and status code.")
+	for _, k := range requestKeys {
+		w.Sample("http_requests_total", Labels{"route": k.route, "method": k.method, "code": strconv.Itoa(k.code)}, float64(m.requests[k]))
+	}
+
+	routeKeys := make([]routeKey, 0, len(m.durations))
+	for k := range m.durations {
+		routeKeys = append(routeKeys, k)
+	}
+	sort.Slice(routeKeys, func(i, j int) bool {
+		return routeKeys[i].less(routeKeys[j])
+	})
+
+	w.Header("http_request_duration_seconds", TypeHistogram, "Latency of HTTP requests by route and method.")
+	for _, k := range routeKeys {
+		h := m.durations[k]
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += h.counts[i]
+			w.Sample("http_request_duration_seconds_bucket", Labels{"route": k.route, "method": k.method, "le": formatValue(le)}, float64(cumulative))
+		}
+		w.Sample("http_request_duration_seconds_bucket", Labels{"route": k.route, "method": k.method, "le": formatValue(math.Inf(1))}, float64(h.count))
+		w.Sample("http_request_duration_seconds_sum", Labels{"route": k.route, "method": k.method}, h.sum)
+		w.Sample("http_request_duration_seconds_count", Labels{"route": k.route, "method": k.method}, float64(h.count))
+	}
+
+	w.Header("http_panics_total", TypeCounter, "Total number of panics recovered while serving HTTP requests.")
+	w.Sample("http_panics_total", nil, float64(m.panics))
+}
+
+func (k routeKey) less(o routeKey) bool {
+	if k.route != o.route {
+		return k.route < o.route
+	}
+	return k.method < o.method
+}
+
+// A statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher interface if the underlying writer does.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker interface if the underlying writer does.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("metrics: response writer does not implement http.Hijacker")
+	}
+	if w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// result returns the status code to record for a request, where returned
+// tells whether the handler returned rather than panicked.
+func (w *statusWriter) result(returned bool) int {
+	if !returned && w.code == 0 {
+		return http.StatusInternalServerError
+	}
+	return w.status()
+}
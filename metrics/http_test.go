@@ -0,0 +1,113 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/metrics"
+)
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.NewHTTP()
+	h := m.Instrument("/todos/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/todos/1" {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+
+	done := m.Instrument("/todos/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.SetRoute(r, "/todos/{id}/done")
+		w.Write([]byte("ok"))
+	}))
+	done.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/todos/1/done", nil))
+	// not instrumented, so nothing to do
+	metrics.SetRoute(httptest.NewRequest(http.MethodGet, "/", nil), "/")
+
+	for _, path := range []string{"/todos/1", "/todos/1", "/todos/2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	stream := m.InstrumentStream("/todos/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {}\n\n"))
+	}))
+	stream.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/todos/events", nil))
+	panicky := m.Instrument("/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("panic did not go on, recovered = %v", v)
+			}
+		}()
+		panicky.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/panic", nil))
+	}()
+	m.Observe("/slow", http.MethodPost, http.StatusOK, 3*time.Second)
+	m.Panic()
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	m.Write(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal("failed to write metrics, err =", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{code="200",method="GET",route="/todos/{id}"} 2` + "\n",
+		`http_requests_total{code="404",method="GET",route="/todos/{id}"} 1` + "\n",
+		`http_requests_total{code="200",method="PUT",route="/todos/{id}/done"} 1` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		`http_requests_total{code="200",method="GET",route="/todos/events"} 1` + "\n",
+		`http_request_duration_seconds_count{method="GET",route="/todos/{id}"} 3` + "\n",
+		`http_request_duration_seconds_bucket{le="2.5",method="POST",route="/slow"} 0` + "\n",
+		`http_request_duration_seconds_bucket{le="5",method="POST",route="/slow"} 1` + "\n",
+		`http_request_duration_seconds_bucket{le="+Inf",method="POST",route="/slow"} 1` + "\n",
+		`http_request_duration_seconds_sum{method="POST",route="/slow"} 3` + "\n",
+		`http_requests_total{code="500",method="DELETE",route="/panic"} 1` + "\n",
+		`http_request_duration_seconds_count{method="DELETE",route="/panic"} 1` + "\n",
+		"# TYPE http_panics_total counter\nhttp_panics_total 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing line, expected = %q, given =\n%s", want, got)
+		}
+	}
+	// the route set by the handler replaces the one given to Instrument
+	if unwanted := `method="PUT",route="/todos/{id}"}`; strings.Contains(got, unwanted) {
+		t.Errorf("unexpected line, given = %q", unwanted)
+	}
+	// streams are left out of the latency histogram
+	if unwanted := `http_request_duration_seconds_count{method="GET",route="/todos/events"}`; strings.Contains(got, unwanted) {
+		t.Errorf("unexpected line, given = %q", unwanted)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	w.Header("escaped", metrics.TypeGauge, "Help with \\ and\nnewline.")
+	w.Sample("escaped", metrics.Labels{"b": "quote \" here", "a": "back\\slash"}, 1.5)
+	w.Sample("escaped", nil, 2)
+	if err := w.Flush(); err != nil {
+		t.Fatal("failed to write metrics, err =", err)
+	}
+
+	want := `# HELP escaped Help with \\ and\nnewline.
+# TYPE escaped gauge
+escaped{a="back\\slash",b="quote \" here"} 1.5
+escaped 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output, given =\n%s\nexpected =\n%s", got, want)
+	}
+}
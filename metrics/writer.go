@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the Prometheus text exposition format.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// ContentType is the Content-Type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A Labels expresses the labels of a sample.
+type Labels map[string]string
+
+// A Writer writes metrics in the Prometheus text exposition format.
+// Errors are sticky and returned by Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns new Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Header writes the HELP and TYPE lines of a metric family.
+func (w *Writer) Header(name, typ, help string) {
+	w.printf("# HELP %s %s\n", name, escapeHelp(help))
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+// Sample writes a sample line.
+func (w *Writer) Sample(name string, labels Labels, value float64) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Flush writes any buffered data and returns the first error.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// formatLabels formats labels sorted by name, like {code="200",method="GET"}.
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(labels[name]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// A ChecklistItem expresses a step of a TODO. The items of a TODO are
+	// ordered by Position, which counts from 0.
+	ChecklistItem struct {
+		ID        int64     `json:"id"`
+		Text      string    `json:"text"`
+		Done      bool      `json:"done"`
+		Position  int       `json:"position"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	// A ChecklistItemPatch expresses a partial update of a ChecklistItem. Nil
+	// fields are left unchanged.
+	ChecklistItemPatch struct {
+		Text *string
+		Done *bool
+	}
+
+	// A TODOProgress expresses how many items of the checklist of a TODO are
+	// done.
+	TODOProgress struct {
+		Done  int `json:"done"`
+		Total int `json:"total"`
+	}
+
+	// A CreateChecklistItemRequest expresses ...
+	CreateChecklistItemRequest struct {
+		Text string `json:"text"`
+		Done bool   `json:"done"`
+		// Position inserts the item before the item at it. Nil appends it.
+		Position *int `json:"position"`
+	}
+	// A CreateChecklistItemResponse expresses ...
+	CreateChecklistItemResponse struct {
+		Item ChecklistItem `json:"item"`
+	}
+
+	// A ReadChecklistResponse expresses ...
+	ReadChecklistResponse struct {
+		Checklist []*ChecklistItem `json:"checklist"`
+		Progress  TODOProgress     `json:"progress"`
+	}
+
+	// A UpdateChecklistItemRequest expresses ...
+	UpdateChecklistItemRequest struct {
+		Text *string `json:"text"`
+		Done *bool   `json:"done"`
+	}
+	// A UpdateChecklistItemResponse expresses ...
+	UpdateChecklistItemResponse struct {
+		Item ChecklistItem `json:"item"`
+	}
+
+	// A DeleteChecklistItemResponse expresses ...
+	DeleteChecklistItemResponse struct{}
+
+	// A ReorderChecklistRequest expresses ...
+	ReorderChecklistRequest struct {
+		IDs []int64 `json:"ids"`
+	}
+)
+
+// String returns the progress like "3/5 done".
+func (p TODOProgress) String() string {
+	return fmt.Sprintf("%d/%d done", p.Done, p.Total)
+}
@@ -2,14 +2,122 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
+// ErrorCode values. They are a part of the API, so never change existing ones.
+const (
+	ErrorCodeInvalidJSON         ErrorCode = "invalid_json"
+	ErrorCodeValidationFailed    ErrorCode = "validation_failed"
+	ErrorCodeNotFound            ErrorCode = "not_found"
+	ErrorCodeMethodNotAllowed    ErrorCode = "method_not_allowed"
+	ErrorCodeConstraintViolation ErrorCode = "constraint_violation"
+	ErrorCodeDatabaseUnavailable ErrorCode = "database_unavailable"
+	ErrorCodeTimeout             ErrorCode = "timeout"
+	ErrorCodeInternal            ErrorCode = "internal_error"
+	ErrorCodePreconditionFailed  ErrorCode = "precondition_failed"
+	ErrorCodeConflict            ErrorCode = "conflict"
+	ErrorCodeUnsupportedMedia    ErrorCode = "unsupported_media_type"
+	ErrorCodeInvalidHandshake    ErrorCode = "invalid_handshake"
+	ErrorCodeForbiddenOrigin     ErrorCode = "forbidden_origin"
+)
+
+type (
+	// An ErrorCode expresses a machine-readable kind of error.
+	ErrorCode string
+
+	// A ProblemResponse expresses an error response in the format of
+	// RFC 7807 (application/problem+json).
+	ProblemResponse struct {
+		Type          string         `json:"type"`
+		Title         string         `json:"title"`
+		Status        int            `json:"status"`
+		Detail        string         `json:"detail,omitempty"`
+		Instance      string         `json:"instance,omitempty"`
+		Code          ErrorCode      `json:"code"`
+		RequestID     string         `json:"request_id,omitempty"`
+		InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	}
+
+	// An InvalidParam expresses why a field of a request is invalid.
+	InvalidParam struct {
+		Name   string `json:"name"`
+		Reason string `json:"reason"`
+	}
+)
+
+// A Resource is the kind of resource an ErrNotFound is about.
+type Resource string
+
+// Resources an ErrNotFound can be about.
+const (
+	ResourceTODO            Resource = "todo"
+	ResourceTag             Resource = "tag"
+	ResourceProject         Resource = "project"
+	ResourceChecklistItem   Resource = "checklist_item"
+	ResourceWebhook         Resource = "webhook"
+	ResourceWebhookDelivery Resource = "webhook_delivery"
+)
+
 type ErrNotFound struct {
 	When time.Time
 	What string
+	// Resource is the kind of the resource not found, ResourceTODO if empty.
+	Resource Resource
 }
 
 func (e *ErrNotFound) Error() string {
 	return fmt.Sprintf("at %v, %s", e.When, e.What)
 }
+
+// An ErrPreconditionFailed expresses that a TODO was changed since the version
+// a conditional request expected.
+type ErrPreconditionFailed struct {
+	ID int64
+}
+
+func (e *ErrPreconditionFailed) Error() string {
+	return fmt.Sprintf("todo %d was changed since the expected version", e.ID)
+}
+
+// An ErrConflict expresses that a request cannot be applied to the current
+// state of a TODO, like a JSON Patch whose test operation fails.
+type ErrConflict struct {
+	What string
+}
+
+func (e *ErrConflict) Error() string {
+	return e.What
+}
+
+// An ErrValidation expresses that some fields of a request are invalid.
+type ErrValidation struct {
+	Params []InvalidParam
+}
+
+// NewErrValidation returns ErrValidation with a single invalid field.
+func NewErrValidation(name, reason string) *ErrValidation {
+	return &ErrValidation{Params: []InvalidParam{{Name: name, Reason: reason}}}
+}
+
+// Add appends an invalid field to e.
+func (e *ErrValidation) Add(name, reason string) {
+	e.Params = append(e.Params, InvalidParam{Name: name, Reason: reason})
+}
+
+// Err returns e if it has any invalid fields, or nil.
+func (e *ErrValidation) Err() error {
+	if len(e.Params) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ErrValidation) Error() string {
+	reasons := make([]string, len(e.Params))
+	for i, p := range e.Params {
+		reasons[i] = p.Name + ": " + p.Reason
+	}
+	return "validation failed: " + strings.Join(reasons, ", ")
+}
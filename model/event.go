@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// TODOEventType values.
+const (
+	TODOEventCreated TODOEventType = "todo.created"
+	TODOEventUpdated TODOEventType = "todo.updated"
+	TODOEventDeleted TODOEventType = "todo.deleted"
+)
+
+type (
+	// A TODOEventType expresses how a TODO was changed.
+	TODOEventType string
+
+	// A TODOEvent expresses a change of a TODO made through TODOService.
+	TODOEvent struct {
+		// ID increases by 1 with every event published in the process.
+		ID     int64         `json:"id"`
+		Type   TODOEventType `json:"type"`
+		TODOID int64         `json:"todo_id"`
+		// TODO is the TODO after the change, or nil when it was deleted.
+		TODO *TODO     `json:"todo,omitempty"`
+		At   time.Time `json:"at"`
+	}
+)
@@ -1,6 +1,35 @@
 package model
 
+// Health statuses.
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFailed       = "failed"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
 // A HealthzResponse expresses health check message.
 type HealthzResponse struct {
 	Message string `json:"message"`
 }
+
+type (
+	// A LivenessResponse expresses that the process is alive.
+	LivenessResponse struct {
+		Status string `json:"status"`
+	}
+
+	// A ReadinessResponse expresses whether the server can handle requests,
+	// with the result of each dependency check.
+	ReadinessResponse struct {
+		Status string        `json:"status"`
+		Checks []HealthCheck `json:"checks"`
+	}
+
+	// A HealthCheck expresses the result of a dependency check.
+	HealthCheck struct {
+		Name       string  `json:"name"`
+		Status     string  `json:"status"`
+		DurationMS float64 `json:"duration_ms"`
+		Message    string  `json:"message,omitempty"`
+	}
+)
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+type (
+	// A Project expresses a list which groups TODOs. A TODO belongs to at
+	// most one project.
+	Project struct {
+		ID          int64  `json:"id"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		// OpenCount and DoneCount are the numbers of the TODOs of the
+		// project not done yet and done, out of the trash.
+		OpenCount int64     `json:"open_count"`
+		DoneCount int64     `json:"done_count"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	// A CreateProjectRequest expresses ...
+	CreateProjectRequest struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	// A CreateProjectResponse expresses ...
+	CreateProjectResponse struct {
+		Project Project `json:"project"`
+	}
+
+	// A ReadProjectResponse expresses ...
+	ReadProjectResponse struct {
+		Projects []*Project `json:"projects"`
+	}
+
+	// A GetProjectResponse expresses ...
+	GetProjectResponse struct {
+		Project Project `json:"project"`
+	}
+
+	// A UpdateProjectRequest expresses ...
+	UpdateProjectRequest struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	// A UpdateProjectResponse expresses ...
+	UpdateProjectResponse struct {
+		Project Project `json:"project"`
+	}
+
+	// A DeleteProjectResponse expresses ...
+	DeleteProjectResponse struct{}
+)
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+type (
+	// A Tag expresses a label attached to TODOs. Its name is unique
+	// case-insensitively.
+	Tag struct {
+		ID        int64     `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// A CreateTagRequest expresses ...
+	CreateTagRequest struct {
+		Name string `json:"name"`
+	}
+	// A CreateTagResponse expresses ...
+	CreateTagResponse struct {
+		Tag Tag `json:"tag"`
+	}
+
+	// A ReadTagResponse expresses ...
+	ReadTagResponse struct {
+		Tags []*Tag `json:"tags"`
+	}
+
+	// A GetTagResponse expresses ...
+	GetTagResponse struct {
+		Tag Tag `json:"tag"`
+	}
+
+	// A UpdateTagRequest expresses ...
+	UpdateTagRequest struct {
+		Name string `json:"name"`
+	}
+	// A UpdateTagResponse expresses ...
+	UpdateTagResponse struct {
+		Tag Tag `json:"tag"`
+	}
+
+	// A DeleteTagResponse expresses ...
+	DeleteTagResponse struct{}
+)
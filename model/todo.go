@@ -2,20 +2,127 @@ package model
 
 import "time"
 
+// TODOStatus values.
+const (
+	TODOStatusOpen TODOStatus = "open"
+	TODOStatusDone TODOStatus = "done"
+	TODOStatusAll  TODOStatus = "all"
+)
+
+// TODOSortField values.
+const (
+	TODOSortID        TODOSortField = "id"
+	TODOSortPriority  TODOSortField = "priority"
+	TODOSortCreatedAt TODOSortField = "created_at"
+	TODOSortUpdatedAt TODOSortField = "updated_at"
+	// TODOSortSubject compares ASCII letters case-insensitively.
+	TODOSortSubject TODOSortField = "subject"
+	// TODOSortDueAt orders the TODOs without a due time last in either
+	// direction.
+	TODOSortDueAt TODOSortField = "due_at"
+)
+
+// Limits of the priority of a TODO. The higher one is more important.
+const (
+	MinTODOPriority = 0
+	MaxTODOPriority = 4
+)
+
 type (
 	// A TODO expresses ...
 	TODO struct {
-		ID          int64     `json:"id"`
-		Subject     string    `json:"subject"`
-		Description string    `json:"description"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
+		ID          int64      `json:"id"`
+		Subject     string     `json:"subject"`
+		Description string     `json:"description"`
+		ProjectID   *int64     `json:"project_id,omitempty"`
+		Priority    int        `json:"priority"`
+		CompletedAt *time.Time `json:"completed_at,omitempty"`
+		DueAt       *time.Time `json:"due_at,omitempty"`
+		DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+		// Tags are the names of the tags of the TODO in alphabetical order,
+		// or nil without any.
+		Tags []string `json:"tags,omitempty"`
+		// Checklist and Progress are only read with a single TODO, and
+		// omitted without any items.
+		Checklist []*ChecklistItem `json:"checklist,omitempty"`
+		Progress  *TODOProgress    `json:"progress,omitempty"`
+		CreatedAt time.Time        `json:"created_at"`
+		UpdatedAt time.Time        `json:"updated_at"`
+		Match     *TODOMatch       `json:"match,omitempty"`
+		// Version is incremented on every change. It is sent as ETag rather
+		// than in the body.
+		Version int64 `json:"-"`
+	}
+
+	// A TODOMatch expresses how a TODO matched a full-text search.
+	// Snippet highlights the matched terms with <mark> and </mark>.
+	TODOMatch struct {
+		Rank    float64 `json:"rank"`
+		Snippet string  `json:"snippet"`
+	}
+
+	// A TODOPatch expresses a partial update of a TODO. Nil fields are left
+	// unchanged.
+	TODOPatch struct {
+		Subject     *string
+		Description *string
+		// DueAt points to nil to clear the due time.
+		DueAt **time.Time
+		Tags  *[]string
+		// ProjectID points to nil to take the TODO out of its project.
+		ProjectID **int64
+		Priority  *int
+	}
+
+	// A TODOStatus expresses whether a TODO is done or not.
+	TODOStatus string
+
+	// A TODOSortField expresses a field which TODOs are ordered by.
+	TODOSortField string
+
+	// A TODOSortKey expresses a field which TODOs are ordered by, and the
+	// direction.
+	TODOSortKey struct {
+		Field TODOSortField
+		Desc  bool
+	}
+
+	// A TODOFilter expresses conditions to narrow down TODOs.
+	TODOFilter struct {
+		Status TODOStatus
+		// Query is a full-text search query. Empty means no search.
+		Query string
+		// Trashed selects the TODOs in the trash instead of the others.
+		Trashed bool
+		// DueBefore and DueAfter select the TODOs due before, or at or after
+		// the time. TODOs without a due time never match them.
+		DueBefore *time.Time
+		DueAfter  *time.Time
+		// Overdue selects the TODOs not done yet whose due time has passed.
+		Overdue bool
+		// Tags selects the TODOs having all of the tags, or any of them if
+		// AnyTag. The names are compared case-insensitively.
+		Tags   []string
+		AnyTag bool
+		// ProjectID selects the TODOs of the project. 0 means any.
+		ProjectID int64
+		// Sort orders the TODOs by the keys in turn, and then by descending
+		// id. Count ignores it, and so does List with a Query.
+		Sort []TODOSortKey
+		// After selects the TODOs after it in the order of Sort, by its ID
+		// and the fields sorted by, instead of by the TODO of the prevID of
+		// List. List with a Query ignores it.
+		After *TODO
 	}
 
 	// A CreateTODORequest expresses ...
 	CreateTODORequest struct {
-		Subject     string `json:"subject"`
-		Description string `json:"description"`
+		Subject     string   `json:"subject"`
+		Description string   `json:"description"`
+		DueAt       *string  `json:"due_at,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+		ProjectID   *int64   `json:"project_id,omitempty"`
+		Priority    int      `json:"priority"`
 	}
 	// A CreateTODOResponse expresses ...
 	CreateTODOResponse struct {
@@ -24,29 +131,72 @@ type (
 
 	// A ReadTODORequest expresses ...
 	ReadTODORequest struct {
-		PrevID int64 `json:"prev_id"`
-		Size   int64 `json:"size"`
+		PrevID    int64      `json:"prev_id"`
+		Size      int64      `json:"size"`
+		Status    TODOStatus `json:"status"`
+		Query     string     `json:"q"`
+		DueBefore string     `json:"due_before"`
+		DueAfter  string     `json:"due_after"`
+		Overdue   bool       `json:"overdue"`
+		Sort      string     `json:"sort"`
+		Cursor    string     `json:"cursor"`
+		Total     bool       `json:"total"`
+		Tags      []string   `json:"tag"`
+		TagMatch  string     `json:"tag_match"`
 	}
 	// A ReadTODOResponse expresses ...
 	ReadTODOResponse struct {
-		TODOs []TODO `json:"todos"`
+		TODOs []*TODO `json:"todos"`
+		// HasMore tells the page is followed by more TODOs, and NextCursor
+		// continues after its last TODO then.
+		HasMore    bool   `json:"has_more"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		// Total is the number of all TODOs matching the request, only if
+		// asked for.
+		Total *int64 `json:"total,omitempty"`
+	}
+
+	// A GetTODOResponse expresses ...
+	GetTODOResponse struct {
+		TODO TODO `json:"todo"`
 	}
 
 	// A UpdateTODORequest expresses ...
 	UpdateTODORequest struct {
-		ID          int64  `json:"id"`
-		Subject     string `json:"subject"`
-		Description string `json:"description"`
+		ID          int64    `json:"id"`
+		Subject     string   `json:"subject"`
+		Description string   `json:"description"`
+		DueAt       *string  `json:"due_at,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+		ProjectID   *int64   `json:"project_id,omitempty"`
+		Priority    int      `json:"priority"`
 	}
 	// A UpdateTODOResponse expresses ...
 	UpdateTODOResponse struct {
 		TODO TODO `json:"todo"`
 	}
 
+	// A DoneTODOResponse expresses ...
+	DoneTODOResponse struct {
+		TODO TODO `json:"todo"`
+	}
+
 	// A DeleteTODORequest expresses ...
 	DeleteTODORequest struct {
 		IDs []int64 `json:"ids"`
 	}
 	// A DeleteTODOResponse expresses ...
 	DeleteTODOResponse struct{}
+
+	// A RestoreTODOResponse expresses ...
+	RestoreTODOResponse struct {
+		TODO TODO `json:"todo"`
+	}
+
+	// A PurgeTODORequest expresses ...
+	PurgeTODORequest struct {
+		IDs []int64 `json:"ids"`
+	}
+	// A PurgeTODOResponse expresses ...
+	PurgeTODOResponse struct{}
 )
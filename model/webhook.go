@@ -0,0 +1,99 @@
+package model
+
+import "time"
+
+// WebhookDeliveryStatus values.
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type (
+	// A Webhook expresses a subscription of a URL to the events of TODO
+	// changes, which are POSTed to it signed with its secret.
+	Webhook struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+		// Events are the types of the events delivered, or all types when
+		// empty.
+		Events []TODOEventType `json:"events"`
+		Active bool            `json:"active"`
+		// Secret signs the deliveries. It is only returned when created.
+		Secret    string    `json:"secret,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	// A WebhookDeliveryStatus expresses the state of a WebhookDelivery.
+	WebhookDeliveryStatus string
+
+	// A WebhookDelivery expresses the delivery of an event to a webhook,
+	// attempted until it succeeds or runs out of attempts.
+	WebhookDelivery struct {
+		ID        int64 `json:"id"`
+		WebhookID int64 `json:"webhook_id"`
+		// Event is the payload delivered, whose ID is the id of the event
+		// in the outbox.
+		Event    *TODOEvent            `json:"event"`
+		Status   WebhookDeliveryStatus `json:"status"`
+		Attempts int                   `json:"attempts"`
+		// NextAttemptAt is when a pending delivery is attempted next.
+		NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+		// LastStatusCode and LastError tell the result of the last attempt,
+		// LastStatusCode being 0 without a response.
+		LastStatusCode int       `json:"last_status_code,omitempty"`
+		LastError      string    `json:"last_error,omitempty"`
+		CreatedAt      time.Time `json:"created_at"`
+		UpdatedAt      time.Time `json:"updated_at"`
+
+		// Webhook is the webhook to deliver to, only when claimed.
+		Webhook *Webhook `json:"-"`
+	}
+
+	// A CreateWebhookRequest expresses ...
+	CreateWebhookRequest struct {
+		URL    string          `json:"url"`
+		Events []TODOEventType `json:"events"`
+		// Active is true unless given.
+		Active *bool `json:"active"`
+		// Secret is generated unless given.
+		Secret string `json:"secret"`
+	}
+	// A CreateWebhookResponse expresses ...
+	CreateWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+	}
+
+	// A ReadWebhookResponse expresses ...
+	ReadWebhookResponse struct {
+		Webhooks []*Webhook `json:"webhooks"`
+	}
+
+	// A GetWebhookResponse expresses ...
+	GetWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+	}
+
+	// A UpdateWebhookRequest expresses ...
+	UpdateWebhookRequest struct {
+		URL    string          `json:"url"`
+		Events []TODOEventType `json:"events"`
+		// Active is true unless given.
+		Active *bool `json:"active"`
+		// Secret is kept unless given.
+		Secret string `json:"secret"`
+	}
+	// A UpdateWebhookResponse expresses ...
+	UpdateWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+	}
+
+	// A DeleteWebhookResponse expresses ...
+	DeleteWebhookResponse struct{}
+
+	// A ReadWebhookDeliveryResponse expresses ...
+	ReadWebhookDeliveryResponse struct {
+		Deliveries []*WebhookDelivery `json:"deliveries"`
+	}
+)
@@ -0,0 +1,49 @@
+package model
+
+import "encoding/json"
+
+// WSMessageType values. Clients send subscribe, unsubscribe, create, update
+// and delete, and the server sends ack, error and event.
+const (
+	WSSubscribe   WSMessageType = "subscribe"
+	WSUnsubscribe WSMessageType = "unsubscribe"
+	WSCreate      WSMessageType = "create"
+	WSUpdate      WSMessageType = "update"
+	WSDelete      WSMessageType = "delete"
+	WSAck         WSMessageType = "ack"
+	WSError       WSMessageType = "error"
+	WSEvent       WSMessageType = "event"
+)
+
+type (
+	// A WSMessageType expresses the kind of a WebSocket message.
+	WSMessageType string
+
+	// A WSCommand expresses a message sent by a WebSocket client.
+	WSCommand struct {
+		// ID is chosen by the client to match the ack or error answering
+		// the command.
+		ID   string        `json:"id"`
+		Type WSMessageType `json:"type"`
+		// ProjectID is the project to subscribe to or unsubscribe from, or
+		// nil for all TODOs.
+		ProjectID *int64 `json:"project_id,omitempty"`
+		// TODO is CreateTODORequest for create and UpdateTODORequest for
+		// update.
+		TODO json.RawMessage `json:"todo,omitempty"`
+		// Version is the version of the TODO update expects, like If-Match.
+		Version int64   `json:"version,omitempty"`
+		IDs     []int64 `json:"ids,omitempty"`
+	}
+
+	// A WSMessage expresses a message sent to a WebSocket client.
+	WSMessage struct {
+		Type WSMessageType `json:"type"`
+		// ID is the id of the command answered by ack or error.
+		ID string `json:"id,omitempty"`
+		// TODO is the TODO created or updated by the command acked.
+		TODO  *TODO            `json:"todo,omitempty"`
+		Error *ProblemResponse `json:"error,omitempty"`
+		Event *TODOEvent       `json:"event,omitempty"`
+	}
+)
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A ChecklistRepository stores the ChecklistItem entities of TODOs. Methods
+// return *model.ErrNotFound for a TODO missing like for TODORepository, or an
+// item missing from the TODO. Every change to the checklist of a TODO changes
+// the TODO as well, incrementing its Version.
+type ChecklistRepository interface {
+	// ListChecklist returns the items of the TODO by todoID in order.
+	ListChecklist(ctx context.Context, todoID int64) ([]*model.ChecklistItem, error)
+	// AddChecklistItem stores a new item with the text and done of item in
+	// the TODO by todoID, before the item at the position of item, and
+	// returns it. A position past the last item appends it.
+	AddChecklistItem(ctx context.Context, todoID int64, item *model.ChecklistItem) (*model.ChecklistItem, error)
+	// UpdateChecklistItem changes the fields of the item by id given in patch
+	// and returns it.
+	UpdateChecklistItem(ctx context.Context, todoID, id int64, patch *model.ChecklistItemPatch) (*model.ChecklistItem, error)
+	// DeleteChecklistItem deletes the item by id, moving up the items after
+	// it.
+	DeleteChecklistItem(ctx context.Context, todoID, id int64) error
+	// ReorderChecklist orders the items of the TODO by todoID as ids, which
+	// must list every item once, and returns them. Otherwise it returns
+	// *model.ErrValidation.
+	ReorderChecklist(ctx context.Context, todoID int64, ids []int64) ([]*model.ChecklistItem, error)
+}
@@ -0,0 +1,725 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A MemoryTODORepository implements TODORepository in memory.
+// It is meant for tests and behaves like SQLiteTODORepository.
+type MemoryTODORepository struct {
+	mu *sync.RWMutex
+	*memoryData
+	now func() time.Time
+	// inUnit tells that r runs in a unit of work, which holds mu for all of
+	// its operations.
+	inUnit bool
+}
+
+// memoryData is the data of MemoryTODORepository, which a unit of work copies
+// to restore on failure.
+type memoryData struct {
+	lastID         int64
+	todos          map[int64]*model.TODO
+	lastTagID      int64
+	tags           map[int64]*model.Tag
+	lastProjectID  int64
+	projects       map[int64]*model.Project
+	lastItemID     int64
+	checklists     map[int64][]*model.ChecklistItem
+	lastEventID    int64
+	outbox         []model.TODOEvent
+	lastWebhookID  int64
+	webhooks       map[int64]*model.Webhook
+	lastDeliveryID int64
+	deliveries     []*model.WebhookDelivery
+}
+
+var _ TODORepository = (*MemoryTODORepository)(nil)
+
+// NewMemoryTODORepository returns new empty MemoryTODORepository.
+func NewMemoryTODORepository() *MemoryTODORepository {
+	return &MemoryTODORepository{
+		mu: &sync.RWMutex{},
+		memoryData: &memoryData{
+			todos:      make(map[int64]*model.TODO),
+			tags:       make(map[int64]*model.Tag),
+			projects:   make(map[int64]*model.Project),
+			checklists: make(map[int64][]*model.ChecklistItem),
+			webhooks:   make(map[int64]*model.Webhook),
+		},
+		now: func() time.Time {
+			// same precision as DATETIME('now') of SQLite
+			return time.Now().UTC().Truncate(time.Second)
+		},
+	}
+}
+
+// Atomic implements TODORepository interface. The unit of work holds the lock
+// of r throughout, so fn must not use r itself.
+func (r *MemoryTODORepository) Atomic(ctx context.Context, fn func(repo TODORepository) error) error {
+	r.lock()
+	defer r.unlock()
+
+	saved := r.memoryData.clone()
+	unit := &MemoryTODORepository{mu: r.mu, memoryData: r.memoryData, now: r.now, inUnit: true}
+	if err := fn(unit); err != nil {
+		*r.memoryData = *saved
+		return err
+	}
+
+	return nil
+}
+
+// lock locks r for writing unless it runs in a unit of work.
+func (r *MemoryTODORepository) lock() {
+	if !r.inUnit {
+		r.mu.Lock()
+	}
+}
+
+// unlock undoes lock.
+func (r *MemoryTODORepository) unlock() {
+	if !r.inUnit {
+		r.mu.Unlock()
+	}
+}
+
+// rlock locks r for reading unless it runs in a unit of work.
+func (r *MemoryTODORepository) rlock() {
+	if !r.inUnit {
+		r.mu.RLock()
+	}
+}
+
+// runlock undoes rlock.
+func (r *MemoryTODORepository) runlock() {
+	if !r.inUnit {
+		r.mu.RUnlock()
+	}
+}
+
+// clone returns a deep copy of d.
+func (d *memoryData) clone() *memoryData {
+	c := *d
+
+	c.todos = make(map[int64]*model.TODO, len(d.todos))
+	for id, todo := range d.todos {
+		c.todos[id] = cloneTODO(todo)
+	}
+	c.tags = make(map[int64]*model.Tag, len(d.tags))
+	for id, tag := range d.tags {
+		t := *tag
+		c.tags[id] = &t
+	}
+	c.projects = make(map[int64]*model.Project, len(d.projects))
+	for id, project := range d.projects {
+		p := *project
+		c.projects[id] = &p
+	}
+	c.checklists = make(map[int64][]*model.ChecklistItem, len(d.checklists))
+	for id, items := range d.checklists {
+		c.checklists[id] = make([]*model.ChecklistItem, len(items))
+		for i, item := range items {
+			it := *item
+			c.checklists[id][i] = &it
+		}
+	}
+	c.outbox = append([]model.TODOEvent{}, d.outbox...)
+	c.webhooks = make(map[int64]*model.Webhook, len(d.webhooks))
+	for id, hook := range d.webhooks {
+		c.webhooks[id] = cloneWebhook(hook)
+	}
+	c.deliveries = make([]*model.WebhookDelivery, len(d.deliveries))
+	for i, delivery := range d.deliveries {
+		c.deliveries[i] = cloneDelivery(delivery)
+	}
+
+	return &c
+}
+
+// Create implements TODORepository interface.
+func (r *MemoryTODORepository) Create(ctx context.Context, todo *model.TODO) (*model.TODO, error) {
+	// same as the CHECK constraint of the todos table
+	if todo.Subject == "" {
+		return nil, model.NewErrValidation("subject", "must not be empty")
+	}
+	if todo.Priority < model.MinTODOPriority || todo.Priority > model.MaxTODOPriority {
+		return nil, errPriority()
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	if !r.hasProject(todo.ProjectID) {
+		return nil, errNoProject()
+	}
+
+	r.lastID++
+	now := r.now()
+	created := &model.TODO{
+		ID:          r.lastID,
+		Subject:     todo.Subject,
+		Description: todo.Description,
+		ProjectID:   cloneID(todo.ProjectID),
+		Priority:    todo.Priority,
+		DueAt:       dueTime(todo.DueAt),
+		Tags:        r.ensureTags(todo.Tags),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
+	}
+	r.todos[created.ID] = created
+	r.recordEvent(model.TODOEventCreated, created)
+
+	return cloneTODO(created), nil
+}
+
+// Get implements TODORepository interface.
+func (r *MemoryTODORepository) Get(ctx context.Context, id int64) (*model.TODO, error) {
+	r.rlock()
+	defer r.runlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt != nil {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found.", Resource: model.ResourceTODO}
+	}
+
+	return cloneTODO(todo), nil
+}
+
+// List implements TODORepository interface.
+func (r *MemoryTODORepository) List(ctx context.Context, prevID, size int64, filter model.TODOFilter) ([]*model.TODO, error) {
+	switch filter.Status {
+	case model.TODOStatusOpen, model.TODOStatusDone, model.TODOStatusAll, "":
+	default:
+		return nil, fmt.Errorf("unknown status: %q", filter.Status)
+	}
+	for _, key := range filter.Sort {
+		switch key.Field {
+		case model.TODOSortID, model.TODOSortPriority, model.TODOSortCreatedAt, model.TODOSortUpdatedAt, model.TODOSortSubject, model.TODOSortDueAt:
+		default:
+			return nil, fmt.Errorf("unknown sort: %q", key.Field)
+		}
+	}
+
+	r.rlock()
+	defer r.runlock()
+
+	if filter.Query != "" {
+		return r.search(prevID, size, filter), nil
+	}
+
+	less := sortLess(filter.Sort)
+	// a purged TODO of prevID is compared by its id and zero values
+	prev := filter.After
+	if prev == nil && prevID > 0 {
+		var ok bool
+		if prev, ok = r.todos[prevID]; !ok {
+			prev = &model.TODO{ID: prevID}
+		}
+	}
+	todos := []*model.TODO{}
+	for _, todo := range r.todos {
+		if prev != nil && !less(prev, todo) {
+			continue
+		}
+		if !matchFilter(todo, filter, r.now()) {
+			continue
+		}
+		todos = append(todos, cloneTODO(todo))
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		return less(todos[i], todos[j])
+	})
+	if int64(len(todos)) > size {
+		todos = todos[:size]
+	}
+
+	return todos, nil
+}
+
+// Count implements TODORepository interface.
+func (r *MemoryTODORepository) Count(ctx context.Context, filter model.TODOFilter) (int64, error) {
+	filter.After = nil
+	todos, err := r.List(ctx, 0, math.MaxInt64, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(todos)), nil
+}
+
+// sortLess returns the order of TODOs by keys, the same as sortColumns.
+func sortLess(keys []model.TODOSortKey) func(a, b *model.TODO) bool {
+	return func(a, b *model.TODO) bool {
+		for _, key := range keys {
+			var c int
+			switch key.Field {
+			case model.TODOSortID:
+				c = compareInt(a.ID, b.ID)
+			case model.TODOSortPriority:
+				c = compareInt(int64(a.Priority), int64(b.Priority))
+			case model.TODOSortCreatedAt:
+				c = compareTime(a.CreatedAt, b.CreatedAt)
+			case model.TODOSortUpdatedAt:
+				c = compareTime(a.UpdatedAt, b.UpdatedAt)
+			case model.TODOSortSubject:
+				c = strings.Compare(FoldCase(a.Subject), FoldCase(b.Subject))
+			case model.TODOSortDueAt:
+				// the TODOs without a due time come last
+				if (a.DueAt == nil) != (b.DueAt == nil) {
+					return b.DueAt == nil
+				}
+				if a.DueAt != nil {
+					c = compareTime(*a.DueAt, *b.DueAt)
+				}
+			}
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return a.ID > b.ID
+	}
+}
+
+// compareInt returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTime returns -1, 0 or 1 as a is before, equal to or after b.
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// search is the full-text search version of List. It ranks hits the same way
+// as the fts_bm25 function of SQLite.
+func (r *MemoryTODORepository) search(prevID, size int64, filter model.TODOFilter) []*model.TODO {
+	terms := tokenize(filter.Query)
+	weights := []float64{2.0, 1.0}
+	// the parameters of fts_bm25
+	const k1, b = 1.2, 0.75
+
+	type doc struct {
+		todo    *model.TODO
+		columns [][]string
+	}
+	docs := make([]doc, 0, len(r.todos))
+	// tokens in each column of all TODOs, and the TODOs having each term in
+	// each column, the largest of which stands for the TODOs having it
+	totalLengths := make([]int, len(weights))
+	rowsWithHits := make(map[string][]int)
+	for _, todo := range r.todos {
+		d := doc{todo: todo, columns: [][]string{tokenize(todo.Subject), tokenize(todo.Description)}}
+		docs = append(docs, d)
+		for c, tokens := range d.columns {
+			totalLengths[c] += len(tokens)
+		}
+		for _, term := range terms {
+			if rowsWithHits[term] == nil {
+				rowsWithHits[term] = make([]int, len(d.columns))
+			}
+			for c, tokens := range d.columns {
+				if count(tokens, term) != 0 {
+					rowsWithHits[term][c]++
+				}
+			}
+		}
+	}
+	rows := len(docs)
+	// averaged and rounded to an integer like matchinfo
+	avgLengths := make([]float64, len(weights))
+	for c, total := range totalLengths {
+		if rows != 0 {
+			avgLengths[c] = float64((total + rows/2) / rows)
+		}
+		if avgLengths[c] < 1 {
+			avgLengths[c] = 1
+		}
+	}
+
+	var hits []*model.TODO
+	for _, d := range docs {
+		var score float64
+		matched := true
+		for _, term := range terms {
+			var df int
+			for _, n := range rowsWithHits[term] {
+				if n > df {
+					df = n
+				}
+			}
+			idf := math.Log((float64(rows-df) + 0.5) / (float64(df) + 0.5))
+			if idf <= 0 {
+				idf = 1e-6
+			}
+
+			var termHits int
+			for c, tokens := range d.columns {
+				n := count(tokens, term)
+				termHits += n
+				if n == 0 {
+					continue
+				}
+				norm := k1 * (1 - b + b*float64(len(tokens))/avgLengths[c])
+				score += weights[c] * idf * float64(n) * (k1 + 1) / (float64(n) + norm)
+			}
+			if termHits == 0 {
+				matched = false
+			}
+		}
+		if !matched || len(terms) == 0 {
+			continue
+		}
+
+		todo := cloneTODO(d.todo)
+		text := todo.Subject
+		if count(d.columns[0], terms...) < count(d.columns[1], terms...) {
+			text = todo.Description
+		}
+		todo.Match = &model.TODOMatch{Rank: score, Snippet: highlight(text, terms)}
+		hits = append(hits, todo)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Match.Rank != hits[j].Match.Rank {
+			return hits[i].Match.Rank > hits[j].Match.Rank
+		}
+		return hits[i].ID > hits[j].ID
+	})
+
+	todos := []*model.TODO{}
+	after := prevID <= 0
+	for _, todo := range hits {
+		if after && matchFilter(todo, filter, r.now()) {
+			todos = append(todos, todo)
+		}
+		if todo.ID == prevID {
+			after = true
+		}
+	}
+	if int64(len(todos)) > size {
+		todos = todos[:size]
+	}
+
+	return todos
+}
+
+// Update implements TODORepository interface.
+func (r *MemoryTODORepository) Update(ctx context.Context, todo *model.TODO, version int64) (*model.TODO, error) {
+	// same as the CHECK constraint of the todos table
+	if todo.Subject == "" {
+		return nil, model.NewErrValidation("subject", "must not be empty")
+	}
+	if todo.Priority < model.MinTODOPriority || todo.Priority > model.MaxTODOPriority {
+		return nil, errPriority()
+	}
+
+	return r.update(todo.ID, version, func(updated *model.TODO) (bool, error) {
+		if !r.hasProject(todo.ProjectID) {
+			return false, errNoProject()
+		}
+		updated.Subject = todo.Subject
+		updated.Description = todo.Description
+		updated.DueAt = dueTime(todo.DueAt)
+		updated.Tags = r.ensureTags(todo.Tags)
+		updated.ProjectID = cloneID(todo.ProjectID)
+		updated.Priority = todo.Priority
+		return true, nil
+	})
+}
+
+// SetCompleted implements TODORepository interface.
+func (r *MemoryTODORepository) SetCompleted(ctx context.Context, id int64, done bool) (*model.TODO, error) {
+	now := r.now()
+	return r.update(id, 0, func(todo *model.TODO) (bool, error) {
+		if (todo.CompletedAt != nil) == done {
+			return false, nil
+		}
+		if done {
+			todo.CompletedAt = &now
+		} else {
+			todo.CompletedAt = nil
+		}
+		return true, nil
+	})
+}
+
+// Delete implements TODORepository interface.
+func (r *MemoryTODORepository) Delete(ctx context.Context, ids []int64, version int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	now := r.now()
+	var deleted []int64
+	for _, id := range ids {
+		if todo, ok := r.todos[id]; ok && todo.DeletedAt == nil && (version == 0 || todo.Version == version) {
+			todo.DeletedAt = &now
+			todo.UpdatedAt = now
+			todo.Version++
+			r.recordEvent(model.TODOEventDeleted, todo)
+			deleted = append(deleted, id)
+		}
+	}
+	if todo, ok := r.todos[ids[0]]; len(deleted) == 0 && version != 0 && ok && todo.DeletedAt == nil {
+		return nil, &model.ErrPreconditionFailed{ID: ids[0]}
+	}
+	if len(deleted) == 0 {
+		return nil, &model.ErrNotFound{Resource: model.ResourceTODO}
+	}
+
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i] < deleted[j] })
+	return deleted, nil
+}
+
+// Restore implements TODORepository interface.
+func (r *MemoryTODORepository) Restore(ctx context.Context, id int64) (*model.TODO, error) {
+	r.lock()
+	defer r.unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt == nil {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found in Trash.", Resource: model.ResourceTODO}
+	}
+	todo.DeletedAt = nil
+	todo.UpdatedAt = r.now()
+	todo.Version++
+	r.recordEvent(model.TODOEventUpdated, todo)
+
+	return cloneTODO(todo), nil
+}
+
+// Purge implements TODORepository interface.
+func (r *MemoryTODORepository) Purge(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	var purgedCount int
+	for _, id := range ids {
+		if todo, ok := r.todos[id]; ok && todo.DeletedAt != nil {
+			delete(r.todos, id)
+			delete(r.checklists, id)
+			purgedCount++
+		}
+	}
+	if purgedCount == 0 {
+		return &model.ErrNotFound{When: time.Now(), What: "Todo Not Found in Trash.", Resource: model.ResourceTODO}
+	}
+
+	return nil
+}
+
+// PurgeDeletedBefore implements TODORepository interface.
+func (r *MemoryTODORepository) PurgeDeletedBefore(ctx context.Context, t time.Time) (int64, error) {
+	r.lock()
+	defer r.unlock()
+
+	var n int64
+	for id, todo := range r.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(t) {
+			delete(r.todos, id)
+			delete(r.checklists, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// update applies fn to the TODO by id if it is at version, or any version if
+// version is 0. It bumps UpdatedAt like the trigger_todos_updated_at trigger,
+// and Version if fn reports a change, and records the update. fn must fail
+// before changing todo.
+func (r *MemoryTODORepository) update(id, version int64, fn func(todo *model.TODO) (bool, error)) (*model.TODO, error) {
+	r.lock()
+	defer r.unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt != nil {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found.", Resource: model.ResourceTODO}
+	}
+	if version != 0 && todo.Version != version {
+		return nil, &model.ErrPreconditionFailed{ID: id}
+	}
+	changed, err := fn(todo)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		todo.Version++
+	}
+	todo.UpdatedAt = r.now()
+	r.recordEvent(model.TODOEventUpdated, todo)
+
+	return cloneTODO(todo), nil
+}
+
+func cloneTODO(todo *model.TODO) *model.TODO {
+	c := *todo
+	if todo.CompletedAt != nil {
+		completedAt := *todo.CompletedAt
+		c.CompletedAt = &completedAt
+	}
+	if todo.DueAt != nil {
+		dueAt := *todo.DueAt
+		c.DueAt = &dueAt
+	}
+	if todo.Tags != nil {
+		c.Tags = append([]string(nil), todo.Tags...)
+	}
+	c.ProjectID = cloneID(todo.ProjectID)
+	if todo.DeletedAt != nil {
+		deletedAt := *todo.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return &c
+}
+
+// cloneID returns a copy of id.
+func cloneID(id *int64) *int64 {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+// dueTime returns a copy of t as SQLiteTODORepository stores it, in seconds.
+func dueTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	due := t.Truncate(time.Second).In(time.Local)
+	return &due
+}
+
+// matchFilter reports whether todo matches filter at now.
+func matchFilter(todo *model.TODO, filter model.TODOFilter, now time.Time) bool {
+	if (todo.DeletedAt != nil) != filter.Trashed {
+		return false
+	}
+	if filter.DueBefore != nil && (todo.DueAt == nil || !todo.DueAt.Before(*filter.DueBefore)) {
+		return false
+	}
+	if filter.DueAfter != nil && (todo.DueAt == nil || todo.DueAt.Before(*filter.DueAfter)) {
+		return false
+	}
+	if filter.Overdue && (todo.CompletedAt != nil || todo.DueAt == nil || !todo.DueAt.Before(now)) {
+		return false
+	}
+	if filter.ProjectID != 0 && (todo.ProjectID == nil || *todo.ProjectID != filter.ProjectID) {
+		return false
+	}
+	if len(filter.Tags) != 0 {
+		var matched int
+		tags := distinctTags(filter.Tags)
+		for _, tag := range tags {
+			for _, name := range todo.Tags {
+				if FoldCase(name) == FoldCase(tag) {
+					matched++
+					break
+				}
+			}
+		}
+		if matched == 0 || (!filter.AnyTag && matched != len(tags)) {
+			return false
+		}
+	}
+	switch filter.Status {
+	case model.TODOStatusOpen:
+		return todo.CompletedAt == nil
+	case model.TODOStatusDone:
+		return todo.CompletedAt != nil
+	default:
+		return true
+	}
+}
+
+// tokenize splits s into lower case words like the unicode61 tokenizer.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// count returns how many tokens equal any of terms.
+func count(tokens []string, terms ...string) int {
+	var n int
+	for _, token := range tokens {
+		for _, term := range terms {
+			if token == term {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// highlight wraps the words of s which equal any of terms with <mark>.
+func highlight(s string, terms []string) string {
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := s[start:end]
+		if count([]string{strings.ToLower(word)}, terms...) != 0 {
+			word = "<mark>" + word + "</mark>"
+		}
+		b.WriteString(word)
+		start = -1
+	}
+	for i, c := range s {
+		if isSeparator(c) {
+			if start >= 0 {
+				flush(i)
+			}
+			b.WriteRune(c)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		flush(len(s))
+	}
+	return b.String()
+}
+
+// errPriority returns the error for a priority out of range, which the CHECK
+// constraint of the todos table rejects.
+func errPriority() error {
+	return model.NewErrValidation("priority", fmt.Sprintf("must be between %d and %d", model.MinTODOPriority, model.MaxTODOPriority))
+}
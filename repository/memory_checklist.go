@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ ChecklistRepository = (*MemoryTODORepository)(nil)
+
+// ListChecklist implements ChecklistRepository interface.
+func (r *MemoryTODORepository) ListChecklist(ctx context.Context, todoID int64) ([]*model.ChecklistItem, error) {
+	r.rlock()
+	defer r.runlock()
+
+	if _, err := r.liveTODO(todoID); err != nil {
+		return nil, err
+	}
+
+	return r.cloneChecklist(todoID), nil
+}
+
+// AddChecklistItem implements ChecklistRepository interface.
+func (r *MemoryTODORepository) AddChecklistItem(ctx context.Context, todoID int64, item *model.ChecklistItem) (*model.ChecklistItem, error) {
+	// same as the CHECK constraint of the checklist_items table
+	if item.Text == "" {
+		return nil, model.NewErrValidation("text", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	todo, err := r.liveTODO(todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := r.checklists[todoID]
+	position := item.Position
+	if position < 0 || position > len(items) {
+		position = len(items)
+	}
+
+	r.lastItemID++
+	now := r.now()
+	added := &model.ChecklistItem{
+		ID:        r.lastItemID,
+		Text:      item.Text,
+		Done:      item.Done,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// the items moved down change like by the trigger_checklist_items_updated_at trigger
+	for _, moved := range items[position:] {
+		moved.UpdatedAt = now
+	}
+	items = append(items, nil)
+	copy(items[position+1:], items[position:])
+	items[position] = added
+	r.checklists[todoID] = items
+	r.touchTODO(todo)
+
+	c := *added
+	c.Position = position
+	return &c, nil
+}
+
+// UpdateChecklistItem implements ChecklistRepository interface.
+func (r *MemoryTODORepository) UpdateChecklistItem(ctx context.Context, todoID, id int64, patch *model.ChecklistItemPatch) (*model.ChecklistItem, error) {
+	// same as the CHECK constraint of the checklist_items table
+	if patch.Text != nil && *patch.Text == "" {
+		return nil, model.NewErrValidation("text", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	todo, err := r.liveTODO(todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range r.checklists[todoID] {
+		if item.ID != id {
+			continue
+		}
+		if patch.Text != nil {
+			item.Text = *patch.Text
+		}
+		if patch.Done != nil {
+			item.Done = *patch.Done
+		}
+		item.UpdatedAt = r.now()
+		r.touchTODO(todo)
+
+		c := *item
+		c.Position = i
+		return &c, nil
+	}
+
+	return nil, &model.ErrNotFound{When: time.Now(), What: "Checklist Item Not Found.", Resource: model.ResourceChecklistItem}
+}
+
+// DeleteChecklistItem implements ChecklistRepository interface.
+func (r *MemoryTODORepository) DeleteChecklistItem(ctx context.Context, todoID, id int64) error {
+	r.lock()
+	defer r.unlock()
+
+	todo, err := r.liveTODO(todoID)
+	if err != nil {
+		return err
+	}
+
+	items := r.checklists[todoID]
+	for i, item := range items {
+		if item.ID != id {
+			continue
+		}
+		now := r.now()
+		for _, moved := range items[i+1:] {
+			moved.UpdatedAt = now
+		}
+		r.checklists[todoID] = append(items[:i], items[i+1:]...)
+		r.touchTODO(todo)
+		return nil
+	}
+
+	return &model.ErrNotFound{When: time.Now(), What: "Checklist Item Not Found.", Resource: model.ResourceChecklistItem}
+}
+
+// ReorderChecklist implements ChecklistRepository interface.
+func (r *MemoryTODORepository) ReorderChecklist(ctx context.Context, todoID int64, ids []int64) ([]*model.ChecklistItem, error) {
+	r.lock()
+	defer r.unlock()
+
+	todo, err := r.liveTODO(todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := r.checklists[todoID]
+	if !isChecklistOrder(items, ids) {
+		return nil, errChecklistOrder()
+	}
+
+	byID := make(map[int64]*model.ChecklistItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	now := r.now()
+	reordered := make([]*model.ChecklistItem, len(ids))
+	for i, id := range ids {
+		reordered[i] = byID[id]
+		if items[i].ID != id {
+			reordered[i].UpdatedAt = now
+		}
+	}
+	r.checklists[todoID] = reordered
+	r.touchTODO(todo)
+
+	return r.cloneChecklist(todoID), nil
+}
+
+// liveTODO returns the TODO by id out of the trash. r.mu must be locked.
+func (r *MemoryTODORepository) liveTODO(id int64) (*model.TODO, error) {
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt != nil {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found.", Resource: model.ResourceTODO}
+	}
+	return todo, nil
+}
+
+// touchTODO increments the version of todo, as its checklist changes, and
+// records the update. r.mu must be locked.
+func (r *MemoryTODORepository) touchTODO(todo *model.TODO) {
+	todo.UpdatedAt = r.now()
+	todo.Version++
+	r.recordEvent(model.TODOEventUpdated, todo)
+}
+
+// cloneChecklist returns copies of the items of the TODO by todoID with their
+// positions. r.mu must be locked.
+func (r *MemoryTODORepository) cloneChecklist(todoID int64) []*model.ChecklistItem {
+	items := make([]*model.ChecklistItem, len(r.checklists[todoID]))
+	for i, item := range r.checklists[todoID] {
+		c := *item
+		c.Position = i
+		items[i] = &c
+	}
+	return items
+}
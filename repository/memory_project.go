@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ ProjectRepository = (*MemoryTODORepository)(nil)
+
+// CreateProject implements ProjectRepository interface.
+func (r *MemoryTODORepository) CreateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	// same as the CHECK constraint of the projects table
+	if project.Name == "" {
+		return nil, model.NewErrValidation("name", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	r.lastProjectID++
+	now := r.now()
+	created := &model.Project{
+		ID:          r.lastProjectID,
+		Name:        project.Name,
+		Description: project.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.projects[created.ID] = created
+
+	return r.countProject(created), nil
+}
+
+// GetProject implements ProjectRepository interface.
+func (r *MemoryTODORepository) GetProject(ctx context.Context, id int64) (*model.Project, error) {
+	r.rlock()
+	defer r.runlock()
+
+	project, ok := r.projects[id]
+	if !ok {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Project Not Found.", Resource: model.ResourceProject}
+	}
+
+	return r.countProject(project), nil
+}
+
+// ListProjects implements ProjectRepository interface.
+func (r *MemoryTODORepository) ListProjects(ctx context.Context) ([]*model.Project, error) {
+	r.rlock()
+	defer r.runlock()
+
+	projects := make([]*model.Project, 0, len(r.projects))
+	for _, project := range r.projects {
+		projects = append(projects, r.countProject(project))
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ID < projects[j].ID
+	})
+
+	return projects, nil
+}
+
+// UpdateProject implements ProjectRepository interface.
+func (r *MemoryTODORepository) UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	// same as the CHECK constraint of the projects table
+	if project.Name == "" {
+		return nil, model.NewErrValidation("name", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	updated, ok := r.projects[project.ID]
+	if !ok {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Project Not Found.", Resource: model.ResourceProject}
+	}
+	updated.Name = project.Name
+	updated.Description = project.Description
+	updated.UpdatedAt = r.now()
+
+	return r.countProject(updated), nil
+}
+
+// DeleteProject implements ProjectRepository interface.
+func (r *MemoryTODORepository) DeleteProject(ctx context.Context, id int64, cascade bool) ([]int64, error) {
+	r.lock()
+	defer r.unlock()
+
+	project, ok := r.projects[id]
+	if !ok {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Project Not Found.", Resource: model.ResourceProject}
+	}
+	if counted := r.countProject(project); !cascade && counted.OpenCount+counted.DoneCount != 0 {
+		return nil, errProjectNotEmpty(id, counted.OpenCount+counted.DoneCount)
+	}
+
+	now := r.now()
+	var trashed []int64
+	for todoID := int64(1); todoID <= r.lastID; todoID++ {
+		todo, ok := r.todos[todoID]
+		if !ok || todo.ProjectID == nil || *todo.ProjectID != id {
+			continue
+		}
+		todo.ProjectID = nil
+		todo.UpdatedAt = now
+		todo.Version++
+		if todo.DeletedAt == nil {
+			todo.DeletedAt = &now
+			r.recordEvent(model.TODOEventDeleted, todo)
+			trashed = append(trashed, todo.ID)
+		}
+	}
+	delete(r.projects, id)
+
+	return trashed, nil
+}
+
+// countProject returns a copy of project with the counts of its TODOs. r.mu
+// must be locked.
+func (r *MemoryTODORepository) countProject(project *model.Project) *model.Project {
+	c := *project
+	for _, todo := range r.todos {
+		if todo.ProjectID == nil || *todo.ProjectID != project.ID || todo.DeletedAt != nil {
+			continue
+		}
+		if todo.CompletedAt == nil {
+			c.OpenCount++
+		} else {
+			c.DoneCount++
+		}
+	}
+	return &c
+}
+
+// hasProject reports whether id is nil or a project exists by id. r.mu must be
+// locked.
+func (r *MemoryTODORepository) hasProject(id *int64) bool {
+	if id == nil {
+		return true
+	}
+	_, ok := r.projects[*id]
+	return ok
+}
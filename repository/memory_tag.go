@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ TagRepository = (*MemoryTODORepository)(nil)
+
+// CreateTag implements TagRepository interface.
+func (r *MemoryTODORepository) CreateTag(ctx context.Context, name string) (*model.Tag, error) {
+	// same as the CHECK constraint of the tags table
+	if name == "" {
+		return nil, model.NewErrValidation("name", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	if r.findTag(name) != nil {
+		return nil, errTagExists(name)
+	}
+	tag := r.addTag(name)
+
+	c := *tag
+	return &c, nil
+}
+
+// GetTag implements TagRepository interface.
+func (r *MemoryTODORepository) GetTag(ctx context.Context, id int64) (*model.Tag, error) {
+	r.rlock()
+	defer r.runlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Tag Not Found.", Resource: model.ResourceTag}
+	}
+
+	c := *tag
+	return &c, nil
+}
+
+// ListTags implements TagRepository interface.
+func (r *MemoryTODORepository) ListTags(ctx context.Context) ([]*model.Tag, error) {
+	r.rlock()
+	defer r.runlock()
+
+	tags := make([]*model.Tag, 0, len(r.tags))
+	for _, tag := range r.tags {
+		c := *tag
+		tags = append(tags, &c)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return FoldCase(tags[i].Name) < FoldCase(tags[j].Name)
+	})
+
+	return tags, nil
+}
+
+// RenameTag implements TagRepository interface.
+func (r *MemoryTODORepository) RenameTag(ctx context.Context, id int64, name string) (*model.Tag, []int64, error) {
+	// same as the CHECK constraint of the tags table
+	if name == "" {
+		return nil, nil, model.NewErrValidation("name", "must not be empty")
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, nil, &model.ErrNotFound{When: time.Now(), What: "Tag Not Found.", Resource: model.ResourceTag}
+	}
+	if other := r.findTag(name); other != nil && other.ID != id {
+		return nil, nil, errTagExists(name)
+	}
+
+	tagged := r.changeTagged(tag.Name, func(tags []string, i int) []string {
+		tags[i] = name
+		return tags
+	})
+	tag.Name = name
+
+	c := *tag
+	return &c, tagged, nil
+}
+
+// DeleteTag implements TagRepository interface.
+func (r *MemoryTODORepository) DeleteTag(ctx context.Context, id int64) ([]int64, error) {
+	r.lock()
+	defer r.unlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Tag Not Found.", Resource: model.ResourceTag}
+	}
+
+	tagged := r.changeTagged(tag.Name, func(tags []string, i int) []string {
+		return append(tags[:i], tags[i+1:]...)
+	})
+	delete(r.tags, id)
+
+	return tagged, nil
+}
+
+// changeTagged applies fn to the tags of every TODO with the tag of name at
+// index i, and bumps their versions like the TODOs changed. The changes of the
+// TODOs out of the trash are recorded, and their ids returned.
+func (r *MemoryTODORepository) changeTagged(name string, fn func(tags []string, i int) []string) []int64 {
+	now := r.now()
+	var tagged []int64
+	for id := int64(1); id <= r.lastID; id++ {
+		todo, ok := r.todos[id]
+		if !ok {
+			continue
+		}
+		for i, tag := range todo.Tags {
+			if FoldCase(tag) != FoldCase(name) {
+				continue
+			}
+			todo.Tags = fn(todo.Tags, i)
+			sortTags(todo.Tags)
+			if len(todo.Tags) == 0 {
+				todo.Tags = nil
+			}
+			todo.UpdatedAt = now
+			todo.Version++
+			if todo.DeletedAt == nil {
+				r.recordEvent(model.TODOEventUpdated, todo)
+				tagged = append(tagged, id)
+			}
+			break
+		}
+	}
+	return tagged
+}
+
+// ensureTags returns the names of the tags of names, creating the missing
+// ones, in the order of SQLiteTODORepository. r.mu must be locked.
+func (r *MemoryTODORepository) ensureTags(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0, len(names))
+	for _, name := range distinctTags(names) {
+		tag := r.findTag(name)
+		if tag == nil {
+			tag = r.addTag(name)
+		}
+		tags = append(tags, tag.Name)
+	}
+	sortTags(tags)
+
+	return tags
+}
+
+// findTag returns the tag of name, or nil. r.mu must be locked.
+func (r *MemoryTODORepository) findTag(name string) *model.Tag {
+	for _, tag := range r.tags {
+		if FoldCase(tag.Name) == FoldCase(name) {
+			return tag
+		}
+	}
+	return nil
+}
+
+// addTag stores a new tag of name. r.mu must be locked.
+func (r *MemoryTODORepository) addTag(name string) *model.Tag {
+	r.lastTagID++
+	tag := &model.Tag{ID: r.lastTagID, Name: name, CreatedAt: r.now()}
+	r.tags[tag.ID] = tag
+	return tag
+}
+
+// sortTags sorts tag names like the NOCASE collation.
+func sortTags(tags []string) {
+	sort.Slice(tags, func(i, j int) bool {
+		return FoldCase(tags[i]) < FoldCase(tags[j])
+	})
+}
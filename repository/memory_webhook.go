@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ WebhookRepository = (*MemoryTODORepository)(nil)
+
+// CreateWebhook implements WebhookRepository interface.
+func (r *MemoryTODORepository) CreateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error) {
+	if err := checkWebhook(hook); err != nil {
+		return nil, err
+	}
+
+	r.lock()
+	defer r.unlock()
+
+	r.lastWebhookID++
+	now := r.now()
+	created := &model.Webhook{
+		ID:        r.lastWebhookID,
+		URL:       hook.URL,
+		Events:    cloneEvents(hook.Events),
+		Active:    hook.Active,
+		Secret:    hook.Secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.webhooks[created.ID] = created
+
+	return cloneWebhook(created), nil
+}
+
+// GetWebhook implements WebhookRepository interface.
+func (r *MemoryTODORepository) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	r.rlock()
+	defer r.runlock()
+
+	hook, ok := r.webhooks[id]
+	if !ok {
+		return nil, errNoWebhook()
+	}
+
+	return cloneWebhook(hook), nil
+}
+
+// ListWebhooks implements WebhookRepository interface.
+func (r *MemoryTODORepository) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	r.rlock()
+	defer r.runlock()
+
+	hooks := make([]*model.Webhook, 0, len(r.webhooks))
+	for id := int64(1); id <= r.lastWebhookID; id++ {
+		if hook, ok := r.webhooks[id]; ok {
+			hooks = append(hooks, cloneWebhook(hook))
+		}
+	}
+
+	return hooks, nil
+}
+
+// UpdateWebhook implements WebhookRepository interface.
+func (r *MemoryTODORepository) UpdateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error) {
+	r.lock()
+	defer r.unlock()
+
+	updated, ok := r.webhooks[hook.ID]
+	if !ok {
+		return nil, errNoWebhook()
+	}
+	secret := hook.Secret
+	if secret == "" {
+		secret = updated.Secret
+	}
+	if err := checkWebhook(&model.Webhook{URL: hook.URL, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	updated.URL = hook.URL
+	updated.Events = cloneEvents(hook.Events)
+	updated.Active = hook.Active
+	updated.Secret = secret
+	updated.UpdatedAt = r.now()
+
+	return cloneWebhook(updated), nil
+}
+
+// DeleteWebhook implements WebhookRepository interface.
+func (r *MemoryTODORepository) DeleteWebhook(ctx context.Context, id int64) error {
+	r.lock()
+	defer r.unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return errNoWebhook()
+	}
+	delete(r.webhooks, id)
+
+	// same as the trigger_webhooks_after_delete trigger
+	deliveries := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	r.deliveries = deliveries
+
+	return nil
+}
+
+// DispatchEvents implements WebhookRepository interface.
+func (r *MemoryTODORepository) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	r.lock()
+	defer r.unlock()
+
+	now := r.now()
+	// the deliveries hold copies of the events, which are dispatched at once
+	n := len(r.outbox)
+	if n > limit {
+		n = limit
+	}
+	for _, e := range r.outbox[:n] {
+		for id := int64(1); id <= r.lastWebhookID; id++ {
+			hook, ok := r.webhooks[id]
+			if !ok || !hook.Active || !subscribes(hook, e.Type) {
+				continue
+			}
+			r.lastDeliveryID++
+			next := now
+			event := e
+			r.deliveries = append(r.deliveries, &model.WebhookDelivery{
+				ID:            r.lastDeliveryID,
+				WebhookID:     hook.ID,
+				Event:         &event,
+				Status:        model.WebhookDeliveryPending,
+				NextAttemptAt: &next,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		}
+	}
+	r.outbox = append([]model.TODOEvent{}, r.outbox[n:]...)
+
+	return n, nil
+}
+
+// PruneDeliveries implements WebhookRepository interface.
+func (r *MemoryTODORepository) PruneDeliveries(ctx context.Context, t time.Time) (int64, error) {
+	r.lock()
+	defer r.unlock()
+
+	var n int64
+	deliveries := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if delivery.Status != model.WebhookDeliveryPending && delivery.UpdatedAt.Before(t) {
+			n++
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	r.deliveries = deliveries
+
+	return n, nil
+}
+
+// ClaimDeliveries implements WebhookRepository interface.
+func (r *MemoryTODORepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error) {
+	r.lock()
+	defer r.unlock()
+
+	leased := now.Add(lease).UTC().Truncate(time.Second)
+	deliveries := []*model.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if len(deliveries) == limit {
+			break
+		}
+		hook := r.webhooks[delivery.WebhookID]
+		if delivery.Status != model.WebhookDeliveryPending || delivery.NextAttemptAt.After(now) || !hook.Active {
+			continue
+		}
+
+		next := leased
+		delivery.NextAttemptAt = &next
+		claimed := cloneDelivery(delivery)
+		claimed.Webhook = cloneWebhook(hook)
+		deliveries = append(deliveries, claimed)
+	}
+
+	return deliveries, nil
+}
+
+// RecordDelivery implements WebhookRepository interface.
+func (r *MemoryTODORepository) RecordDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r.lock()
+	defer r.unlock()
+
+	recorded := r.findDelivery(delivery.ID)
+	if recorded == nil {
+		return &model.ErrNotFound{When: time.Now(), What: "Webhook Delivery Not Found.", Resource: model.ResourceWebhookDelivery}
+	}
+
+	recorded.Status = delivery.Status
+	recorded.Attempts = delivery.Attempts
+	recorded.NextAttemptAt = nil
+	if delivery.NextAttemptAt != nil {
+		next := delivery.NextAttemptAt.UTC().Truncate(time.Second)
+		recorded.NextAttemptAt = &next
+	}
+	recorded.LastStatusCode = delivery.LastStatusCode
+	recorded.LastError = delivery.LastError
+	recorded.UpdatedAt = r.now()
+
+	return nil
+}
+
+// ListDeliveries implements WebhookRepository interface.
+func (r *MemoryTODORepository) ListDeliveries(ctx context.Context, webhookID, prevID, size int64) ([]*model.WebhookDelivery, error) {
+	r.rlock()
+	defer r.runlock()
+
+	if _, ok := r.webhooks[webhookID]; !ok {
+		return nil, errNoWebhook()
+	}
+
+	deliveries := []*model.WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && int64(len(deliveries)) < size; i-- {
+		delivery := r.deliveries[i]
+		if delivery.WebhookID == webhookID && (prevID <= 0 || delivery.ID < prevID) {
+			deliveries = append(deliveries, cloneDelivery(delivery))
+		}
+	}
+
+	return deliveries, nil
+}
+
+// recordEvent records the event of the change of todo in the outbox, unless no
+// webhook subscribes to it. r.mu must be locked.
+func (r *MemoryTODORepository) recordEvent(typ model.TODOEventType, todo *model.TODO) {
+	subscribed := false
+	for _, hook := range r.webhooks {
+		subscribed = subscribed || (hook.Active && subscribes(hook, typ))
+	}
+	if !subscribed {
+		return
+	}
+
+	r.lastEventID++
+	event := model.TODOEvent{
+		ID:     r.lastEventID,
+		Type:   typ,
+		TODOID: todo.ID,
+		At:     r.now(),
+	}
+	if typ != model.TODOEventDeleted {
+		event.TODO = cloneTODO(todo)
+	}
+	r.outbox = append(r.outbox, event)
+}
+
+// findDelivery returns the delivery by id, or nil if missing. r.mu must be
+// locked.
+func (r *MemoryTODORepository) findDelivery(id int64) *model.WebhookDelivery {
+	for _, delivery := range r.deliveries {
+		if delivery.ID == id {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// checkWebhook does the same as the CHECK constraint of the webhooks table.
+func checkWebhook(hook *model.Webhook) error {
+	if hook.URL == "" {
+		return model.NewErrValidation("url", "must not be empty")
+	}
+	if hook.Secret == "" {
+		return model.NewErrValidation("secret", "must not be empty")
+	}
+	return nil
+}
+
+// subscribes reports whether hook subscribes to the events of typ.
+func subscribes(hook *model.Webhook, typ model.TODOEventType) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, event := range hook.Events {
+		if event == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneWebhook(hook *model.Webhook) *model.Webhook {
+	c := *hook
+	c.Events = cloneEvents(hook.Events)
+	return &c
+}
+
+func cloneEvents(events []model.TODOEventType) []model.TODOEventType {
+	return append([]model.TODOEventType{}, events...)
+}
+
+func cloneDelivery(delivery *model.WebhookDelivery) *model.WebhookDelivery {
+	c := *delivery
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		c.NextAttemptAt = &next
+	}
+	event := *delivery.Event
+	c.Event = &event
+	return &c
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A ProjectRepository stores Project entities, which are read with the counts
+// of their TODOs. Methods addressing a missing project return
+// *model.ErrNotFound.
+type ProjectRepository interface {
+	// CreateProject stores a new project with the name and description of
+	// project, and returns it.
+	CreateProject(ctx context.Context, project *model.Project) (*model.Project, error)
+	// GetProject returns the project by id.
+	GetProject(ctx context.Context, id int64) (*model.Project, error)
+	// ListProjects returns all projects in ascending order of id.
+	ListProjects(ctx context.Context) ([]*model.Project, error)
+	// UpdateProject overwrites the name and description of the project by
+	// the id of project, and returns it.
+	UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error)
+	// DeleteProject deletes the project, taking its TODOs in the trash out of
+	// it. It returns *model.ErrConflict if the project has TODOs out of the
+	// trash, unless cascade, which moves them to the trash as well and returns
+	// their ids.
+	DeleteProject(ctx context.Context, id int64, cascade bool) ([]int64, error)
+}
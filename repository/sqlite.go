@@ -0,0 +1,787 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A SQLiteTODORepository implements TODORepository on the SQLite database
+// returned by db.NewDB.
+type SQLiteTODORepository struct {
+	db *sql.DB
+	// tx is the transaction of the unit of work, if r runs in one.
+	tx *sql.Tx
+}
+
+var _ TODORepository = (*SQLiteTODORepository)(nil)
+
+// NewSQLiteTODORepository returns new SQLiteTODORepository.
+func NewSQLiteTODORepository(db *sql.DB) *SQLiteTODORepository {
+	return &SQLiteTODORepository{
+		db: db,
+	}
+}
+
+// Atomic implements TODORepository interface. A nested unit of work runs in
+// a savepoint.
+func (r *SQLiteTODORepository) Atomic(ctx context.Context, fn func(repo TODORepository) error) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SQLiteTODORepository{db: r.db, tx: tx})
+	})
+}
+
+// Create implements TODORepository interface.
+func (r *SQLiteTODORepository) Create(ctx context.Context, todo *model.TODO) (*model.TODO, error) {
+	const insert = `INSERT INTO todos(subject, description, due_at, project_id, priority) VALUES(?, ?, ?, ?, ?) RETURNING id`
+
+	var created *model.TODO
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := checkProject(ctx, tx, todo.ProjectID); err != nil {
+			return err
+		}
+
+		var id int64
+		err := tx.QueryRowContext(ctx, insert, todo.Subject, todo.Description, nullTime(todo.DueAt), todo.ProjectID, todo.Priority).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		if err := setTags(ctx, tx, id, todo.Tags); err != nil {
+			return err
+		}
+
+		if created, err = confirmTODO(ctx, tx, id); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, model.TODOEventCreated, id, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Get implements TODORepository interface.
+func (r *SQLiteTODORepository) Get(ctx context.Context, id int64) (*model.TODO, error) {
+	return getTODO(ctx, r.conn(), id)
+}
+
+// getTODO reads the TODO by id out of the trash with q.
+func getTODO(ctx context.Context, q querier, id int64) (*model.TODO, error) {
+	const read = `SELECT ` + todoColumns + ` FROM todos WHERE id = ? AND deleted_at IS NULL`
+
+	todo, err := scanTODO(q.QueryRowContext(ctx, read, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found.", Resource: model.ResourceTODO}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadTags(ctx, q, todo); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// List implements TODORepository interface.
+func (r *SQLiteTODORepository) List(ctx context.Context, prevID, size int64, filter model.TODOFilter) ([]*model.TODO, error) {
+	conds, args, err := filterConds(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Query != "" {
+		return r.search(ctx, prevID, size, filter.Query, conds, args)
+	}
+
+	columns, err := sortColumns(filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	after := filter.After
+	if after == nil && prevID > 0 {
+		// the TODO of prevID is read even in the trash, and compared by its id
+		// and zero values if it has been purged since
+		const prev = `SELECT ` + todoColumns + ` FROM todos WHERE id = ?`
+		after, err = scanTODO(r.conn().QueryRowContext(ctx, prev, prevID))
+		if errors.Is(err, sql.ErrNoRows) {
+			after, err = &model.TODO{ID: prevID}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		cond, condArgs := keysetCond(columns, after)
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+
+	order := make([]string, len(columns))
+	for i, column := range columns {
+		order[i] = column.expr
+		if column.desc {
+			order[i] += ` DESC`
+		}
+	}
+
+	read := `SELECT ` + todoColumns + ` FROM todos`
+	if len(conds) != 0 {
+		read += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	read += ` ORDER BY ` + strings.Join(order, `, `) + ` LIMIT ?`
+	args = append(args, size)
+
+	rows, err := r.conn().QueryContext(ctx, read, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*model.TODO{}
+	for rows.Next() {
+		todo, err := scanTODO(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadTags(ctx, r.conn(), todos...); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// Count implements TODORepository interface.
+func (r *SQLiteTODORepository) Count(ctx context.Context, filter model.TODOFilter) (int64, error) {
+	conds, args, err := filterConds(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if filter.Query != "" {
+		conds = append(conds, `id IN (SELECT docid FROM todos_fts WHERE todos_fts MATCH ?)`)
+		args = append(args, ftsQuery(filter.Query))
+	}
+
+	read := `SELECT COUNT(*) FROM todos`
+	if len(conds) != 0 {
+		read += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+
+	var n int64
+	if err := r.conn().QueryRowContext(ctx, read, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// search lists the TODOs matching the full-text search query in descending
+// order of rank, narrowed down by conds. prevID continues after that hit, by
+// comparing with the rank it has for the same query.
+func (r *SQLiteTODORepository) search(ctx context.Context, prevID, size int64, query string, conds []string, args []interface{}) ([]*model.TODO, error) {
+	// subject weighs twice as much as description
+	const hits = `WITH hits AS (
+  SELECT docid AS id,
+         fts_bm25(matchinfo(todos_fts, 'pcnalx'), 2.0, 1.0) AS rank,
+         snippet(todos_fts, '<mark>', '</mark>', '…', -1, 16) AS snippet
+  FROM todos_fts WHERE todos_fts MATCH ?
+)
+`
+
+	args = append([]interface{}{ftsQuery(query)}, args...)
+	if prevID > 0 {
+		conds = append(conds, `(rank < (SELECT rank FROM hits WHERE id = ?) OR (rank = (SELECT rank FROM hits WHERE id = ?) AND id < ?))`)
+		args = append(args, prevID, prevID, prevID)
+	}
+
+	read := hits + `SELECT ` + todoColumns + `, rank, snippet FROM todos JOIN hits USING (id)`
+	if len(conds) != 0 {
+		read += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	read += ` ORDER BY rank DESC, id DESC LIMIT ?`
+	args = append(args, size)
+
+	rows, err := r.conn().QueryContext(ctx, read, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*model.TODO{}
+	for rows.Next() {
+		var match model.TODOMatch
+		todo, err := scanTODO(rows, &match.Rank, &match.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		todo.Match = &match
+		todos = append(todos, todo)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadTags(ctx, r.conn(), todos...); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// Update implements TODORepository interface.
+func (r *SQLiteTODORepository) Update(ctx context.Context, todo *model.TODO, version int64) (*model.TODO, error) {
+	const update = `UPDATE todos SET subject = ?, description = ?, due_at = ?, project_id = ?, priority = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND ? IN (0, version)`
+
+	var updated *model.TODO
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := change(ctx, tx, todo.ID, version, update, todo.Subject, todo.Description, nullTime(todo.DueAt), todo.ProjectID, todo.Priority, todo.ID, version)
+		if err != nil {
+			return err
+		}
+
+		if err := checkProject(ctx, tx, todo.ProjectID); err != nil {
+			return err
+		}
+
+		if err := setTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+			return err
+		}
+
+		if updated, err = confirmTODO(ctx, tx, todo.ID); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, model.TODOEventUpdated, todo.ID, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// SetCompleted implements TODORepository interface.
+func (r *SQLiteTODORepository) SetCompleted(ctx context.Context, id int64, done bool) (*model.TODO, error) {
+	// the version stays when the TODO already is in the state
+	const (
+		complete   = `UPDATE todos SET completed_at = COALESCE(completed_at, DATETIME('now')), version = version + (completed_at IS NULL) WHERE id = ? AND deleted_at IS NULL`
+		uncomplete = `UPDATE todos SET completed_at = NULL, version = version + (completed_at IS NOT NULL) WHERE id = ? AND deleted_at IS NULL`
+	)
+
+	if done {
+		return r.updateAndConfirm(ctx, id, 0, complete, id)
+	}
+	return r.updateAndConfirm(ctx, id, 0, uncomplete, id)
+}
+
+// Delete implements TODORepository interface.
+func (r *SQLiteTODORepository) Delete(ctx context.Context, ids []int64, version int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	read := fmt.Sprintf(`SELECT id FROM todos WHERE id IN (%s) AND deleted_at IS NULL AND ? IN (0, version) ORDER BY id`, placeholders(len(ids)))
+
+	var deleted []int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// the TODOs deleted are read first to record their events
+		var err error
+		deleted, err = queryIDs(ctx, tx, read, append(int64Args(ids), version)...)
+		if err != nil {
+			return fmt.Errorf("failed to delete todos: %w", err)
+		}
+		if len(deleted) == 0 && version != 0 {
+			return notChanged(ctx, tx, ids[0], version)
+		}
+		if len(deleted) == 0 {
+			return &model.ErrNotFound{Resource: model.ResourceTODO}
+		}
+
+		query := fmt.Sprintf(`UPDATE todos SET deleted_at = DATETIME('now'), version = version + 1 WHERE id IN (%s)`, placeholders(len(deleted)))
+		if _, err := tx.ExecContext(ctx, query, int64Args(deleted)...); err != nil {
+			return fmt.Errorf("failed to delete todos: %w", err)
+		}
+
+		for _, id := range deleted {
+			if err := recordEvent(ctx, tx, model.TODOEventDeleted, id, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// Restore implements TODORepository interface.
+func (r *SQLiteTODORepository) Restore(ctx context.Context, id int64) (*model.TODO, error) {
+	const restore = `UPDATE todos SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL`
+	return r.updateAndConfirm(ctx, id, 0, restore, id)
+}
+
+// Purge implements TODORepository interface.
+func (r *SQLiteTODORepository) Purge(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`DELETE FROM todos WHERE id IN (%s) AND deleted_at IS NOT NULL`, placeholders(len(ids)))
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, int64Args(ids)...)
+		if err != nil {
+			return fmt.Errorf("failed to purge todos: %w", err)
+		}
+
+		purgedCount, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check affected rows: %w", err)
+		}
+		if purgedCount == 0 {
+			return &model.ErrNotFound{When: time.Now(), What: "Todo Not Found in Trash.", Resource: model.ResourceTODO}
+		}
+
+		return nil
+	})
+}
+
+// PurgeDeletedBefore implements TODORepository interface.
+func (r *SQLiteTODORepository) PurgeDeletedBefore(ctx context.Context, t time.Time) (int64, error) {
+	const purge = `DELETE FROM todos WHERE deleted_at < DATETIME(?)`
+
+	var n int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, purge, sqliteTime(t))
+		if err != nil {
+			return fmt.Errorf("failed to purge todos: %w", err)
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// notChanged tells why a change to the TODO by id conditioned on version
+// affected no row.
+func notChanged(ctx context.Context, q querier, id, version int64) error {
+	if _, err := getTODO(ctx, q, id); err != nil {
+		return err
+	}
+	return &model.ErrPreconditionFailed{ID: id}
+}
+
+// updateAndConfirm executes update conditioned on version and reads the TODO
+// by id, recording the update.
+func (r *SQLiteTODORepository) updateAndConfirm(ctx context.Context, id, version int64, update string, args ...interface{}) (*model.TODO, error) {
+	var updated *model.TODO
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := change(ctx, tx, id, version, update, args...); err != nil {
+			return err
+		}
+
+		var err error
+		if updated, err = confirmTODO(ctx, tx, id); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, model.TODOEventUpdated, id, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// change executes update of the TODO by id conditioned on version with q, and
+// tells why if it affected no row.
+func change(ctx context.Context, q querier, id, version int64, update string, args ...interface{}) error {
+	result, err := q.ExecContext(ctx, update, args...)
+	if err != nil {
+		return err
+	}
+
+	affectedRowCount, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRowCount == 0 && version != 0 {
+		return notChanged(ctx, q, id, version)
+	}
+	if affectedRowCount == 0 {
+		return &model.ErrNotFound{When: time.Now(), What: "Todo Not Found.", Resource: model.ResourceTODO}
+	}
+
+	return nil
+}
+
+// confirmTODO reads the TODO by id with q, even in the trash.
+func confirmTODO(ctx context.Context, q querier, id int64) (*model.TODO, error) {
+	const confirm = `SELECT ` + todoColumns + ` FROM todos WHERE id = ?`
+
+	todo, err := scanTODO(q.QueryRowContext(ctx, confirm, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadTags(ctx, q, todo); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// setTags replaces the tags of the TODO by id with names with q, creating the
+// missing tags.
+func setTags(ctx context.Context, q querier, id int64, names []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM todo_tags WHERE todo_id = ?`, id); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	values := strings.Repeat("(?),", len(names)-1) + "(?)"
+	insert := `INSERT INTO tags(name) VALUES` + values + ` ON CONFLICT(name) DO NOTHING`
+	if _, err := q.ExecContext(ctx, insert, stringArgs(names)...); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf(`INSERT INTO todo_tags(todo_id, tag_id) SELECT ?, id FROM tags WHERE name IN (%s)`, placeholders(len(names)))
+	_, err := q.ExecContext(ctx, link, append([]interface{}{id}, stringArgs(names)...)...)
+	return err
+}
+
+// loadTags reads the tags of todos with q in a single query.
+func loadTags(ctx context.Context, q querier, todos ...*model.TODO) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*model.TODO, len(todos))
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		byID[todo.ID] = todo
+		ids[i] = todo.ID
+	}
+
+	read := fmt.Sprintf(`SELECT todo_tags.todo_id, tags.name FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id
+WHERE todo_tags.todo_id IN (%s) ORDER BY tags.name`, placeholders(len(ids)))
+	rows, err := q.QueryContext(ctx, read, int64Args(ids)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, name)
+	}
+
+	return rows.Err()
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds and rolled
+// back otherwise. In a unit of work, fn runs in a savepoint of its
+// transaction instead, which is released or rolled back to likewise. The
+// transaction takes the write lock, so reads alone are made with r.conn().
+func (r *SQLiteTODORepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		return inSavepoint(ctx, r.tx, fn)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// inSavepoint runs fn in a savepoint of tx, which is released if fn succeeds
+// and rolled back to otherwise. Savepoints of the same name nest.
+func inSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT unit_of_work`); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if _, rerr := tx.ExecContext(ctx, `ROLLBACK TO unit_of_work`); rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		// rolling back to a savepoint leaves it open
+		if _, rerr := tx.ExecContext(ctx, `RELEASE unit_of_work`); rerr != nil {
+			return fmt.Errorf("%w (release failed: %v)", err, rerr)
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `RELEASE unit_of_work`)
+	return err
+}
+
+// conn returns the transaction of the unit of work r runs in, or else the DB.
+func (r *SQLiteTODORepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// A querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// filterConds returns the WHERE conditions of filter except Query.
+func filterConds(filter model.TODOFilter) ([]string, []interface{}, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if filter.Trashed {
+		conds = append(conds, `deleted_at IS NOT NULL`)
+	} else {
+		conds = append(conds, `deleted_at IS NULL`)
+	}
+	switch filter.Status {
+	case model.TODOStatusOpen:
+		conds = append(conds, `completed_at IS NULL`)
+	case model.TODOStatusDone:
+		conds = append(conds, `completed_at IS NOT NULL`)
+	case model.TODOStatusAll, "":
+	default:
+		return nil, nil, fmt.Errorf("unknown status: %q", filter.Status)
+	}
+	if filter.DueBefore != nil {
+		conds = append(conds, `due_at < ?`)
+		args = append(args, sqliteTime(*filter.DueBefore))
+	}
+	if filter.DueAfter != nil {
+		conds = append(conds, `due_at >= ?`)
+		args = append(args, sqliteTime(*filter.DueAfter))
+	}
+	if filter.Overdue {
+		conds = append(conds, `completed_at IS NULL AND due_at < DATETIME('now')`)
+	}
+	if len(filter.Tags) != 0 {
+		cond := `id IN (SELECT todo_id FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE tags.name IN (` + placeholders(len(filter.Tags)) + `)`
+		args = append(args, stringArgs(filter.Tags)...)
+		if !filter.AnyTag {
+			cond += ` GROUP BY todo_id HAVING COUNT(*) = ?`
+			args = append(args, len(distinctTags(filter.Tags)))
+		}
+		conds = append(conds, cond+`)`)
+	}
+	if filter.ProjectID != 0 {
+		conds = append(conds, `project_id = ?`)
+		args = append(args, filter.ProjectID)
+	}
+	return conds, args, nil
+}
+
+// A sortColumn expresses an expression of todos rows which TODOs are ordered
+// by, and how to get its value of a TODO.
+type sortColumn struct {
+	expr  string
+	desc  bool
+	value func(todo *model.TODO) interface{}
+}
+
+// sortColumns returns the columns to order TODOs by keys, ending with id so
+// that the order is total.
+func sortColumns(keys []model.TODOSortKey) ([]sortColumn, error) {
+	var columns []sortColumn
+	for _, key := range keys {
+		switch key.Field {
+		case model.TODOSortID:
+			// the later keys never matter after the unique id
+			return append(columns, sortColumn{`id`, key.Desc, func(todo *model.TODO) interface{} { return todo.ID }}), nil
+		case model.TODOSortPriority:
+			columns = append(columns, sortColumn{`priority`, key.Desc, func(todo *model.TODO) interface{} { return todo.Priority }})
+		case model.TODOSortCreatedAt:
+			columns = append(columns, sortColumn{`created_at`, key.Desc, func(todo *model.TODO) interface{} { return sqliteTime(todo.CreatedAt) }})
+		case model.TODOSortUpdatedAt:
+			columns = append(columns, sortColumn{`updated_at`, key.Desc, func(todo *model.TODO) interface{} { return sqliteTime(todo.UpdatedAt) }})
+		case model.TODOSortSubject:
+			columns = append(columns, sortColumn{`subject COLLATE NOCASE`, key.Desc, func(todo *model.TODO) interface{} { return todo.Subject }})
+		case model.TODOSortDueAt:
+			// the TODOs without a due time come last
+			columns = append(columns,
+				sortColumn{`due_at IS NULL`, false, func(todo *model.TODO) interface{} { return todo.DueAt == nil }},
+				sortColumn{`due_at`, key.Desc, func(todo *model.TODO) interface{} { return nullTime(todo.DueAt) }})
+		default:
+			return nil, fmt.Errorf("unknown sort: %q", key.Field)
+		}
+	}
+	return append(columns, sortColumn{`id`, true, func(todo *model.TODO) interface{} { return todo.ID }}), nil
+}
+
+// keysetCond returns the condition of the TODOs after the TODO after in the
+// order of columns: those equal to it on the first columns and past it on the
+// next one.
+func keysetCond(columns []sortColumn, after *model.TODO) (string, []interface{}) {
+	var (
+		ors  []string
+		args []interface{}
+	)
+	for i, column := range columns {
+		var ands []string
+		for _, equal := range columns[:i] {
+			ands = append(ands, `(`+equal.expr+`) IS ?`)
+			args = append(args, equal.value(after))
+		}
+		op := ` > ?`
+		if column.desc {
+			op = ` < ?`
+		}
+		ands = append(ands, `(`+column.expr+`)`+op)
+		args = append(args, column.value(after))
+		ors = append(ors, strings.Join(ands, ` AND `))
+	}
+	return `((` + strings.Join(ors, `) OR (`) + `))`, args
+}
+
+// todoColumns is the column list scanTODO expects.
+const todoColumns = `id, subject, description, project_id, priority, completed_at, due_at, deleted_at, created_at, updated_at, version`
+
+// A scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTODO scans a row selected with todoColumns, followed by columns
+// scanned into extra.
+func scanTODO(row scanner, extra ...interface{}) (*model.TODO, error) {
+	var (
+		todo                          model.TODO
+		projectID                     sql.NullInt64
+		completedAt, dueAt, deletedAt sql.NullTime
+	)
+	dest := []interface{}{&todo.ID, &todo.Subject, &todo.Description, &projectID, &todo.Priority, &completedAt, &dueAt, &deletedAt, &todo.CreatedAt, &todo.UpdatedAt, &todo.Version}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if projectID.Valid {
+		todo.ProjectID = &projectID.Int64
+	}
+	if completedAt.Valid {
+		todo.CompletedAt = &completedAt.Time
+	}
+	if dueAt.Valid {
+		// due times are shown in the time zone they were most likely given in
+		due := dueAt.Time.In(time.Local)
+		todo.DueAt = &due
+	}
+	if deletedAt.Valid {
+		todo.DeletedAt = &deletedAt.Time
+	}
+	return &todo, nil
+}
+
+// sqliteTime formats t like DATETIME('now') does, in UTC, so that stored
+// times compare correctly as text.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// nullTime returns t as a query argument for a nullable DATETIME column.
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// placeholders returns n comma separated placeholders for an IN clause.
+func placeholders(n int) string {
+	return strings.Repeat("?,", n-1) + "?"
+}
+
+// int64Args converts ids to query arguments.
+func int64Args(ids []int64) []interface{} {
+	args := make([]interface{}, len(ids), len(ids)+1)
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// queryIDs returns the ids selected by query with q.
+func queryIDs(ctx context.Context, q querier, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// stringArgs converts names to query arguments.
+func stringArgs(names []string) []interface{} {
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	return args
+}
+
+// ftsQuery quotes each term of query as a phrase, so that user input is
+// never parsed as the FTS query syntax. Terms are ANDed.
+func ftsQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ ChecklistRepository = (*SQLiteTODORepository)(nil)
+
+// ListChecklist implements ChecklistRepository interface.
+func (r *SQLiteTODORepository) ListChecklist(ctx context.Context, todoID int64) ([]*model.ChecklistItem, error) {
+	// read without a transaction, which would take the write lock
+	if _, err := getTODO(ctx, r.conn(), todoID); err != nil {
+		return nil, err
+	}
+
+	return listChecklist(ctx, r.conn(), todoID)
+}
+
+// AddChecklistItem implements ChecklistRepository interface.
+func (r *SQLiteTODORepository) AddChecklistItem(ctx context.Context, todoID int64, item *model.ChecklistItem) (*model.ChecklistItem, error) {
+	const (
+		count  = `SELECT COUNT(*) FROM checklist_items WHERE todo_id = ?`
+		shift  = `UPDATE checklist_items SET position = position + 1 WHERE todo_id = ? AND position >= ?`
+		insert = `INSERT INTO checklist_items(todo_id, position, text, done) VALUES(?, ?, ?, ?) RETURNING id`
+	)
+
+	var added *model.ChecklistItem
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := touchTODO(ctx, tx, todoID); err != nil {
+			return err
+		}
+
+		var n int
+		if err := tx.QueryRowContext(ctx, count, todoID).Scan(&n); err != nil {
+			return err
+		}
+		position := item.Position
+		if position < 0 || position > n {
+			position = n
+		}
+
+		if _, err := tx.ExecContext(ctx, shift, todoID, position); err != nil {
+			return err
+		}
+		var id int64
+		err := tx.QueryRowContext(ctx, insert, todoID, position, item.Text, item.Done).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		added, err = getChecklistItem(ctx, tx, todoID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// UpdateChecklistItem implements ChecklistRepository interface.
+func (r *SQLiteTODORepository) UpdateChecklistItem(ctx context.Context, todoID, id int64, patch *model.ChecklistItemPatch) (*model.ChecklistItem, error) {
+	const update = `UPDATE checklist_items SET text = COALESCE(?, text), done = COALESCE(?, done) WHERE id = ? AND todo_id = ?`
+
+	var updated *model.ChecklistItem
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := touchTODO(ctx, tx, todoID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, update, patch.Text, patch.Done, id, todoID)
+		if err != nil {
+			return err
+		}
+		affectedRowCount, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affectedRowCount == 0 {
+			return &model.ErrNotFound{When: time.Now(), What: "Checklist Item Not Found.", Resource: model.ResourceChecklistItem}
+		}
+
+		updated, err = getChecklistItem(ctx, tx, todoID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteChecklistItem implements ChecklistRepository interface.
+func (r *SQLiteTODORepository) DeleteChecklistItem(ctx context.Context, todoID, id int64) error {
+	const (
+		remove = `DELETE FROM checklist_items WHERE id = ?`
+		shift  = `UPDATE checklist_items SET position = position - 1 WHERE todo_id = ? AND position > ?`
+	)
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := touchTODO(ctx, tx, todoID); err != nil {
+			return err
+		}
+
+		item, err := getChecklistItem(ctx, tx, todoID, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, remove, id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, shift, todoID, item.Position)
+		return err
+	})
+}
+
+// ReorderChecklist implements ChecklistRepository interface.
+func (r *SQLiteTODORepository) ReorderChecklist(ctx context.Context, todoID int64, ids []int64) ([]*model.ChecklistItem, error) {
+	// the items staying at their positions are left unchanged
+	const move = `UPDATE checklist_items SET position = ? WHERE id = ? AND position <> ?`
+
+	var items []*model.ChecklistItem
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := touchTODO(ctx, tx, todoID); err != nil {
+			return err
+		}
+
+		current, err := listChecklist(ctx, tx, todoID)
+		if err != nil {
+			return err
+		}
+		if !isChecklistOrder(current, ids) {
+			return errChecklistOrder()
+		}
+
+		for i, id := range ids {
+			if _, err := tx.ExecContext(ctx, move, i, id, i); err != nil {
+				return err
+			}
+		}
+
+		items, err = listChecklist(ctx, tx, todoID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// touchTODO increments the version of the TODO by id with q, as its checklist
+// changes, and records the update.
+func touchTODO(ctx context.Context, q querier, id int64) error {
+	const touch = `UPDATE todos SET version = version + 1 WHERE id = ? AND deleted_at IS NULL`
+	if err := change(ctx, q, id, 0, touch, id); err != nil {
+		return err
+	}
+
+	todo, err := confirmTODO(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, q, model.TODOEventUpdated, id, todo)
+}
+
+// listChecklist reads the items of the TODO by todoID with q in order.
+func listChecklist(ctx context.Context, q querier, todoID int64) ([]*model.ChecklistItem, error) {
+	const read = `SELECT ` + checklistItemColumns + ` FROM checklist_items WHERE todo_id = ? ORDER BY position`
+
+	rows, err := q.QueryContext(ctx, read, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*model.ChecklistItem{}
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// getChecklistItem reads the item by id of the TODO by todoID with q.
+func getChecklistItem(ctx context.Context, q querier, todoID, id int64) (*model.ChecklistItem, error) {
+	const read = `SELECT ` + checklistItemColumns + ` FROM checklist_items WHERE id = ? AND todo_id = ?`
+
+	item, err := scanChecklistItem(q.QueryRowContext(ctx, read, id, todoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Checklist Item Not Found.", Resource: model.ResourceChecklistItem}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// checklistItemColumns is the column list scanChecklistItem expects.
+const checklistItemColumns = `id, text, done, position, created_at, updated_at`
+
+// scanChecklistItem scans a row selected with checklistItemColumns.
+func scanChecklistItem(row scanner) (*model.ChecklistItem, error) {
+	var item model.ChecklistItem
+	err := row.Scan(&item.ID, &item.Text, &item.Done, &item.Position, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// isChecklistOrder reports whether ids lists every item of items once.
+func isChecklistOrder(items []*model.ChecklistItem, ids []int64) bool {
+	if len(ids) != len(items) {
+		return false
+	}
+
+	listed := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		listed[id] = true
+	}
+	for _, item := range items {
+		if !listed[item.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// errChecklistOrder returns the error for ids not listing every item of a
+// checklist once.
+func errChecklistOrder() error {
+	return model.NewErrValidation("ids", "must list every item of the checklist once")
+}
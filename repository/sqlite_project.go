@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ ProjectRepository = (*SQLiteTODORepository)(nil)
+
+// CreateProject implements ProjectRepository interface.
+func (r *SQLiteTODORepository) CreateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	const insert = `INSERT INTO projects(name, description) VALUES(?, ?) RETURNING id`
+
+	var created *model.Project
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, insert, project.Name, project.Description).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		created, err = getProject(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetProject implements ProjectRepository interface.
+func (r *SQLiteTODORepository) GetProject(ctx context.Context, id int64) (*model.Project, error) {
+	return getProject(ctx, r.conn(), id)
+}
+
+// ListProjects implements ProjectRepository interface.
+func (r *SQLiteTODORepository) ListProjects(ctx context.Context) ([]*model.Project, error) {
+	const read = `SELECT ` + projectColumns + ` FROM ` + projectTables + ` GROUP BY projects.id ORDER BY projects.id`
+
+	rows, err := r.conn().QueryContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*model.Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// UpdateProject implements ProjectRepository interface.
+func (r *SQLiteTODORepository) UpdateProject(ctx context.Context, project *model.Project) (*model.Project, error) {
+	const update = `UPDATE projects SET name = ?, description = ? WHERE id = ?`
+
+	var updated *model.Project
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, update, project.Name, project.Description, project.ID)
+		if err != nil {
+			return err
+		}
+
+		affectedRowCount, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affectedRowCount == 0 {
+			return &model.ErrNotFound{When: time.Now(), What: "Project Not Found.", Resource: model.ResourceProject}
+		}
+
+		updated, err = getProject(ctx, tx, project.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteProject implements ProjectRepository interface.
+func (r *SQLiteTODORepository) DeleteProject(ctx context.Context, id int64, cascade bool) ([]int64, error) {
+	const (
+		read = `SELECT id FROM todos WHERE project_id = ? AND deleted_at IS NULL ORDER BY id`
+		// the TODOs out of the trash are moved to it on the way
+		leave  = `UPDATE todos SET deleted_at = COALESCE(deleted_at, DATETIME('now')), project_id = NULL, version = version + 1 WHERE project_id = ?`
+		remove = `DELETE FROM projects WHERE id = ?`
+	)
+
+	var trashed []int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getProject(ctx, tx, id); err != nil {
+			return err
+		}
+
+		// the TODOs moved to the trash are read first to record their events
+		ids, err := queryIDs(ctx, tx, read, id)
+		if err != nil {
+			return err
+		}
+		if !cascade && len(ids) != 0 {
+			return errProjectNotEmpty(id, int64(len(ids)))
+		}
+
+		if _, err := tx.ExecContext(ctx, leave, id); err != nil {
+			return fmt.Errorf("failed to take todos out of project: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, remove, id); err != nil {
+			return fmt.Errorf("failed to delete project: %w", err)
+		}
+
+		for _, id := range ids {
+			if err := recordEvent(ctx, tx, model.TODOEventDeleted, id, nil); err != nil {
+				return err
+			}
+		}
+		trashed = ids
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trashed, nil
+}
+
+// checkProject returns an error unless id is nil or a project exists by id
+// with q, since foreign keys are not enforced.
+func checkProject(ctx context.Context, q querier, id *int64) error {
+	if id == nil {
+		return nil
+	}
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM projects WHERE id = ?)`, *id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errNoProject()
+	}
+	return nil
+}
+
+// getProject reads the project by id with q.
+func getProject(ctx context.Context, q querier, id int64) (*model.Project, error) {
+	const read = `SELECT ` + projectColumns + ` FROM ` + projectTables + ` WHERE projects.id = ? GROUP BY projects.id`
+
+	project, err := scanProject(q.QueryRowContext(ctx, read, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Project Not Found.", Resource: model.ResourceProject}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// projectColumns is the column list scanProject expects, which counts the
+// TODOs joined by projectTables grouped by project.
+const projectColumns = `projects.id, projects.name, projects.description,
+  COUNT(todos.id) - COUNT(todos.completed_at), COUNT(todos.completed_at),
+  projects.created_at, projects.updated_at`
+
+// projectTables joins the projects with their TODOs out of the trash.
+const projectTables = `projects LEFT JOIN todos ON todos.project_id = projects.id AND todos.deleted_at IS NULL`
+
+// scanProject scans a row selected with projectColumns.
+func scanProject(row scanner) (*model.Project, error) {
+	var project model.Project
+	err := row.Scan(&project.ID, &project.Name, &project.Description, &project.OpenCount, &project.DoneCount, &project.CreatedAt, &project.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// errProjectNotEmpty returns the error for deleting the project by id which
+// has n TODOs out of the trash.
+func errProjectNotEmpty(id, n int64) error {
+	return &model.ErrConflict{What: fmt.Sprintf("project %d has %d todos out of the trash", id, n)}
+}
+
+// errNoProject returns the error for a TODO saved in a missing project.
+func errNoProject() error {
+	return model.NewErrValidation("project_id", "must be an existing project")
+}
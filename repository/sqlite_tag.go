@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ TagRepository = (*SQLiteTODORepository)(nil)
+
+// CreateTag implements TagRepository interface.
+func (r *SQLiteTODORepository) CreateTag(ctx context.Context, name string) (*model.Tag, error) {
+	const insert = `INSERT INTO tags(name) VALUES(?) RETURNING id`
+
+	var created *model.Tag
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, insert, name).Scan(&id)
+		if isUniqueViolation(err) {
+			return errTagExists(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		created, err = getTag(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetTag implements TagRepository interface.
+func (r *SQLiteTODORepository) GetTag(ctx context.Context, id int64) (*model.Tag, error) {
+	return getTag(ctx, r.conn(), id)
+}
+
+// ListTags implements TagRepository interface.
+func (r *SQLiteTODORepository) ListTags(ctx context.Context) ([]*model.Tag, error) {
+	const read = `SELECT ` + tagColumns + ` FROM tags ORDER BY name, id`
+
+	rows, err := r.conn().QueryContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*model.Tag{}
+	for rows.Next() {
+		var tag model.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// RenameTag implements TagRepository interface.
+func (r *SQLiteTODORepository) RenameTag(ctx context.Context, id int64, name string) (*model.Tag, []int64, error) {
+	const rename = `UPDATE tags SET name = ? WHERE id = ?`
+
+	var (
+		renamed *model.Tag
+		tagged  []int64
+	)
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, rename, name, id)
+		if isUniqueViolation(err) {
+			return errTagExists(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tagChanged(result); err != nil {
+			return err
+		}
+		if tagged, err = bumpTagged(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := recordUpdated(ctx, tx, tagged); err != nil {
+			return err
+		}
+
+		renamed, err = getTag(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return renamed, tagged, nil
+}
+
+// DeleteTag implements TagRepository interface.
+func (r *SQLiteTODORepository) DeleteTag(ctx context.Context, id int64) ([]int64, error) {
+	// the trigger_tags_after_delete trigger unlinks the TODOs
+	const remove = `DELETE FROM tags WHERE id = ?`
+
+	var tagged []int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// the TODOs are found by the links, so before they are gone
+		var err error
+		if tagged, err = bumpTagged(ctx, tx, id); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, remove, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete tag: %w", err)
+		}
+		if err := tagChanged(result); err != nil {
+			return err
+		}
+		return recordUpdated(ctx, tx, tagged)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tagged, nil
+}
+
+// tagChanged returns *model.ErrNotFound if result changed no tag.
+func tagChanged(result sql.Result) error {
+	affectedRowCount, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRowCount == 0 {
+		return &model.ErrNotFound{When: time.Now(), What: "Tag Not Found.", Resource: model.ResourceTag}
+	}
+	return nil
+}
+
+// bumpTagged increments the version of the TODOs with the tag by id with q,
+// as they change with the tag, and returns the ids of the ones out of the
+// trash.
+func bumpTagged(ctx context.Context, q querier, id int64) ([]int64, error) {
+	const (
+		read = `SELECT todo_id FROM todo_tags JOIN todos ON todos.id = todo_tags.todo_id WHERE tag_id = ? AND deleted_at IS NULL ORDER BY todo_id`
+		bump = `UPDATE todos SET version = version + 1 WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ?)`
+	)
+
+	ids, err := queryIDs(ctx, q, read, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.ExecContext(ctx, bump, id); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// getTag reads the tag by id with q.
+func getTag(ctx context.Context, q querier, id int64) (*model.Tag, error) {
+	const read = `SELECT ` + tagColumns + ` FROM tags WHERE id = ?`
+
+	var tag model.Tag
+	err := q.QueryRowContext(ctx, read, id).Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &model.ErrNotFound{When: time.Now(), What: "Tag Not Found.", Resource: model.ResourceTag}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// tagColumns is the column list of tags read by getTag and ListTags.
+const tagColumns = `id, name, created_at`
+
+// errTagExists returns the error for name taken by another tag.
+func errTagExists(name string) error {
+	return &model.ErrConflict{What: fmt.Sprintf("tag %q already exists", name)}
+}
+
+// isUniqueViolation reports whether err violates a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+var _ WebhookRepository = (*SQLiteTODORepository)(nil)
+
+// CreateWebhook implements WebhookRepository interface.
+func (r *SQLiteTODORepository) CreateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error) {
+	const insert = `INSERT INTO webhooks(url, secret, events, active) VALUES(?, ?, ?, ?) RETURNING id`
+
+	var created *model.Webhook
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, insert, hook.URL, hook.Secret, joinEvents(hook.Events), hook.Active).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		created, err = getWebhook(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetWebhook implements WebhookRepository interface.
+func (r *SQLiteTODORepository) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	return getWebhook(ctx, r.conn(), id)
+}
+
+// ListWebhooks implements WebhookRepository interface.
+func (r *SQLiteTODORepository) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	const read = `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`
+
+	rows, err := r.conn().QueryContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*model.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// UpdateWebhook implements WebhookRepository interface.
+func (r *SQLiteTODORepository) UpdateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error) {
+	const update = `UPDATE webhooks SET url = ?, events = ?, active = ?, secret = COALESCE(NULLIF(?, ''), secret) WHERE id = ?`
+
+	var updated *model.Webhook
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, update, hook.URL, joinEvents(hook.Events), hook.Active, hook.Secret, hook.ID)
+		if err != nil {
+			return err
+		}
+
+		affectedRowCount, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affectedRowCount == 0 {
+			return errNoWebhook()
+		}
+
+		updated, err = getWebhook(ctx, tx, hook.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteWebhook implements WebhookRepository interface.
+func (r *SQLiteTODORepository) DeleteWebhook(ctx context.Context, id int64) error {
+	const remove = `DELETE FROM webhooks WHERE id = ?`
+
+	// the trigger_webhooks_after_delete trigger deletes the deliveries
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, remove, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+
+		affectedRowCount, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check affected rows: %w", err)
+		}
+		if affectedRowCount == 0 {
+			return errNoWebhook()
+		}
+
+		return nil
+	})
+}
+
+// DispatchEvents implements WebhookRepository interface.
+func (r *SQLiteTODORepository) DispatchEvents(ctx context.Context, limit int) (int, error) {
+	const (
+		read  = `SELECT id, type FROM outbox WHERE dispatched_at IS NULL ORDER BY id LIMIT ?`
+		queue = `INSERT INTO webhook_deliveries(webhook_id, event_id, next_attempt_at)
+SELECT id, ?, DATETIME('now') FROM webhooks WHERE ` + subscribed + ` ORDER BY id`
+		dispatch = `UPDATE outbox SET dispatched_at = DATETIME('now') WHERE id = ?`
+		// the events no webhook subscribes to any more are of no use
+		drop = `DELETE FROM outbox WHERE id = ?`
+	)
+
+	var n int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, read, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		type event struct {
+			id  int64
+			typ string
+		}
+		var events []event
+		for rows.Next() {
+			var e event
+			if err := rows.Scan(&e.id, &e.typ); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, e := range events {
+			result, err := tx.ExecContext(ctx, queue, e.id, e.typ)
+			if err != nil {
+				return fmt.Errorf("failed to queue deliveries: %w", err)
+			}
+			queued, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			finish := dispatch
+			if queued == 0 {
+				finish = drop
+			}
+			if _, err := tx.ExecContext(ctx, finish, e.id); err != nil {
+				return fmt.Errorf("failed to dispatch event: %w", err)
+			}
+		}
+		n = len(events)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// PruneDeliveries implements WebhookRepository interface.
+func (r *SQLiteTODORepository) PruneDeliveries(ctx context.Context, t time.Time) (int64, error) {
+	// the trigger_webhook_deliveries_after_delete trigger removes the events
+	// with no delivery left
+	const prune = `DELETE FROM webhook_deliveries WHERE status <> 'pending' AND updated_at < DATETIME(?)`
+
+	var n int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, prune, sqliteTime(t))
+		if err != nil {
+			return fmt.Errorf("failed to prune deliveries: %w", err)
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// ClaimDeliveries implements WebhookRepository interface.
+func (r *SQLiteTODORepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error) {
+	const read = `SELECT ` + deliveryColumns + `, ` + webhookColumns + ` FROM ` + deliveryTables + `
+WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= DATETIME(?) AND webhooks.active
+ORDER BY webhook_deliveries.id LIMIT ?`
+
+	var deliveries []*model.WebhookDelivery
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, read, sqliteTime(now), limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		deliveries = []*model.WebhookDelivery{}
+		for rows.Next() {
+			var hook webhookRow
+			delivery, err := scanDelivery(rows, hook.dest()...)
+			if err != nil {
+				return err
+			}
+			delivery.Webhook = hook.webhook()
+			deliveries = append(deliveries, delivery)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.ID
+		}
+		leased := now.Add(lease)
+		claim := fmt.Sprintf(`UPDATE webhook_deliveries SET next_attempt_at = DATETIME(?) WHERE id IN (%s)`, placeholders(len(ids)))
+		if _, err := tx.ExecContext(ctx, claim, append([]interface{}{sqliteTime(leased)}, int64Args(ids)...)...); err != nil {
+			return fmt.Errorf("failed to claim deliveries: %w", err)
+		}
+
+		for _, delivery := range deliveries {
+			at := leased.UTC().Truncate(time.Second)
+			delivery.NextAttemptAt = &at
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordDelivery implements WebhookRepository interface.
+func (r *SQLiteTODORepository) RecordDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	const update = `UPDATE webhook_deliveries
+SET status = ?, attempts = ?, next_attempt_at = DATETIME(?), last_status_code = ?, last_error = ?
+WHERE id = ?`
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, update, delivery.Status, delivery.Attempts, nullTime(delivery.NextAttemptAt),
+			delivery.LastStatusCode, delivery.LastError, delivery.ID)
+		if err != nil {
+			return fmt.Errorf("failed to record delivery: %w", err)
+		}
+
+		affectedRowCount, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check affected rows: %w", err)
+		}
+		if affectedRowCount == 0 {
+			return &model.ErrNotFound{When: time.Now(), What: "Webhook Delivery Not Found.", Resource: model.ResourceWebhookDelivery}
+		}
+
+		return nil
+	})
+}
+
+// ListDeliveries implements WebhookRepository interface.
+func (r *SQLiteTODORepository) ListDeliveries(ctx context.Context, webhookID, prevID, size int64) ([]*model.WebhookDelivery, error) {
+	const read = `SELECT ` + deliveryColumns + ` FROM ` + deliveryTables + `
+WHERE webhook_deliveries.webhook_id = ? AND (? <= 0 OR webhook_deliveries.id < ?)
+ORDER BY webhook_deliveries.id DESC LIMIT ?`
+
+	// read without a transaction, which would take the write lock
+	if _, err := getWebhook(ctx, r.conn(), webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.conn().QueryContext(ctx, read, webhookID, prevID, prevID, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// recordUpdated records the update events of the TODOs by ids with q, reading
+// them as changed, in the transaction of the change.
+func recordUpdated(ctx context.Context, q querier, ids []int64) error {
+	for _, id := range ids {
+		todo, err := getTODO(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, q, model.TODOEventUpdated, id, todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribed is the condition of the webhooks to deliver the events of the
+// type given as its argument to. The events are matched as whole items of the
+// comma separated list.
+const subscribed = `active AND (events = '' OR INSTR(',' || events || ',', ',' || ? || ',') > 0)`
+
+// recordEvent records the event of the change of the TODO by id in the outbox
+// with q, in the transaction of the change, unless no webhook subscribes to it.
+// todo is nil when it was deleted.
+func recordEvent(ctx context.Context, q querier, typ model.TODOEventType, id int64, todo *model.TODO) error {
+	const insert = `INSERT INTO outbox(type, todo_id, todo)
+SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM webhooks WHERE ` + subscribed + `)`
+
+	var payload interface{}
+	if todo != nil {
+		b, err := json.Marshal(todo)
+		if err != nil {
+			return err
+		}
+		payload = string(b)
+	}
+
+	if _, err := q.ExecContext(ctx, insert, typ, id, payload, typ); err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	return nil
+}
+
+// getWebhook reads the webhook by id with q.
+func getWebhook(ctx context.Context, q querier, id int64) (*model.Webhook, error) {
+	const read = `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+
+	hook, err := scanWebhook(q.QueryRowContext(ctx, read, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNoWebhook()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// webhookColumns is the column list scanWebhook expects.
+const webhookColumns = `webhooks.id, webhooks.url, webhooks.secret, webhooks.events, webhooks.active, webhooks.created_at, webhooks.updated_at`
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row scanner) (*model.Webhook, error) {
+	var hook webhookRow
+	if err := row.Scan(hook.dest()...); err != nil {
+		return nil, err
+	}
+	return hook.webhook(), nil
+}
+
+// A webhookRow is a webhook scanned with webhookColumns, along with a row of
+// other columns.
+type webhookRow struct {
+	hook   model.Webhook
+	events string
+}
+
+// dest returns the scan destinations of webhookColumns.
+func (w *webhookRow) dest() []interface{} {
+	return []interface{}{&w.hook.ID, &w.hook.URL, &w.hook.Secret, &w.events, &w.hook.Active, &w.hook.CreatedAt, &w.hook.UpdatedAt}
+}
+
+// webhook returns the webhook scanned.
+func (w *webhookRow) webhook() *model.Webhook {
+	w.hook.Events = splitEvents(w.events)
+	return &w.hook
+}
+
+// joinEvents returns events as stored in the events column of webhooks.
+func joinEvents(events []model.TODOEventType) string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = string(event)
+	}
+	return strings.Join(names, ",")
+}
+
+// splitEvents parses the events column of webhooks.
+func splitEvents(s string) []model.TODOEventType {
+	events := []model.TODOEventType{}
+	if s == "" {
+		return events
+	}
+	for _, name := range strings.Split(s, ",") {
+		events = append(events, model.TODOEventType(name))
+	}
+	return events
+}
+
+// deliveryColumns is the column list scanDelivery expects, read from
+// deliveryTables.
+const (
+	deliveryColumns = `webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.status, webhook_deliveries.attempts,
+webhook_deliveries.next_attempt_at, webhook_deliveries.last_status_code, webhook_deliveries.last_error,
+webhook_deliveries.created_at, webhook_deliveries.updated_at,
+outbox.id, outbox.type, outbox.todo_id, outbox.todo, outbox.created_at`
+	deliveryTables = `webhook_deliveries JOIN outbox ON outbox.id = webhook_deliveries.event_id
+JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id`
+)
+
+// scanDelivery scans a row selected with deliveryColumns, followed by columns
+// scanned into extra.
+func scanDelivery(row scanner, extra ...interface{}) (*model.WebhookDelivery, error) {
+	var (
+		delivery      model.WebhookDelivery
+		event         model.TODOEvent
+		nextAttemptAt sql.NullTime
+		todo          sql.NullString
+	)
+	dest := []interface{}{&delivery.ID, &delivery.WebhookID, &delivery.Status, &delivery.Attempts,
+		&nextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.UpdatedAt,
+		&event.ID, &event.Type, &event.TODOID, &todo, &event.At}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if todo.Valid {
+		if err := json.Unmarshal([]byte(todo.String), &event.TODO); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+	}
+	delivery.Event = &event
+	return &delivery, nil
+}
+
+// errNoWebhook returns the error for a missing webhook.
+func errNoWebhook() error {
+	return &model.ErrNotFound{When: time.Now(), What: "Webhook Not Found.", Resource: model.ResourceWebhook}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A TagRepository stores Tag entities. Tags are created by name when a TODO
+// is saved with them, so the names of TODOs and tags always agree.
+// Methods addressing a missing tag return *model.ErrNotFound, and a name
+// taken by another tag is *model.ErrConflict.
+type TagRepository interface {
+	// CreateTag stores a new tag and returns it.
+	CreateTag(ctx context.Context, name string) (*model.Tag, error)
+	// GetTag returns the tag by id.
+	GetTag(ctx context.Context, id int64) (*model.Tag, error)
+	// ListTags returns all tags in alphabetical order of name.
+	ListTags(ctx context.Context) ([]*model.Tag, error)
+	// RenameTag changes the name of the tag and returns it. The TODOs with
+	// the tag change as well, and the ids of the ones out of the trash are
+	// returned.
+	RenameTag(ctx context.Context, id int64, name string) (*model.Tag, []int64, error)
+	// DeleteTag removes the tag from every TODO and deletes it. It returns the
+	// ids of the TODOs out of the trash which had the tag.
+	DeleteTag(ctx context.Context, id int64) ([]int64, error)
+}
+
+// distinctTags returns names without the ones equal to an earlier one, with
+// ASCII letters compared case-insensitively like the NOCASE collation.
+func distinctTags(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	distinct := make([]string, 0, len(names))
+	for _, name := range names {
+		key := FoldCase(name)
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, name)
+		}
+	}
+	return distinct
+}
+
+// FoldCase folds the ASCII letters of s to lower case like the NOCASE
+// collation, by which tag names are compared.
+func FoldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A TODORepository stores TODO entities.
+// Methods addressing a missing TODO return *model.ErrNotFound. TODOs in the
+// trash are missing for every method but List, Count, Restore and Purge.
+// Every change to a TODO increments its Version. Methods taking version change
+// the TODO only at that version and return *model.ErrPreconditionFailed
+// otherwise, unless version is 0.
+type TODORepository interface {
+	TagRepository
+	ProjectRepository
+	ChecklistRepository
+	WebhookRepository
+
+	// Create stores a new TODO with the subject, description, due time, tags,
+	// project and priority of todo, and returns it. Missing tags are created, while a
+	// missing project is *model.ErrValidation.
+	Create(ctx context.Context, todo *model.TODO) (*model.TODO, error)
+	// Get returns the TODO by id.
+	Get(ctx context.Context, id int64) (*model.TODO, error)
+	// List returns at most size TODOs matching filter in the order of
+	// filter.Sort, continuing after filter.After or else the TODO of prevID.
+	// prevID <= 0 means from the first TODO.
+	// If filter has a Query, the TODOs are in descending order of rank
+	// instead, continuing after the TODO of prevID, and each has a Match.
+	List(ctx context.Context, prevID, size int64, filter model.TODOFilter) ([]*model.TODO, error)
+	// Count returns the number of TODOs matching filter.
+	Count(ctx context.Context, filter model.TODOFilter) (int64, error)
+	// Update overwrites the subject, description, due time, tags, project and
+	// priority of the TODO by the id of todo, and returns it. Missing tags are created,
+	// while a missing project is *model.ErrValidation.
+	Update(ctx context.Context, todo *model.TODO, version int64) (*model.TODO, error)
+	// SetCompleted marks the TODO done or not done and returns it.
+	// Marking a done TODO keeps its original completion time.
+	SetCompleted(ctx context.Context, id int64, done bool) (*model.TODO, error)
+	// Delete moves the TODOs by ids to the trash and returns the ids of the
+	// ones moved in ascending order, leaving out the missing, the trashed and
+	// the duplicated. It returns *model.ErrNotFound if none of them exist.
+	// version is meant for deleting a single TODO.
+	Delete(ctx context.Context, ids []int64, version int64) ([]int64, error)
+	// Restore moves the TODO back from the trash and returns it.
+	Restore(ctx context.Context, id int64) (*model.TODO, error)
+	// Purge removes the TODOs by ids in the trash permanently. It returns
+	// *model.ErrNotFound if none of them are in the trash.
+	Purge(ctx context.Context, ids []int64) error
+	// PurgeDeletedBefore removes the TODOs moved to the trash before t
+	// permanently and returns how many were removed.
+	PurgeDeletedBefore(ctx context.Context, t time.Time) (int64, error)
+
+	// Atomic runs fn as a unit of work with a TODORepository whose changes
+	// are all kept if fn succeeds, and all discarded otherwise. Others see
+	// none of them until fn returns. Atomic of the TODORepository given to fn
+	// runs nested in the same unit of work, discarding only its own changes
+	// on failure. The TODORepository must not be used after fn returns.
+	Atomic(ctx context.Context, fn func(repo TODORepository) error) error
+}
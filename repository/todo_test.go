@@ -0,0 +1,1277 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+)
+
+// newRepositories returns every TODORepository implementation, each empty.
+func newRepositories(t *testing.T) map[string]repository.TODORepository {
+	t.Helper()
+
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "repository_test.db"))
+	if err != nil {
+		t.Fatal("failed to create db, err =", err)
+	}
+	t.Cleanup(func() {
+		if err := d.Close(); err != nil {
+			t.Error("failed to close db, err =", err)
+		}
+	})
+
+	return map[string]repository.TODORepository{
+		"SQLite": repository.NewSQLiteTODORepository(d),
+		"Memory": repository.NewMemoryTODORepository(),
+	}
+}
+
+func TestTODORepository(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, subject := range []string{"first", "second", "third"} {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: subject}); err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+			}
+			if _, err := repo.Create(ctx, &model.TODO{}); err == nil {
+				t.Error("expected an error for an empty subject")
+			}
+
+			todo, err := repo.Update(ctx, &model.TODO{ID: 2, Subject: "second updated", Description: "description"}, 1)
+			if err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			if todo.ID != 2 || todo.Subject != "second updated" || todo.Description != "description" || todo.Version != 2 {
+				t.Errorf("unexpected todo, given = %+v", todo)
+			}
+
+			todo, err = repo.SetCompleted(ctx, 3, true)
+			if err != nil {
+				t.Fatal("failed to complete todo, err =", err)
+			}
+			if todo.CompletedAt == nil || todo.Version != 2 {
+				t.Errorf("unexpected todo, given = %+v", todo)
+			}
+			// completing a done TODO changes nothing
+			if todo, err = repo.SetCompleted(ctx, 3, true); err != nil || todo.Version != 2 {
+				t.Errorf("unexpected todo, given = %+v, err = %v", todo, err)
+			}
+
+			var preconditionFailed *model.ErrPreconditionFailed
+			if _, err := repo.Update(ctx, &model.TODO{ID: 2, Subject: "stale"}, 1); !errors.As(err, &preconditionFailed) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrPreconditionFailed", err)
+			}
+			if _, err := repo.Delete(ctx, []int64{2}, 1); !errors.As(err, &preconditionFailed) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrPreconditionFailed", err)
+			}
+
+			cases := map[string]struct {
+				prevID int64
+				size   int64
+				filter model.TODOFilter
+				want   []int64
+			}{
+				"All":              {size: 5, filter: model.TODOFilter{Status: model.TODOStatusAll}, want: []int64{3, 2, 1}},
+				"Limited":          {size: 2, filter: model.TODOFilter{Status: model.TODOStatusAll}, want: []int64{3, 2}},
+				"After prev id":    {prevID: 3, size: 5, filter: model.TODOFilter{Status: model.TODOStatusAll}, want: []int64{2, 1}},
+				"Open":             {size: 5, filter: model.TODOFilter{Status: model.TODOStatusOpen}, want: []int64{2, 1}},
+				"Done":             {size: 5, filter: model.TODOFilter{Status: model.TODOStatusDone}, want: []int64{3}},
+				"Open after prev":  {prevID: 2, size: 5, filter: model.TODOFilter{Status: model.TODOStatusOpen}, want: []int64{1}},
+				"Done after prev":  {prevID: 3, size: 5, filter: model.TODOFilter{Status: model.TODOStatusDone}, want: []int64{}},
+				"Prev id too high": {prevID: 100, size: 1, filter: model.TODOFilter{Status: model.TODOStatusAll}, want: []int64{3}},
+			}
+			for name, c := range cases {
+				todos, err := repo.List(ctx, c.prevID, c.size, c.filter)
+				if err != nil {
+					t.Fatalf("%s: failed to list todos, err = %v", name, err)
+				}
+				given := make([]int64, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.ID
+				}
+				if len(given) != len(c.want) {
+					t.Errorf("%s: unexpected ids, given = %v, expected = %v", name, given, c.want)
+					continue
+				}
+				for i := range given {
+					if given[i] != c.want[i] {
+						t.Errorf("%s: unexpected ids, given = %v, expected = %v", name, given, c.want)
+						break
+					}
+				}
+			}
+
+			// the missing and the duplicated are left out
+			if deleted, err := repo.Delete(ctx, []int64{1, 100, 1}, 0); err != nil || fmt.Sprint(deleted) != "[1]" {
+				t.Errorf("failed to delete todo, deleted = %v, err = %v", deleted, err)
+			}
+
+			var notFound *model.ErrNotFound
+			if _, err := repo.Get(ctx, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.Update(ctx, &model.TODO{ID: 1, Subject: "subject"}, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.Delete(ctx, []int64{1}, 0); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTODORepositorySearch(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, todo := range []struct{ subject, description string }{
+				{"buy milk", "from the store"},
+				{"write report", "milk sales report"},
+				{"milk the cow", "milk milk"},
+				{"walk the dog", ""},
+				{"Milk!", ""},
+			} {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: todo.subject, Description: todo.description}); err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+			}
+			if _, err := repo.SetCompleted(ctx, 5, true); err != nil {
+				t.Fatal("failed to complete todo, err =", err)
+			}
+
+			cases := map[string]struct {
+				prevID int64
+				size   int64
+				filter model.TODOFilter
+				want   []int64
+			}{
+				"Ranked":         {size: 5, filter: model.TODOFilter{Query: "milk"}, want: []int64{3, 5, 1, 2}},
+				"Paged":          {prevID: 5, size: 2, filter: model.TODOFilter{Query: "milk"}, want: []int64{1, 2}},
+				"All terms":      {size: 5, filter: model.TODOFilter{Query: "MILK report"}, want: []int64{2}},
+				"With status":    {size: 5, filter: model.TODOFilter{Query: "milk", Status: model.TODOStatusOpen}, want: []int64{3, 1, 2}},
+				"No hits":        {size: 5, filter: model.TODOFilter{Query: "cat"}, want: []int64{}},
+				"Query syntax":   {size: 5, filter: model.TODOFilter{Query: `"milk OR dog*`}, want: []int64{}},
+				"Unknown prevID": {prevID: 4, size: 5, filter: model.TODOFilter{Query: "milk"}, want: []int64{}},
+			}
+			for name, c := range cases {
+				todos, err := repo.List(ctx, c.prevID, c.size, c.filter)
+				if err != nil {
+					t.Fatalf("%s: failed to search todos, err = %v", name, err)
+				}
+				given := make([]int64, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.ID
+					if todo.Match == nil || todo.Match.Rank <= 0 || !strings.Contains(todo.Match.Snippet, "<mark>") {
+						t.Errorf("%s: unexpected match, given = %+v", name, todo.Match)
+					}
+				}
+				if fmt.Sprint(given) != fmt.Sprint(c.want) {
+					t.Errorf("%s: unexpected ids, given = %v, expected = %v", name, given, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTODORepositoryTrash(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, subject := range []string{"first", "second", "third"} {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: subject}); err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+			}
+			if _, err := repo.Delete(ctx, []int64{1, 2}, 0); err != nil {
+				t.Fatal("failed to delete todos, err =", err)
+			}
+
+			ids := func(filter model.TODOFilter) string {
+				todos, err := repo.List(ctx, 0, 10, filter)
+				if err != nil {
+					t.Fatal("failed to list todos, err =", err)
+				}
+				given := make([]int64, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.ID
+					if (todo.DeletedAt != nil) != filter.Trashed {
+						t.Errorf("unexpected deleted_at, given = %+v", todo)
+					}
+				}
+				return fmt.Sprint(given)
+			}
+			if given := ids(model.TODOFilter{}); given != "[3]" {
+				t.Errorf("unexpected ids, given = %s, expected = [3]", given)
+			}
+			if given := ids(model.TODOFilter{Trashed: true}); given != "[2 1]" {
+				t.Errorf("unexpected trashed ids, given = %s, expected = [2 1]", given)
+			}
+			if n, err := repo.Count(ctx, model.TODOFilter{Trashed: true}); err != nil || n != 2 {
+				t.Errorf("unexpected count, given = %d, err = %v, expected = 2", n, err)
+			}
+
+			var notFound *model.ErrNotFound
+			if _, err := repo.Get(ctx, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.SetCompleted(ctx, 1, true); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.Delete(ctx, []int64{1}, 2); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.Restore(ctx, 3); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if err := repo.Purge(ctx, []int64{3}); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+
+			todo, err := repo.Restore(ctx, 1)
+			if err != nil {
+				t.Fatal("failed to restore todo, err =", err)
+			}
+			if todo.DeletedAt != nil || todo.Version != 3 {
+				t.Errorf("unexpected todo, given = %+v", todo)
+			}
+			if err := repo.Purge(ctx, []int64{2}); err != nil {
+				t.Error("failed to purge todo, err =", err)
+			}
+			if _, err := repo.Restore(ctx, 2); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+
+			if _, err := repo.Delete(ctx, []int64{3}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+			if n, err := repo.PurgeDeletedBefore(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+				t.Errorf("unexpected purged count, given = %d, err = %v, expected = 0", n, err)
+			}
+			if n, err := repo.PurgeDeletedBefore(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+				t.Errorf("unexpected purged count, given = %d, err = %v, expected = 1", n, err)
+			}
+			if given := ids(model.TODOFilter{Trashed: true}); given != "[]" {
+				t.Errorf("unexpected trashed ids, given = %s, expected = []", given)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryDue(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, todo := range []*model.TODO{
+				{Subject: "long overdue", DueAt: at(-48 * time.Hour)},
+				{Subject: "no due"},
+				{Subject: "tomorrow", DueAt: at(24 * time.Hour)},
+				{Subject: "overdue but done", DueAt: at(-24 * time.Hour)},
+				{Subject: "later", DueAt: at(48 * time.Hour)},
+			} {
+				created, err := repo.Create(ctx, todo)
+				if err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+				if (created.DueAt == nil) != (todo.DueAt == nil) || (todo.DueAt != nil && !created.DueAt.Equal(*todo.DueAt)) {
+					t.Errorf("unexpected due_at, given = %v, expected = %v", created.DueAt, todo.DueAt)
+				}
+			}
+			if _, err := repo.SetCompleted(ctx, 4, true); err != nil {
+				t.Fatal("failed to complete todo, err =", err)
+			}
+
+			cases := map[string]struct {
+				prevID int64
+				filter model.TODOFilter
+				want   []int64
+			}{
+				"Sort by due":         {filter: model.TODOFilter{Sort: []model.TODOSortKey{{Field: model.TODOSortDueAt}}}, want: []int64{1, 4, 3, 5, 2}},
+				"Sort by due paged":   {prevID: 3, filter: model.TODOFilter{Sort: []model.TODOSortKey{{Field: model.TODOSortDueAt}}}, want: []int64{5, 2}},
+				"Sort by due at null": {prevID: 2, filter: model.TODOFilter{Sort: []model.TODOSortKey{{Field: model.TODOSortDueAt}}}, want: []int64{}},
+				"Due before":          {filter: model.TODOFilter{DueBefore: &now}, want: []int64{4, 1}},
+				"Due after":           {filter: model.TODOFilter{DueAfter: &now}, want: []int64{5, 3}},
+				"Due between":         {filter: model.TODOFilter{DueAfter: at(-30 * time.Hour), DueBefore: at(30 * time.Hour)}, want: []int64{4, 3}},
+				"Due after inclusive": {filter: model.TODOFilter{DueAfter: at(48 * time.Hour)}, want: []int64{5}},
+				"Overdue":             {filter: model.TODOFilter{Overdue: true}, want: []int64{1}},
+				"Overdue by due":      {filter: model.TODOFilter{Overdue: true, Sort: []model.TODOSortKey{{Field: model.TODOSortDueAt}}}, want: []int64{1}},
+			}
+			for name, c := range cases {
+				todos, err := repo.List(ctx, c.prevID, 10, c.filter)
+				if err != nil {
+					t.Fatalf("%s: failed to list todos, err = %v", name, err)
+				}
+				given := make([]int64, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.ID
+				}
+				if fmt.Sprint(given) != fmt.Sprint(c.want) {
+					t.Errorf("%s: unexpected ids, given = %v, expected = %v", name, given, c.want)
+				}
+				if n, err := repo.Count(ctx, c.filter); c.prevID == 0 && (err != nil || n != int64(len(c.want))) {
+					t.Errorf("%s: unexpected count, given = %d, err = %v, expected = %d", name, n, err, len(c.want))
+				}
+			}
+
+			todo, err := repo.Update(ctx, &model.TODO{ID: 1, Subject: "no longer due"}, 0)
+			if err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			if todo.DueAt != nil {
+				t.Errorf("unexpected due_at, given = %v, expected = nil", todo.DueAt)
+			}
+		})
+	}
+}
+
+func TestTODORepositorySort(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, todo := range []*model.TODO{
+				{Subject: "banana", Priority: 2, DueAt: at(24 * time.Hour)},
+				{Subject: "Apple", Priority: 4},
+				{Subject: "cherry", Priority: 2, DueAt: at(-24 * time.Hour)},
+				{Subject: "apple", DueAt: at(24 * time.Hour)},
+				{Subject: "Banana", Priority: 4, DueAt: at(48 * time.Hour)},
+			} {
+				created, err := repo.Create(ctx, todo)
+				if err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+				if created.Priority != todo.Priority {
+					t.Errorf("unexpected priority, given = %d, expected = %d", created.Priority, todo.Priority)
+				}
+			}
+			if _, err := repo.Create(ctx, &model.TODO{Subject: "too important", Priority: model.MaxTODOPriority + 1}); err == nil {
+				t.Error("expected an error for a priority out of range")
+			}
+
+			cases := map[string]struct {
+				sort []model.TODOSortKey
+				want []int64
+			}{
+				"Default":                {want: []int64{5, 4, 3, 2, 1}},
+				"Ascending id":           {sort: []model.TODOSortKey{{Field: model.TODOSortID}}, want: []int64{1, 2, 3, 4, 5}},
+				"Priority":               {sort: []model.TODOSortKey{{Field: model.TODOSortPriority, Desc: true}}, want: []int64{5, 2, 3, 1, 4}},
+				"Priority then due":      {sort: []model.TODOSortKey{{Field: model.TODOSortPriority}, {Field: model.TODOSortDueAt}}, want: []int64{4, 3, 1, 5, 2}},
+				"Subject ignoring case":  {sort: []model.TODOSortKey{{Field: model.TODOSortSubject}}, want: []int64{4, 2, 5, 1, 3}},
+				"Descending subject":     {sort: []model.TODOSortKey{{Field: model.TODOSortSubject, Desc: true}}, want: []int64{3, 5, 1, 4, 2}},
+				"Descending due at null": {sort: []model.TODOSortKey{{Field: model.TODOSortDueAt, Desc: true}}, want: []int64{5, 4, 1, 3, 2}},
+				"Id before other keys":   {sort: []model.TODOSortKey{{Field: model.TODOSortID}, {Field: model.TODOSortPriority}}, want: []int64{1, 2, 3, 4, 5}},
+			}
+			for name, c := range cases {
+				todos, err := repo.List(ctx, 0, 10, model.TODOFilter{Sort: c.sort})
+				if err != nil {
+					t.Fatalf("%s: failed to list todos, err = %v", name, err)
+				}
+				if given := fmt.Sprint(todoIDs(todos)); given != fmt.Sprint(c.want) {
+					t.Errorf("%s: unexpected ids, given = %s, expected = %v", name, given, c.want)
+				}
+
+				// pages continue after the last TODO either way
+				var byAfter, byPrevID []int64
+				var after *model.TODO
+				for prevID := int64(0); len(byPrevID) < len(c.want); {
+					page, err := repo.List(ctx, 0, 2, model.TODOFilter{Sort: c.sort, After: after})
+					if err != nil || len(page) == 0 {
+						t.Fatalf("%s: failed to list page after %v, err = %v", name, after, err)
+					}
+					after = page[len(page)-1]
+					byAfter = append(byAfter, todoIDs(page)...)
+
+					if page, err = repo.List(ctx, prevID, 2, model.TODOFilter{Sort: c.sort}); err != nil || len(page) == 0 {
+						t.Fatalf("%s: failed to list page after %d, err = %v", name, prevID, err)
+					}
+					prevID = page[len(page)-1].ID
+					byPrevID = append(byPrevID, todoIDs(page)...)
+				}
+				if fmt.Sprint(byAfter) != fmt.Sprint(c.want) || fmt.Sprint(byPrevID) != fmt.Sprint(c.want) {
+					t.Errorf("%s: unexpected paged ids, given = %v and %v, expected = %v", name, byAfter, byPrevID, c.want)
+				}
+			}
+
+			updated, err := repo.Update(ctx, &model.TODO{ID: 2, Subject: "Apple", Priority: 1}, 0)
+			if err != nil || updated.Priority != 1 {
+				t.Fatalf("failed to update priority, given = %v, err = %v", updated, err)
+			}
+			if updated, err = repo.Update(ctx, &model.TODO{ID: 2, Subject: "Apple"}, 0); err != nil || updated.Priority != 0 {
+				t.Fatalf("failed to clear priority, given = %v, err = %v", updated, err)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryTags(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for i, c := range []struct {
+				tags []string
+				want string
+			}{
+				{tags: []string{"work", "Urgent"}, want: "[Urgent work]"},
+				{tags: []string{"WORK"}, want: "[work]"},
+				{tags: []string{"home"}, want: "[home]"},
+				{want: "[]"},
+			} {
+				todo, err := repo.Create(ctx, &model.TODO{Subject: fmt.Sprint("todo ", i+1), Tags: c.tags})
+				if err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+				if given := fmt.Sprint(todo.Tags); given != c.want {
+					t.Errorf("unexpected tags, given = %s, expected = %s", given, c.want)
+				}
+			}
+
+			tags, err := repo.ListTags(ctx)
+			if err != nil {
+				t.Fatal("failed to list tags, err =", err)
+			}
+			ids := make(map[string]int64, len(tags))
+			names := make([]string, len(tags))
+			for i, tag := range tags {
+				ids[tag.Name] = tag.ID
+				names[i] = tag.Name
+			}
+			if fmt.Sprint(names) != "[home Urgent work]" {
+				t.Errorf("unexpected tags, given = %v, expected = [home Urgent work]", names)
+			}
+
+			cases := map[string]struct {
+				filter model.TODOFilter
+				want   string
+			}{
+				"All of tags":        {filter: model.TODOFilter{Tags: []string{"work", "urgent"}}, want: "[1]"},
+				"Any of tags":        {filter: model.TODOFilter{Tags: []string{"urgent", "HOME"}, AnyTag: true}, want: "[3 1]"},
+				"Duplicated tags":    {filter: model.TODOFilter{Tags: []string{"work", "Work"}}, want: "[2 1]"},
+				"Unknown tag":        {filter: model.TODOFilter{Tags: []string{"work", "later"}}, want: "[]"},
+				"Unknown tag of any": {filter: model.TODOFilter{Tags: []string{"work", "later"}, AnyTag: true}, want: "[2 1]"},
+			}
+			for name, c := range cases {
+				todos, err := repo.List(ctx, 0, 10, c.filter)
+				if err != nil {
+					t.Fatalf("%s: failed to list todos, err = %v", name, err)
+				}
+				given := make([]int64, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.ID
+				}
+				if fmt.Sprint(given) != c.want {
+					t.Errorf("%s: unexpected ids, given = %v, expected = %s", name, given, c.want)
+				}
+				if n, err := repo.Count(ctx, c.filter); err != nil || n != int64(len(given)) {
+					t.Errorf("%s: unexpected count, given = %d, err = %v, expected = %d", name, n, err, len(given))
+				}
+			}
+
+			var conflict *model.ErrConflict
+			if _, err := repo.CreateTag(ctx, "Work"); !errors.As(err, &conflict) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrConflict", err)
+			}
+			if _, _, err := repo.RenameTag(ctx, ids["Urgent"], "HOME"); !errors.As(err, &conflict) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrConflict", err)
+			}
+			tag, err := repo.CreateTag(ctx, "later")
+			if err != nil || tag.Name != "later" {
+				t.Errorf("unexpected tag, given = %+v, err = %v", tag, err)
+			}
+
+			tag, tagged, err := repo.RenameTag(ctx, ids["work"], "job")
+			if err != nil || tag.Name != "job" || fmt.Sprint(tagged) != "[1 2]" {
+				t.Fatalf("unexpected tag, given = %+v %v, err = %v", tag, tagged, err)
+			}
+			todo, err := repo.Get(ctx, 1)
+			if err != nil {
+				t.Fatal("failed to get todo, err =", err)
+			}
+			if fmt.Sprint(todo.Tags) != "[job Urgent]" || todo.Version != 2 {
+				t.Errorf("unexpected todo after rename, given = %+v", todo)
+			}
+
+			if todo, err = repo.Update(ctx, &model.TODO{ID: 1, Subject: "todo 1", Tags: []string{"home"}}, 2); err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			if fmt.Sprint(todo.Tags) != "[home]" {
+				t.Errorf("unexpected tags after update, given = %v", todo.Tags)
+			}
+
+			if tagged, err := repo.DeleteTag(ctx, ids["home"]); err != nil || fmt.Sprint(tagged) != "[1 3]" {
+				t.Fatalf("unexpected todos of deleted tag, given = %v, err = %v", tagged, err)
+			}
+			for id, version := range map[int64]int64{1: 4, 3: 2} {
+				todo, err := repo.Get(ctx, id)
+				if err != nil || todo.Tags != nil || todo.Version != version {
+					t.Errorf("unexpected todo after delete, given = %+v, err = %v", todo, err)
+				}
+			}
+
+			var notFound *model.ErrNotFound
+			if _, err := repo.GetTag(ctx, ids["home"]); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.DeleteTag(ctx, ids["home"]); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, _, err := repo.RenameTag(ctx, ids["home"], "away"); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryProjects(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			work, err := repo.CreateProject(ctx, &model.Project{Name: "work", Description: "at the office"})
+			if err != nil {
+				t.Fatal("failed to create project, err =", err)
+			}
+			home, err := repo.CreateProject(ctx, &model.Project{Name: "home"})
+			if err != nil {
+				t.Fatal("failed to create project, err =", err)
+			}
+
+			for i, projectID := range []*int64{&work.ID, &work.ID, &work.ID, &home.ID, nil} {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: fmt.Sprint("todo ", i+1), ProjectID: projectID}); err != nil {
+					t.Fatal("failed to create todo, err =", err)
+				}
+			}
+			if _, err := repo.SetCompleted(ctx, 2, true); err != nil {
+				t.Fatal("failed to complete todo, err =", err)
+			}
+			if _, err := repo.Delete(ctx, []int64{3}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+
+			var invalid *model.ErrValidation
+			missing := int64(99)
+			if _, err := repo.Create(ctx, &model.TODO{Subject: "lost", ProjectID: &missing}); !errors.As(err, &invalid) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrValidation", err)
+			}
+			if _, err := repo.Update(ctx, &model.TODO{ID: 5, Subject: "lost", ProjectID: &missing}, 0); !errors.As(err, &invalid) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrValidation", err)
+			}
+
+			projects, err := repo.ListProjects(ctx)
+			if err != nil {
+				t.Fatal("failed to list projects, err =", err)
+			}
+			given := make([]string, len(projects))
+			for i, p := range projects {
+				given[i] = fmt.Sprintf("%s:%d/%d", p.Name, p.OpenCount, p.DoneCount)
+			}
+			if fmt.Sprint(given) != "[work:1/1 home:1/0]" {
+				t.Errorf("unexpected projects, given = %v, expected = [work:1/1 home:1/0]", given)
+			}
+
+			todos, err := repo.List(ctx, 0, 10, model.TODOFilter{ProjectID: work.ID})
+			if err != nil {
+				t.Fatal("failed to list todos, err =", err)
+			}
+			ids := make([]int64, len(todos))
+			for i, todo := range todos {
+				ids[i] = todo.ID
+			}
+			if fmt.Sprint(ids) != "[2 1]" {
+				t.Errorf("unexpected ids, given = %v, expected = [2 1]", ids)
+			}
+
+			project, err := repo.UpdateProject(ctx, &model.Project{ID: home.ID, Name: "house"})
+			if err != nil || project.Name != "house" || project.OpenCount != 1 {
+				t.Errorf("unexpected project, given = %+v, err = %v", project, err)
+			}
+
+			var conflict *model.ErrConflict
+			if _, err := repo.DeleteProject(ctx, work.ID, false); !errors.As(err, &conflict) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrConflict", err)
+			}
+			if ids, err := repo.DeleteProject(ctx, work.ID, true); err != nil || fmt.Sprint(ids) != "[1 2]" {
+				t.Fatalf("unexpected todos of deleted project, given = %v, err = %v", ids, err)
+			}
+			trashed, err := repo.List(ctx, 0, 10, model.TODOFilter{Trashed: true})
+			if err != nil {
+				t.Fatal("failed to list trash, err =", err)
+			}
+			if len(trashed) != 3 {
+				t.Errorf("unexpected trash, given = %d todos, expected = 3", len(trashed))
+			}
+			for _, todo := range trashed {
+				if todo.ProjectID != nil {
+					t.Errorf("unexpected project of todo %d, given = %d", todo.ID, *todo.ProjectID)
+				}
+			}
+
+			if _, err := repo.Update(ctx, &model.TODO{ID: 4, Subject: "todo 4"}, 0); err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			if _, err := repo.DeleteProject(ctx, home.ID, false); err != nil {
+				t.Errorf("failed to delete empty project, err = %v", err)
+			}
+
+			var notFound *model.ErrNotFound
+			if _, err := repo.GetProject(ctx, home.ID); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.UpdateProject(ctx, &model.Project{ID: home.ID, Name: "home"}); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.DeleteProject(ctx, home.ID, true); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryChecklist(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if _, err := repo.Create(ctx, &model.TODO{Subject: "todo"}); err != nil {
+				t.Fatal("failed to create todo, err =", err)
+			}
+
+			// texts returns the texts of the checklist like [a b] with the
+			// positions checked.
+			texts := func(items []*model.ChecklistItem) string {
+				given := make([]string, len(items))
+				for i, item := range items {
+					given[i] = item.Text
+					if item.Done {
+						given[i] += "!"
+					}
+					if item.Position != i {
+						t.Errorf("unexpected position of %s, given = %d, expected = %d", item.Text, item.Position, i)
+					}
+				}
+				return fmt.Sprint(given)
+			}
+
+			for _, c := range []struct {
+				text     string
+				position int
+				want     int
+			}{
+				{text: "b", position: -1, want: 0},
+				{text: "d", position: 5, want: 1},
+				{text: "a", position: 0, want: 0},
+				{text: "c", position: 2, want: 2},
+			} {
+				item, err := repo.AddChecklistItem(ctx, 1, &model.ChecklistItem{Text: c.text, Position: c.position})
+				if err != nil {
+					t.Fatal("failed to add item, err =", err)
+				}
+				if item.Position != c.want {
+					t.Errorf("unexpected position of %s, given = %d, expected = %d", c.text, item.Position, c.want)
+				}
+			}
+
+			items, err := repo.ListChecklist(ctx, 1)
+			if err != nil {
+				t.Fatal("failed to list checklist, err =", err)
+			}
+			if given := texts(items); given != "[a b c d]" {
+				t.Errorf("unexpected checklist, given = %s, expected = [a b c d]", given)
+			}
+			ids := make(map[string]int64, len(items))
+			for _, item := range items {
+				ids[item.Text] = item.ID
+			}
+
+			done := true
+			item, err := repo.UpdateChecklistItem(ctx, 1, ids["b"], &model.ChecklistItemPatch{Done: &done})
+			if err != nil || item.Text != "b" || !item.Done {
+				t.Errorf("unexpected item, given = %+v, err = %v", item, err)
+			}
+			if err := repo.DeleteChecklistItem(ctx, 1, ids["a"]); err != nil {
+				t.Fatal("failed to delete item, err =", err)
+			}
+			items, err = repo.ReorderChecklist(ctx, 1, []int64{ids["d"], ids["b"], ids["c"]})
+			if err != nil {
+				t.Fatal("failed to reorder checklist, err =", err)
+			}
+			if given := texts(items); given != "[d b! c]" {
+				t.Errorf("unexpected checklist, given = %s, expected = [d b! c]", given)
+			}
+
+			var invalid *model.ErrValidation
+			for _, order := range [][]int64{{ids["d"], ids["b"]}, {ids["d"], ids["b"], ids["b"]}, {ids["d"], ids["b"], ids["a"]}} {
+				if _, err := repo.ReorderChecklist(ctx, 1, order); !errors.As(err, &invalid) {
+					t.Errorf("unexpected error of %v, given = %v, expected = *model.ErrValidation", order, err)
+				}
+			}
+
+			var notFound *model.ErrNotFound
+			if _, err := repo.UpdateChecklistItem(ctx, 1, ids["a"], &model.ChecklistItemPatch{Done: &done}); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if err := repo.DeleteChecklistItem(ctx, 1, ids["a"]); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+
+			// 1 for creating, and 1 for each change of the checklist
+			todo, err := repo.Get(ctx, 1)
+			if err != nil || todo.Version != 8 {
+				t.Errorf("unexpected todo, given = %+v, err = %v, expected version = 8", todo, err)
+			}
+
+			if _, err := repo.Delete(ctx, []int64{1}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+			if _, err := repo.ListChecklist(ctx, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.AddChecklistItem(ctx, 1, &model.ChecklistItem{Text: "e"}); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryWebhooks(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			for _, hook := range []*model.Webhook{
+				{URL: "http://example.com/all", Active: true, Secret: "secret1"},
+				{URL: "http://example.com/deleted", Events: []model.TODOEventType{model.TODOEventDeleted}, Active: true, Secret: "secret2"},
+				{URL: "http://example.com/inactive", Secret: "secret3"},
+			} {
+				if _, err := repo.CreateWebhook(ctx, hook); err != nil {
+					t.Fatal("failed to create webhook, err =", err)
+				}
+			}
+			hooks, err := repo.ListWebhooks(ctx)
+			if err != nil || len(hooks) != 3 || hooks[1].Events[0] != model.TODOEventDeleted || len(hooks[0].Events) != 0 || hooks[2].Active {
+				t.Fatalf("unexpected webhooks, given = %+v, err = %v", hooks, err)
+			}
+
+			// the failed update records no event
+			if _, err := repo.Create(ctx, &model.TODO{Subject: "todo"}); err != nil {
+				t.Fatal("failed to create todo, err =", err)
+			}
+			if _, err := repo.Update(ctx, &model.TODO{ID: 1, Subject: "todo updated"}, 1); err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			if _, err := repo.Update(ctx, &model.TODO{ID: 1, Subject: "stale"}, 1); err == nil {
+				t.Error("expected an error for a stale version")
+			}
+			if _, err := repo.Delete(ctx, []int64{1}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+
+			for _, c := range []struct {
+				limit int
+				want  int
+			}{{limit: 2, want: 2}, {limit: 10, want: 1}, {limit: 10, want: 0}} {
+				if n, err := repo.DispatchEvents(ctx, c.limit); err != nil || n != c.want {
+					t.Errorf("unexpected events dispatched, given = %d, err = %v, expected = %d", n, err, c.want)
+				}
+			}
+
+			// types returns the event types of deliveries like [todo.created].
+			types := func(deliveries []*model.WebhookDelivery) string {
+				given := make([]string, len(deliveries))
+				for i, delivery := range deliveries {
+					given[i] = string(delivery.Event.Type)
+				}
+				return fmt.Sprint(given)
+			}
+			for id, want := range map[int64]string{
+				1: "[todo.deleted todo.updated todo.created]",
+				2: "[todo.deleted]",
+				3: "[]",
+			} {
+				deliveries, err := repo.ListDeliveries(ctx, id, 0, 10)
+				if err != nil || types(deliveries) != want {
+					t.Errorf("unexpected deliveries of webhook %d, given = %s, err = %v, expected = %s", id, types(deliveries), err, want)
+				}
+			}
+
+			now := time.Now()
+			claimed, err := repo.ClaimDeliveries(ctx, now, time.Minute, 10)
+			if err != nil || len(claimed) != 4 {
+				t.Fatalf("unexpected deliveries claimed, given = %d, err = %v, expected = 4", len(claimed), err)
+			}
+			if first := claimed[0]; first.Webhook == nil || first.Webhook.Secret != "secret1" || first.Event.TODO == nil || first.Event.TODO.Subject != "todo" {
+				t.Errorf("unexpected delivery, given = %+v", first)
+			}
+			if last := claimed[3]; last.WebhookID != 2 || last.Event.TODOID != 1 || last.Event.TODO != nil {
+				t.Errorf("unexpected delivery, given = %+v", last)
+			}
+			if claimed, err := repo.ClaimDeliveries(ctx, now, time.Minute, 10); err != nil || len(claimed) != 0 {
+				t.Errorf("unexpected deliveries claimed while leased, given = %d, err = %v", len(claimed), err)
+			}
+
+			claimed[0].Status = model.WebhookDeliverySucceeded
+			claimed[0].Attempts = 1
+			claimed[0].NextAttemptAt = nil
+			claimed[0].LastStatusCode = 200
+			retryAt := now.Add(10 * time.Minute)
+			claimed[1].Attempts = 1
+			claimed[1].NextAttemptAt = &retryAt
+			claimed[1].LastStatusCode = 500
+			claimed[1].LastError = "unexpected status"
+			for _, delivery := range claimed[:2] {
+				if err := repo.RecordDelivery(ctx, delivery); err != nil {
+					t.Fatal("failed to record delivery, err =", err)
+				}
+			}
+			claimed, err = repo.ClaimDeliveries(ctx, now.Add(2*time.Minute), time.Minute, 10)
+			if err != nil || len(claimed) != 2 || claimed[0].ID != 3 {
+				t.Errorf("unexpected deliveries claimed after the lease, given = %+v, err = %v", claimed, err)
+			}
+
+			deliveries, err := repo.ListDeliveries(ctx, 1, 0, 1)
+			if err != nil || len(deliveries) != 1 || deliveries[0].ID != 3 {
+				t.Fatalf("unexpected deliveries, given = %+v, err = %v", deliveries, err)
+			}
+			deliveries, err = repo.ListDeliveries(ctx, 1, deliveries[0].ID, 10)
+			if err != nil || len(deliveries) != 2 {
+				t.Fatalf("unexpected deliveries, given = %+v, err = %v", deliveries, err)
+			}
+			if d := deliveries[1]; d.Status != model.WebhookDeliverySucceeded || d.Attempts != 1 || d.LastStatusCode != 200 || d.NextAttemptAt != nil {
+				t.Errorf("unexpected delivery, given = %+v", d)
+			}
+			if d := deliveries[0]; d.Status != model.WebhookDeliveryPending || d.LastError != "unexpected status" || d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(retryAt.Truncate(time.Second)) {
+				t.Errorf("unexpected delivery, given = %+v", d)
+			}
+
+			hook, err := repo.UpdateWebhook(ctx, &model.Webhook{ID: 2, URL: "http://example.com/any", Active: true})
+			if err != nil || hook.URL != "http://example.com/any" || len(hook.Events) != 0 || hook.Secret != "secret2" {
+				t.Errorf("unexpected webhook, given = %+v, err = %v", hook, err)
+			}
+
+			var notFound *model.ErrNotFound
+			if err := repo.DeleteWebhook(ctx, 1); err != nil {
+				t.Fatal("failed to delete webhook, err =", err)
+			}
+			if _, err := repo.GetWebhook(ctx, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.ListDeliveries(ctx, 1, 0, 10); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if _, err := repo.UpdateWebhook(ctx, &model.Webhook{ID: 1, URL: "http://example.com", Secret: "secret"}); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+			if err := repo.DeleteWebhook(ctx, 1); !errors.As(err, &notFound) {
+				t.Errorf("unexpected error, given = %v, expected = *model.ErrNotFound", err)
+			}
+
+			// the TODOs changed along with their tag or project record events too
+			project, err := repo.CreateProject(ctx, &model.Project{Name: "project"})
+			if err != nil {
+				t.Fatal("failed to create project, err =", err)
+			}
+			todo, err := repo.Create(ctx, &model.TODO{Subject: "tagged", Tags: []string{"tag"}, ProjectID: &project.ID})
+			if err != nil {
+				t.Fatal("failed to create todo, err =", err)
+			}
+			tags, err := repo.ListTags(ctx)
+			if err != nil || len(tags) != 1 {
+				t.Fatalf("unexpected tags, given = %+v, err = %v", tags, err)
+			}
+			if _, _, err := repo.RenameTag(ctx, tags[0].ID, "renamed"); err != nil {
+				t.Fatal("failed to rename tag, err =", err)
+			}
+			if _, err := repo.DeleteProject(ctx, project.ID, true); err != nil {
+				t.Fatal("failed to delete project, err =", err)
+			}
+			if n, err := repo.DispatchEvents(ctx, 10); err != nil || n != 3 {
+				t.Errorf("unexpected events dispatched, given = %d, err = %v, expected = 3", n, err)
+			}
+			deliveries, err = repo.ListDeliveries(ctx, 2, 0, 3)
+			if want := "[todo.deleted todo.updated todo.created]"; err != nil || types(deliveries) != want {
+				t.Fatalf("unexpected deliveries, given = %s, err = %v, expected = %s", types(deliveries), err, want)
+			}
+			if renamed := deliveries[1].Event; renamed.TODOID != todo.ID || renamed.TODO == nil || fmt.Sprint(renamed.TODO.Tags) != "[renamed]" {
+				t.Errorf("unexpected event of renamed tag, given = %+v", renamed)
+			}
+		})
+	}
+}
+
+func TestTODORepositoryOutbox(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			dispatch := func(want int) {
+				t.Helper()
+				if n, err := repo.DispatchEvents(ctx, 10); err != nil || n != want {
+					t.Errorf("unexpected events dispatched, given = %d, err = %v, expected = %d", n, err, want)
+				}
+			}
+
+			// no event is recorded without an active webhook subscribing to it
+			todo, err := repo.Create(ctx, &model.TODO{Subject: "todo"})
+			if err != nil {
+				t.Fatal("failed to create todo, err =", err)
+			}
+			for _, hook := range []*model.Webhook{
+				{URL: "http://example.com/inactive", Secret: "secret1"},
+				{URL: "http://example.com/deleted", Events: []model.TODOEventType{model.TODOEventDeleted}, Active: true, Secret: "secret2"},
+			} {
+				if _, err := repo.CreateWebhook(ctx, hook); err != nil {
+					t.Fatal("failed to create webhook, err =", err)
+				}
+			}
+			if todo, err = repo.Update(ctx, &model.TODO{ID: todo.ID, Subject: "updated"}, 0); err != nil {
+				t.Fatal("failed to update todo, err =", err)
+			}
+			dispatch(0)
+
+			// an event no webhook subscribes to any more is dropped, and the
+			// others are dispatched once
+			if _, err := repo.Delete(ctx, []int64{todo.ID}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+			if _, err := repo.Restore(ctx, todo.ID); err != nil {
+				t.Fatal("failed to restore todo, err =", err)
+			}
+			if _, err := repo.Delete(ctx, []int64{todo.ID}, 0); err != nil {
+				t.Fatal("failed to delete todo, err =", err)
+			}
+			if _, err := repo.UpdateWebhook(ctx, &model.Webhook{ID: 2, URL: "http://example.com/created", Events: []model.TODOEventType{model.TODOEventCreated}, Active: true}); err != nil {
+				t.Fatal("failed to update webhook, err =", err)
+			}
+			dispatch(2)
+			dispatch(0)
+
+			// finished deliveries are pruned, and pending ones kept
+			if _, err := repo.UpdateWebhook(ctx, &model.Webhook{ID: 2, URL: "http://example.com/deleted", Events: []model.TODOEventType{model.TODOEventDeleted}, Active: true}); err != nil {
+				t.Fatal("failed to update webhook, err =", err)
+			}
+			if _, err := repo.Restore(ctx, todo.ID); err != nil {
+				t.Fatal("failed to restore todo, err =", err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := repo.Delete(ctx, []int64{todo.ID}, 0); err != nil {
+					t.Fatal("failed to delete todo, err =", err)
+				}
+				if _, err := repo.Restore(ctx, todo.ID); err != nil {
+					t.Fatal("failed to restore todo, err =", err)
+				}
+			}
+			dispatch(2)
+			claimed, err := repo.ClaimDeliveries(ctx, time.Now(), time.Minute, 10)
+			if err != nil || len(claimed) != 2 {
+				t.Fatalf("unexpected deliveries claimed, given = %d, err = %v, expected = 2", len(claimed), err)
+			}
+			claimed[0].Status = model.WebhookDeliverySucceeded
+			if err := repo.RecordDelivery(ctx, claimed[0]); err != nil {
+				t.Fatal("failed to record delivery, err =", err)
+			}
+			if n, err := repo.PruneDeliveries(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+				t.Errorf("unexpected deliveries pruned, given = %d, err = %v, expected = 0", n, err)
+			}
+			if n, err := repo.PruneDeliveries(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+				t.Errorf("unexpected deliveries pruned, given = %d, err = %v, expected = 1", n, err)
+			}
+			deliveries, err := repo.ListDeliveries(ctx, 2, 0, 10)
+			if err != nil || len(deliveries) != 1 || deliveries[0].ID != claimed[1].ID {
+				t.Errorf("unexpected deliveries after pruning, given = %+v, err = %v", deliveries, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteTODORepositoryOutboxPruned(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "repository_test.db"))
+	if err != nil {
+		t.Fatal("failed to create db, err =", err)
+	}
+	defer d.Close()
+	repo := repository.NewSQLiteTODORepository(d)
+
+	outbox := func() (n int) {
+		t.Helper()
+		if err := d.QueryRow(`SELECT COUNT(*) FROM outbox`).Scan(&n); err != nil {
+			t.Fatal("failed to count outbox, err =", err)
+		}
+		return n
+	}
+
+	if _, err := repo.Create(ctx, &model.TODO{Subject: "unheard"}); err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	if n := outbox(); n != 0 {
+		t.Errorf("unexpected events without webhooks, given = %d, expected = 0", n)
+	}
+
+	// the events are removed with the last of their deliveries
+	for _, url := range []string{"http://example.com/1", "http://example.com/2"} {
+		if _, err := repo.CreateWebhook(ctx, &model.Webhook{URL: url, Active: true, Secret: "secret"}); err != nil {
+			t.Fatal("failed to create webhook, err =", err)
+		}
+	}
+	if _, err := repo.Create(ctx, &model.TODO{Subject: "heard"}); err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	if _, err := repo.DispatchEvents(ctx, 10); err != nil {
+		t.Fatal("failed to dispatch events, err =", err)
+	}
+	for i, want := range []int{1, 0} {
+		if err := repo.DeleteWebhook(ctx, int64(i+1)); err != nil {
+			t.Fatal("failed to delete webhook, err =", err)
+		}
+		if n := outbox(); n != want {
+			t.Errorf("unexpected events after deleting webhook %d, given = %d, expected = %d", i+1, n, want)
+		}
+	}
+}
+
+func TestTODORepositoryAtomic(t *testing.T) {
+	t.Parallel()
+
+	for name, repo := range newRepositories(t) {
+		repo := repo
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			errAbort := errors.New("abort")
+			// the events are recorded only for a webhook
+			if _, err := repo.CreateWebhook(ctx, &model.Webhook{URL: "http://example.com", Active: true, Secret: "secret"}); err != nil {
+				t.Fatal("failed to create webhook, err =", err)
+			}
+
+			// subjects returns the subjects of all TODOs like [b a].
+			subjects := func() string {
+				todos, err := repo.List(ctx, 0, 10, model.TODOFilter{Status: model.TODOStatusAll})
+				if err != nil {
+					t.Fatal("failed to list todos, err =", err)
+				}
+				given := make([]string, len(todos))
+				for i, todo := range todos {
+					given[i] = todo.Subject
+				}
+				return fmt.Sprint(given)
+			}
+
+			// the changes are seen inside the unit of work, and kept
+			err := repo.Atomic(ctx, func(repo repository.TODORepository) error {
+				created, err := repo.Create(ctx, &model.TODO{Subject: "a", Tags: []string{"tag"}})
+				if err != nil {
+					return err
+				}
+				if _, err := repo.Update(ctx, &model.TODO{ID: created.ID, Subject: "a", Tags: []string{"tag"}}, created.Version); err != nil {
+					return err
+				}
+				_, err = repo.Create(ctx, &model.TODO{Subject: "b"})
+				return err
+			})
+			if err != nil {
+				t.Fatal("failed to run unit of work, err =", err)
+			}
+			if given := subjects(); given != "[b a]" {
+				t.Errorf("unexpected todos, given = %s, expected = [b a]", given)
+			}
+
+			// the changes are all discarded by a failure
+			err = repo.Atomic(ctx, func(repo repository.TODORepository) error {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: "c"}); err != nil {
+					return err
+				}
+				if _, err := repo.Delete(ctx, []int64{1}, 0); err != nil {
+					return err
+				}
+				if _, err := repo.CreateTag(ctx, "discarded"); err != nil {
+					return err
+				}
+				return errAbort
+			})
+			if !errors.Is(err, errAbort) {
+				t.Errorf("unexpected error, given = %v, expected = %v", err, errAbort)
+			}
+			if given := subjects(); given != "[b a]" {
+				t.Errorf("unexpected todos after failure, given = %s, expected = [b a]", given)
+			}
+			if tags, err := repo.ListTags(ctx); err != nil || len(tags) != 1 {
+				t.Errorf("unexpected tags after failure, given = %+v, err = %v", tags, err)
+			}
+
+			// a nested failure discards only its own changes
+			err = repo.Atomic(ctx, func(repo repository.TODORepository) error {
+				if _, err := repo.Create(ctx, &model.TODO{Subject: "d"}); err != nil {
+					return err
+				}
+				err := repo.Atomic(ctx, func(repo repository.TODORepository) error {
+					if _, err := repo.Create(ctx, &model.TODO{Subject: "e"}); err != nil {
+						return err
+					}
+					return errAbort
+				})
+				if !errors.Is(err, errAbort) {
+					return fmt.Errorf("unexpected nested error: %v", err)
+				}
+				_, err = repo.Get(ctx, 1)
+				return err
+			})
+			if err != nil {
+				t.Fatal("failed to run unit of work, err =", err)
+			}
+			if given := subjects(); given != "[d b a]" {
+				t.Errorf("unexpected todos after nested failure, given = %s, expected = [d b a]", given)
+			}
+
+			// only the events of the kept changes are in the outbox
+			if n, err := repo.DispatchEvents(ctx, 10); err != nil || n != 4 {
+				t.Errorf("unexpected events dispatched, given = %d, err = %v, expected = 4", n, err)
+			}
+
+			// units of work reading before writing take turns
+			var (
+				wg   sync.WaitGroup
+				errs = make(chan error, 8)
+			)
+			for i := 0; i < cap(errs); i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- repo.Atomic(ctx, func(repo repository.TODORepository) error {
+						todo, err := repo.Get(ctx, 2)
+						if err != nil {
+							return err
+						}
+						todo.Description += "+"
+						_, err = repo.Update(ctx, todo, todo.Version)
+						return err
+					})
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Error("failed to run concurrent unit of work, err =", err)
+				}
+			}
+			if todo, err := repo.Get(ctx, 2); err != nil || todo.Description != "++++++++" {
+				t.Errorf("unexpected todo after concurrent units of work, given = %+v, err = %v", todo, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteTODORepositoryReadsDuringWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := newRepositories(t)["SQLite"]
+	todo, err := repo.Create(ctx, &model.TODO{Subject: "todo"})
+	if err != nil {
+		t.Fatal("failed to create todo, err =", err)
+	}
+	hook, err := repo.CreateWebhook(ctx, &model.Webhook{URL: "http://example.com", Active: true, Secret: "secret"})
+	if err != nil {
+		t.Fatal("failed to create webhook, err =", err)
+	}
+
+	// the reads do not wait for the unit of work holding the write lock
+	err = repo.Atomic(ctx, func(unit repository.TODORepository) error {
+		if _, err := unit.Update(ctx, &model.TODO{ID: todo.ID, Subject: "updated"}, 0); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		if _, err := repo.ListChecklist(ctx, todo.ID); err != nil {
+			return fmt.Errorf("failed to list checklist: %w", err)
+		}
+		if _, err := repo.ListDeliveries(ctx, hook.ID, 0, 10); err != nil {
+			return fmt.Errorf("failed to list deliveries: %w", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("unexpected wait of reads, given = %v", elapsed)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("failed to run unit of work, err =", err)
+	}
+}
+
+// todoIDs returns the ids of todos in order.
+func todoIDs(todos []*model.TODO) []int64 {
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A WebhookRepository stores Webhook entities and their deliveries of the
+// events in the outbox, where every change of a TODO through TODORepository
+// records its event in the same transaction, while an active webhook
+// subscribes to it. An event is kept only until its deliveries are gone.
+// Methods addressing a missing webhook return *model.ErrNotFound.
+type WebhookRepository interface {
+	// CreateWebhook stores a new webhook with the URL, events, active and
+	// secret of hook, and returns it.
+	CreateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error)
+	// GetWebhook returns the webhook by id.
+	GetWebhook(ctx context.Context, id int64) (*model.Webhook, error)
+	// ListWebhooks returns all webhooks in ascending order of id.
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	// UpdateWebhook overwrites the URL, events and active of the webhook by
+	// the id of hook, and its secret unless empty, and returns it.
+	UpdateWebhook(ctx context.Context, hook *model.Webhook) (*model.Webhook, error)
+	// DeleteWebhook deletes the webhook with its deliveries.
+	DeleteWebhook(ctx context.Context, id int64) error
+
+	// DispatchEvents takes up to limit events not dispatched yet out of the
+	// outbox in order, queues a delivery of each to every active webhook
+	// subscribing to it, due now, and returns how many events were taken.
+	DispatchEvents(ctx context.Context, limit int) (int, error)
+	// PruneDeliveries deletes the deliveries which succeeded or failed, last
+	// updated before t, and returns how many were deleted.
+	PruneDeliveries(ctx context.Context, t time.Time) (int64, error)
+	// ClaimDeliveries returns up to limit pending deliveries due by now in
+	// order of id, each with its Webhook, and puts them off until now+lease
+	// so that they are claimed again only if never recorded.
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error)
+	// RecordDelivery overwrites the Status, Attempts, NextAttemptAt,
+	// LastStatusCode and LastError of the delivery by the id of delivery.
+	RecordDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	// ListDeliveries returns at most size deliveries of the webhook by
+	// webhookID in descending order of id, continuing after prevID.
+	// prevID <= 0 means from the latest delivery.
+	ListDeliveries(ctx context.Context, webhookID, prevID, size int64) ([]*model.WebhookDelivery, error)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// maxChecklistTextLength is the limit of the text of a checklist item.
+const maxChecklistTextLength = 200
+
+// ReadChecklist reads the checklist of the TODO on DB by todoID with its
+// progress.
+func (s *TODOService) ReadChecklist(ctx context.Context, todoID int64) ([]*model.ChecklistItem, model.TODOProgress, error) {
+	items, err := s.repo.ListChecklist(ctx, todoID)
+	if err != nil {
+		return nil, model.TODOProgress{}, err
+	}
+	return items, checklistProgress(items), nil
+}
+
+// AddChecklistItem adds an item to the checklist of the TODO on DB by todoID
+// before the item at position, or at the end if position is nil.
+func (s *TODOService) AddChecklistItem(ctx context.Context, todoID int64, text string, done bool, position *int) (*model.ChecklistItem, error) {
+	invalid := &model.ErrValidation{}
+	text, err := normalizeChecklistText(text)
+	if err != nil {
+		invalid.Add("text", err.Error())
+	}
+	item := &model.ChecklistItem{Text: text, Done: done, Position: -1}
+	if position != nil {
+		if *position < 0 {
+			invalid.Add("position", "must be 0 or more")
+		}
+		item.Position = *position
+	}
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	var added *model.ChecklistItem
+	err = s.Atomic(ctx, func(u *TODOService) error {
+		var err error
+		if added, err = u.repo.AddChecklistItem(ctx, todoID, item); err != nil {
+			return err
+		}
+		return u.publishUpdated(ctx, todoID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// UpdateChecklistItem updates only the fields of the checklist item on DB
+// given in patch.
+func (s *TODOService) UpdateChecklistItem(ctx context.Context, todoID, id int64, patch *model.ChecklistItemPatch) (*model.ChecklistItem, error) {
+	if patch.Text != nil {
+		text, err := normalizeChecklistText(*patch.Text)
+		if err != nil {
+			return nil, model.NewErrValidation("text", err.Error())
+		}
+		patch = &model.ChecklistItemPatch{Text: &text, Done: patch.Done}
+	}
+
+	var updated *model.ChecklistItem
+	err := s.Atomic(ctx, func(u *TODOService) error {
+		var err error
+		if updated, err = u.repo.UpdateChecklistItem(ctx, todoID, id, patch); err != nil {
+			return err
+		}
+		return u.publishUpdated(ctx, todoID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteChecklistItem deletes the checklist item on DB.
+func (s *TODOService) DeleteChecklistItem(ctx context.Context, todoID, id int64) error {
+	return s.Atomic(ctx, func(u *TODOService) error {
+		if err := u.repo.DeleteChecklistItem(ctx, todoID, id); err != nil {
+			return err
+		}
+		return u.publishUpdated(ctx, todoID)
+	})
+}
+
+// ReorderChecklist orders the checklist of the TODO on DB by todoID as ids,
+// which must list every item once.
+func (s *TODOService) ReorderChecklist(ctx context.Context, todoID int64, ids []int64) ([]*model.ChecklistItem, model.TODOProgress, error) {
+	var items []*model.ChecklistItem
+	err := s.Atomic(ctx, func(u *TODOService) error {
+		var err error
+		if items, err = u.repo.ReorderChecklist(ctx, todoID, ids); err != nil {
+			return err
+		}
+		return u.publishUpdated(ctx, todoID)
+	})
+	if err != nil {
+		return nil, model.TODOProgress{}, err
+	}
+	return items, checklistProgress(items), nil
+}
+
+// checklistProgress counts the done items of a checklist.
+func checklistProgress(items []*model.ChecklistItem) model.TODOProgress {
+	progress := model.TODOProgress{Total: len(items)}
+	for _, item := range items {
+		if item.Done {
+			progress.Done++
+		}
+	}
+	return progress
+}
+
+// normalizeChecklistText trims the spaces around the text of a checklist item
+// and validates it.
+func normalizeChecklistText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return "", fmt.Errorf("must not be empty")
+	case utf8.RuneCountInString(text) > maxChecklistTextLength:
+		return "", fmt.Errorf("must be at most %d characters", maxChecklistTextLength)
+	}
+	return text, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// Sizes of event buffers.
+const (
+	// defaultEventReplaySize is how many of the latest events TODOService
+	// keeps to replay.
+	defaultEventReplaySize = 256
+	// subscriptionBufferSize is how many events a subscriber may fall behind
+	// before it is dropped.
+	subscriptionBufferSize = 64
+)
+
+// An EventBroker fans out the events of TODO changes to its subscribers in
+// process, keeping the latest ones to replay to subscribers resuming after
+// them. Publishing never waits for subscribers.
+type EventBroker struct {
+	mu sync.Mutex
+	// epoch tells the events of the broker from the ones of another, which
+	// have the same ids, for example published before a restart.
+	epoch  int64
+	lastID int64
+	// replay is the latest events in the order published, at most
+	// replaySize.
+	replay     []*model.TODOEvent
+	replaySize int
+	subs       map[*Subscription]struct{}
+	now        func() time.Time
+}
+
+// NewEventBroker returns new EventBroker keeping replaySize events to replay.
+func NewEventBroker(replaySize int) *EventBroker {
+	return &EventBroker{
+		epoch:      time.Now().UnixNano(),
+		replaySize: replaySize,
+		subs:       make(map[*Subscription]struct{}),
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+// Publish sends the event of typ about the TODO by id to every subscriber.
+// todo is the TODO after the change, or nil if it was deleted. A subscriber
+// which has fallen too far behind is dropped instead, and can resume from
+// the replay buffer.
+func (b *EventBroker) Publish(typ model.TODOEventType, id int64, todo *model.TODO) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := &model.TODOEvent{ID: b.lastID, Type: typ, TODOID: id, At: b.now()}
+	if todo != nil {
+		// subscribers never see the later changes of the caller to todo
+		c := *todo
+		e.TODO = &c
+	}
+
+	b.replay = append(b.replay, e)
+	if len(b.replay) > b.replaySize {
+		b.replay = b.replay[len(b.replay)-b.replaySize:]
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			b.unsubscribe(sub)
+		}
+	}
+}
+
+// Epoch returns the epoch of the events published by b. An event id is only
+// meaningful to b along with its epoch.
+func (b *EventBroker) Epoch() int64 {
+	return b.epoch
+}
+
+// Subscribe returns a Subscription to the events published from now on, and
+// the events kept since the event by lastID of epoch, which are to be handled
+// first. complete is false if some of those events are no longer kept, or
+// lastID is unknown, which any of another epoch is, for example published
+// before a restart. lastID 0 means from now.
+func (b *EventBroker) Subscribe(epoch, lastID int64) (sub *Subscription, replay []*model.TODOEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		c:      make(chan *model.TODOEvent, subscriptionBufferSize),
+		broker: b,
+		LastID: b.lastID,
+	}
+	b.subs[sub] = struct{}{}
+
+	switch {
+	case lastID == 0 || epoch == b.epoch && lastID == b.lastID:
+		return sub, nil, true
+	case epoch != b.epoch || lastID < 0 || lastID > b.lastID:
+		return sub, nil, false
+	}
+	// the event after lastID must still be kept
+	if len(b.replay) == 0 || b.replay[0].ID > lastID+1 {
+		return sub, nil, false
+	}
+	replay = make([]*model.TODOEvent, b.lastID-lastID)
+	copy(replay, b.replay[len(b.replay)-len(replay):])
+	return sub, replay, true
+}
+
+// unsubscribe removes sub and closes its channel. b.mu must be locked.
+func (b *EventBroker) unsubscribe(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.c)
+}
+
+// A Subscription receives the events published to an EventBroker.
+type Subscription struct {
+	c      chan *model.TODOEvent
+	broker *EventBroker
+	// LastID is the id of the last event published before subscribing.
+	LastID int64
+}
+
+// C returns the channel of the events in the order published. It is closed
+// when the subscription is closed, or dropped for falling too far behind.
+func (s *Subscription) C() <-chan *model.TODOEvent {
+	return s.c
+}
+
+// Close stops the subscription. It may be called more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.unsubscribe(s)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+)
+
+// maxProjectNameLength is the limit of the name of a project.
+const maxProjectNameLength = 100
+
+// A ProjectService implements CRUD of Project entities. The changes of TODOs
+// made along with their projects are published to the Events of the
+// TODOService.
+type ProjectService struct {
+	repo  repository.ProjectRepository
+	todos *TODOService
+}
+
+// NewProjectService returns new ProjectService on the repository of todos.
+func NewProjectService(todos *TODOService) *ProjectService {
+	return &ProjectService{
+		repo:  todos.repo,
+		todos: todos,
+	}
+}
+
+// CreateProject creates a project on DB.
+func (s *ProjectService) CreateProject(ctx context.Context, name, description string) (*model.Project, error) {
+	name, err := normalizeProjectName(name)
+	if err != nil {
+		return nil, model.NewErrValidation("name", err.Error())
+	}
+	return s.repo.CreateProject(ctx, &model.Project{Name: name, Description: description})
+}
+
+// GetProject reads the project on DB by id.
+func (s *ProjectService) GetProject(ctx context.Context, id int64) (*model.Project, error) {
+	return s.repo.GetProject(ctx, id)
+}
+
+// ReadProjects reads all projects on DB in the order they were created.
+func (s *ProjectService) ReadProjects(ctx context.Context) ([]*model.Project, error) {
+	return s.repo.ListProjects(ctx)
+}
+
+// UpdateProject updates the project on DB.
+func (s *ProjectService) UpdateProject(ctx context.Context, id int64, name, description string) (*model.Project, error) {
+	name, err := normalizeProjectName(name)
+	if err != nil {
+		return nil, model.NewErrValidation("name", err.Error())
+	}
+	return s.repo.UpdateProject(ctx, &model.Project{ID: id, Name: name, Description: description})
+}
+
+// DeleteProject deletes the project on DB. A project with TODOs out of the
+// trash is deleted only if cascade, which moves them to the trash.
+func (s *ProjectService) DeleteProject(ctx context.Context, id int64, cascade bool) error {
+	return s.todos.Atomic(ctx, func(todos *TODOService) error {
+		trashed, err := todos.repo.DeleteProject(ctx, id, cascade)
+		if err != nil {
+			return err
+		}
+		for _, id := range trashed {
+			todos.publish(model.TODOEventDeleted, id, nil)
+		}
+		return nil
+	})
+}
+
+// normalizeProjectName trims the spaces around a project name and validates
+// it.
+func normalizeProjectName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("must not be empty")
+	case utf8.RuneCountInString(name) > maxProjectNameLength:
+		return "", fmt.Errorf("must be at most %d characters", maxProjectNameLength)
+	}
+	return name, nil
+}
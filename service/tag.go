@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+)
+
+// Limits of tags.
+const (
+	maxTagLength   = 50
+	maxTagsPerTODO = 20
+)
+
+// A TagService implements CRUD of Tag entities. The changes of TODOs made
+// along with their tags are published to the Events of the TODOService.
+type TagService struct {
+	repo  repository.TagRepository
+	todos *TODOService
+}
+
+// NewTagService returns new TagService on the repository of todos.
+func NewTagService(todos *TODOService) *TagService {
+	return &TagService{
+		repo:  todos.repo,
+		todos: todos,
+	}
+}
+
+// CreateTag creates a tag on DB.
+func (s *TagService) CreateTag(ctx context.Context, name string) (*model.Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return nil, model.NewErrValidation("name", err.Error())
+	}
+	return s.repo.CreateTag(ctx, name)
+}
+
+// GetTag reads the tag on DB by id.
+func (s *TagService) GetTag(ctx context.Context, id int64) (*model.Tag, error) {
+	return s.repo.GetTag(ctx, id)
+}
+
+// ReadTags reads all tags on DB in alphabetical order.
+func (s *TagService) ReadTags(ctx context.Context) ([]*model.Tag, error) {
+	return s.repo.ListTags(ctx)
+}
+
+// RenameTag renames the tag on DB, and so the tags of its TODOs.
+func (s *TagService) RenameTag(ctx context.Context, id int64, name string) (*model.Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return nil, model.NewErrValidation("name", err.Error())
+	}
+
+	var renamed *model.Tag
+	err = s.todos.Atomic(ctx, func(todos *TODOService) error {
+		tag, tagged, err := todos.repo.RenameTag(ctx, id, name)
+		if err != nil {
+			return err
+		}
+		renamed = tag
+		return todos.publishUpdated(ctx, tagged...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return renamed, nil
+}
+
+// DeleteTag removes the tag on DB from its TODOs and deletes it.
+func (s *TagService) DeleteTag(ctx context.Context, id int64) error {
+	return s.todos.Atomic(ctx, func(todos *TODOService) error {
+		tagged, err := todos.repo.DeleteTag(ctx, id)
+		if err != nil {
+			return err
+		}
+		return todos.publishUpdated(ctx, tagged...)
+	})
+}
+
+// normalizeTag trims the spaces around a tag name and validates it.
+func normalizeTag(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("must not be empty")
+	case utf8.RuneCountInString(name) > maxTagLength:
+		return "", fmt.Errorf("must be at most %d characters", maxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags applies normalizeTag to the tags of a TODO, and returns nil
+// for no tags.
+func normalizeTags(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	invalid := &model.ErrValidation{}
+	if len(names) > maxTagsPerTODO {
+		invalid.Add("tags", fmt.Sprintf("must be at most %d tags", maxTagsPerTODO))
+	}
+	tags := make([]string, len(names))
+	for i, name := range names {
+		tag, err := normalizeTag(name)
+		if err != nil {
+			invalid.Add(fmt.Sprintf("tags[%d]", i), err.Error())
+		}
+		tags[i] = tag
+	}
+	if err := invalid.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
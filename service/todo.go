@@ -2,191 +2,526 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"strings"
+	"log"
 	"time"
 
 	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
 )
 
-// A TODOService implements CRUD of TODO entities.
+// A TODOService implements CRUD of TODO entities. Every successful change is
+// published to its Events.
 type TODOService struct {
-	db *sql.DB
+	repo   repository.TODORepository
+	events *EventBroker
+	// pending is the events of the unit of work s runs in, if any, which are
+	// published once its changes are kept.
+	pending *[]pendingEvent
+}
+
+// A pendingEvent is an event deferred by a unit of work.
+type pendingEvent struct {
+	typ  model.TODOEventType
+	id   int64
+	todo *model.TODO
 }
 
 // NewTODOService returns new TODOService.
-func NewTODOService(db *sql.DB) *TODOService {
+func NewTODOService(repo repository.TODORepository) *TODOService {
 	return &TODOService{
-		db: db,
+		repo:   repo,
+		events: NewEventBroker(defaultEventReplaySize),
 	}
 }
 
-// CreateTODO creates a TODO on DB.
-func (s *TODOService) CreateTODO(ctx context.Context, subject, description string) (*model.TODO, error) {
-	const (
-		insert  = `INSERT INTO todos(subject, description) VALUES(?, ?)`
-		confirm = `SELECT subject, description, created_at, updated_at FROM todos WHERE id = ?`
-	)
-
-	// if len(subject) == 0 {
-	// 	// log.Println("subject must be 1 character more.")
-	// 	// err := errors.New("subject must be 1 character more")
-	// 	var err error
-	// 	return nil, err
-	// }
+// Events returns the EventBroker the changes of TODOs are published to.
+func (s *TODOService) Events() *EventBroker {
+	return s.events
+}
 
-	result, err := s.db.ExecContext(ctx, insert, subject, description)
+// Atomic runs fn as a unit of work with a TODOService whose changes are all
+// kept if fn succeeds, and all discarded otherwise. The changes are published
+// only once kept. Atomic of the TODOService given to fn nests in the same unit
+// of work. The TODOService must not be used after fn returns.
+func (s *TODOService) Atomic(ctx context.Context, fn func(svc *TODOService) error) error {
+	var pending []pendingEvent
+	err := s.repo.Atomic(ctx, func(repo repository.TODORepository) error {
+		return fn(&TODOService{repo: repo, events: s.events, pending: &pending})
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
+	for _, e := range pending {
+		s.publish(e.typ, e.id, e.todo)
+	}
+	return nil
+}
+
+// publish publishes the event of typ about the TODO by id, or defers it until
+// the unit of work s runs in is kept.
+func (s *TODOService) publish(typ model.TODOEventType, id int64, todo *model.TODO) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, pendingEvent{typ: typ, id: id, todo: todo})
+		return
 	}
+	s.events.Publish(typ, id, todo)
+}
+
+// publishUpdated publishes the changes to the TODOs by ids made along with
+// another entity, like their checklists or tags, as updates of the TODOs,
+// which are read again for the events in the same unit of work as the change.
+func (s *TODOService) publishUpdated(ctx context.Context, ids ...int64) error {
+	for _, id := range ids {
+		todo, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		s.publish(model.TODOEventUpdated, id, todo)
+	}
+	return nil
+}
 
-	var createdAt time.Time
-	var updatedAt time.Time
+// published publishes the event of typ about todo returned by a change unless
+// the change failed with err, and returns them as they are.
+func (s *TODOService) published(typ model.TODOEventType, todo *model.TODO, err error) (*model.TODO, error) {
+	if err == nil {
+		s.publish(typ, todo.ID, todo)
+	}
+	return todo, err
+}
 
-	err = s.db.QueryRowContext(ctx, confirm, id).Scan(&subject, &description, &createdAt, &updatedAt)
+// CreateTODO creates a TODO on DB. WithDueAt, WithTags, WithProject and
+// WithPriority set its due time, tags, project and priority.
+func (s *TODOService) CreateTODO(ctx context.Context, subject, description string, opts ...WriteOption) (*model.TODO, error) {
+	o := newWriteOptions(opts)
+	tags, err := normalizeTags(o.tags)
 	if err != nil {
 		return nil, err
 	}
+	if err := validatePriority(o.priority); err != nil {
+		return nil, err
+	}
 
-	todo := &model.TODO{
-		ID:          id,
+	todo, err := s.repo.Create(ctx, &model.TODO{
 		Subject:     subject,
 		Description: description,
-		CreatedAt:   createdAt,
-		UpdatedAt:   updatedAt,
+		DueAt:       o.dueAt,
+		Tags:        tags,
+		ProjectID:   o.projectID,
+		Priority:    o.priority,
+	})
+	return s.published(model.TODOEventCreated, todo, err)
+}
+
+// A ReadOption narrows down the TODOs returned by ReadTODO.
+type ReadOption func(*model.TODOFilter)
+
+// WithStatus returns ReadOption which reads only TODOs in status.
+func WithStatus(status model.TODOStatus) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Status = status
 	}
+}
 
-	return todo, nil
+// WithQuery returns ReadOption which reads only TODOs matching the full-text
+// search query, ranked by relevance.
+func WithQuery(query string) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Query = query
+	}
 }
 
-// ReadTODO reads TODOs on DB.
-func (s *TODOService) ReadTODO(ctx context.Context, prevID, size int64) ([]*model.TODO, error) {
-	const (
-		read       = `SELECT id, subject, description, created_at, updated_at FROM todos ORDER BY id DESC LIMIT ?`
-		readWithID = `SELECT id, subject, description, created_at, updated_at FROM todos WHERE id < ? ORDER BY id DESC LIMIT ?`
-	)
+// InTrash returns ReadOption which reads the TODOs in the trash instead of the
+// others.
+func InTrash() ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Trashed = true
+	}
+}
 
-	if size == 0 {
-		return []*model.TODO{}, nil
+// DueBefore returns ReadOption which reads only TODOs due before t.
+func DueBefore(t time.Time) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.DueBefore = &t
 	}
+}
 
-	var rows *sql.Rows
-	var err error
+// DueAfter returns ReadOption which reads only TODOs due at or after t.
+func DueAfter(t time.Time) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.DueAfter = &t
+	}
+}
 
-	if prevID > 0 {
-		rows, err = s.db.QueryContext(ctx, readWithID, prevID, size)
-	} else {
-		rows, err = s.db.QueryContext(ctx, read, size)
+// Overdue returns ReadOption which reads only TODOs not done yet whose due
+// time has passed.
+func Overdue() ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Overdue = true
 	}
+}
 
-	if err != nil {
-		return nil, err
+// Tagged returns ReadOption which reads only TODOs having all of tags, or any
+// of them if matchAny.
+func Tagged(tags []string, matchAny bool) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Tags = tags
+		f.AnyTag = matchAny
 	}
-	defer rows.Close()
+}
 
-	var todos []*model.TODO
-	for rows.Next() {
-		var todo model.TODO
-		err := rows.Scan(&todo.ID, &todo.Subject, &todo.Description, &todo.CreatedAt, &todo.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		todos = append(todos, &todo)
+// InProject returns ReadOption which reads only TODOs of the project by id.
+func InProject(id int64) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.ProjectID = id
 	}
+}
 
-	err = rows.Err()
-	if err != nil {
-		return nil, err
+// SortBy returns ReadOption which orders TODOs by keys in turn, and then by
+// descending id. It is ignored with WithQuery, which orders TODOs by relevance.
+func SortBy(keys ...model.TODOSortKey) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.Sort = keys
 	}
+}
 
-	if todos == nil {
-		todos = []*model.TODO{}
+// After returns ReadOption which reads the TODOs after todo in the order of
+// SortBy, comparing its ID and the fields sorted by. It takes the place of
+// prevID, which is still used with WithQuery.
+func After(todo *model.TODO) ReadOption {
+	return func(f *model.TODOFilter) {
+		f.After = todo
 	}
+}
 
-	return todos, nil
+// ReadTODO reads TODOs on DB. TODOs in the trash are excluded unless InTrash
+// is given.
+func (s *TODOService) ReadTODO(ctx context.Context, prevID, size int64, opts ...ReadOption) ([]*model.TODO, error) {
+	// a negative LIMIT would mean no limit to SQLite
+	if size < 0 {
+		return nil, model.NewErrValidation("size", "must not be negative")
+	}
+	if size == 0 {
+		return []*model.TODO{}, nil
+	}
+
+	filter := model.TODOFilter{Status: model.TODOStatusAll}
+	for _, opt := range opts {
+		opt(&filter)
+	}
+
+	switch filter.Status {
+	case model.TODOStatusOpen, model.TODOStatusDone, model.TODOStatusAll:
+	default:
+		return nil, fmt.Errorf("unknown status: %q", filter.Status)
+	}
+	for _, key := range filter.Sort {
+		switch key.Field {
+		case model.TODOSortID, model.TODOSortPriority, model.TODOSortCreatedAt, model.TODOSortUpdatedAt, model.TODOSortSubject, model.TODOSortDueAt:
+		default:
+			return nil, fmt.Errorf("unknown sort: %q", key.Field)
+		}
+	}
+
+	return s.repo.List(ctx, prevID, size, filter)
 }
 
-// UpdateTODO updates the TODO on DB.
-func (s *TODOService) UpdateTODO(ctx context.Context, id int64, subject, description string) (*model.TODO, error) {
-	const (
-		update  = `UPDATE todos SET subject = ?, description = ? WHERE id = ?`
-		confirm = `SELECT subject, description, created_at, updated_at FROM todos WHERE id = ?`
-	)
+// CountTODO counts TODOs on DB. It takes the same options as ReadTODO.
+func (s *TODOService) CountTODO(ctx context.Context, opts ...ReadOption) (int64, error) {
+	filter := model.TODOFilter{Status: model.TODOStatusAll}
+	for _, opt := range opts {
+		opt(&filter)
+	}
 
-	// if len(subject) == 0 {
-	// 	var err error
-	// 	return nil, err
-	// }
+	return s.repo.Count(ctx, filter)
+}
 
-	result, err := s.db.ExecContext(ctx, update, subject, description, id)
+// GetTODO reads the TODO on DB by id with its checklist and progress.
+func (s *TODOService) GetTODO(ctx context.Context, id int64) (*model.TODO, error) {
+	todo, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	affectedRowCount, err := result.RowsAffected()
+	// the checklist is read after the TODO, so that it is never older than
+	// the version of the TODO
+	items, err := s.repo.ListChecklist(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	if affectedRowCount == 0 {
-		return nil, &model.ErrNotFound{When: time.Now(), What: "Todo Not Found."}
+	if len(items) != 0 {
+		progress := checklistProgress(items)
+		todo.Checklist = items
+		todo.Progress = &progress
 	}
 
-	id, err = result.LastInsertId()
-	if err != nil {
-		return nil, err
+	return todo, nil
+}
+
+// A WriteOption sets an optional field or a condition of the change made by
+// CreateTODO, UpdateTODO and DeleteTODO.
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	version   int64
+	dueAt     *time.Time
+	tags      []string
+	projectID *int64
+	priority  int
+}
+
+// WithDueAt returns WriteOption which sets the due time of the TODO, in
+// seconds. nil means no due time.
+func WithDueAt(dueAt *time.Time) WriteOption {
+	return func(o *writeOptions) {
+		o.dueAt = dueAt
 	}
+}
 
-	var createdAt time.Time
-	var updatedAt time.Time
+// WithTags returns WriteOption which sets the tags of the TODO by name. Missing
+// tags are created.
+func WithTags(tags []string) WriteOption {
+	return func(o *writeOptions) {
+		o.tags = tags
+	}
+}
+
+// WithProject returns WriteOption which puts the TODO in the project by id. nil
+// means no project.
+func WithProject(id *int64) WriteOption {
+	return func(o *writeOptions) {
+		o.projectID = id
+	}
+}
+
+// WithPriority returns WriteOption which sets the priority of the TODO, from
+// model.MinTODOPriority to model.MaxTODOPriority. The default is the lowest.
+func WithPriority(priority int) WriteOption {
+	return func(o *writeOptions) {
+		o.priority = priority
+	}
+}
+
+// IfVersion returns WriteOption which changes the TODO only while it is at
+// version, and fails with *model.ErrPreconditionFailed otherwise. 0 means any
+// version.
+func IfVersion(version int64) WriteOption {
+	return func(o *writeOptions) {
+		o.version = version
+	}
+}
 
-	err = s.db.QueryRowContext(ctx, confirm, id).Scan(&subject, &description, &createdAt, &updatedAt)
+func newWriteOptions(opts []WriteOption) writeOptions {
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// UpdateTODO updates the TODO on DB. Its due time, tags, project and priority
+// are cleared unless WithDueAt, WithTags, WithProject and WithPriority are
+// given.
+func (s *TODOService) UpdateTODO(ctx context.Context, id int64, subject, description string, opts ...WriteOption) (*model.TODO, error) {
+	o := newWriteOptions(opts)
+	tags, err := normalizeTags(o.tags)
 	if err != nil {
 		return nil, err
 	}
+	if err := validatePriority(o.priority); err != nil {
+		return nil, err
+	}
 
-	todo := &model.TODO{
+	todo, err := s.repo.Update(ctx, &model.TODO{
 		ID:          id,
 		Subject:     subject,
 		Description: description,
-		CreatedAt:   createdAt,
-		UpdatedAt:   updatedAt,
+		DueAt:       o.dueAt,
+		Tags:        tags,
+		ProjectID:   o.projectID,
+		Priority:    o.priority,
+	}, o.version)
+	return s.published(model.TODOEventUpdated, todo, err)
+}
+
+// PatchTODO updates only the fields of the TODO on DB given in patch, and
+// validates the merged TODO as a whole. The TODO is read and updated in one
+// unit of work, so that no other change comes in between.
+func (s *TODOService) PatchTODO(ctx context.Context, id int64, patch *model.TODOPatch, opts ...WriteOption) (*model.TODO, error) {
+	o := newWriteOptions(opts)
+	var tags []string
+	if patch.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*patch.Tags); err != nil {
+			return nil, err
+		}
 	}
 
-	return todo, nil
-}
+	if patch.Priority != nil {
+		if err := validatePriority(*patch.Priority); err != nil {
+			return nil, err
+		}
+	}
+
+	var patched *model.TODO
+	err := s.Atomic(ctx, func(u *TODOService) error {
+		todo, err := u.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if o.version != 0 && todo.Version != o.version {
+			return &model.ErrPreconditionFailed{ID: id}
+		}
+
+		merged := *todo
+		if patch.Subject != nil {
+			merged.Subject = *patch.Subject
+		}
+		if patch.Description != nil {
+			merged.Description = *patch.Description
+		}
+		if patch.DueAt != nil {
+			merged.DueAt = *patch.DueAt
+		}
+		if patch.Tags != nil {
+			merged.Tags = tags
+		}
+		if patch.ProjectID != nil {
+			merged.ProjectID = *patch.ProjectID
+		}
+		if patch.Priority != nil {
+			merged.Priority = *patch.Priority
+		}
+		if merged.Subject == "" {
+			return model.NewErrValidation("subject", "must not be empty")
+		}
+		if merged.Subject == todo.Subject && merged.Description == todo.Description &&
+			sameTime(merged.DueAt, todo.DueAt) && sameTags(merged.Tags, todo.Tags) && sameID(merged.ProjectID, todo.ProjectID) &&
+			merged.Priority == todo.Priority {
+			patched = todo
+			return nil
+		}
 
-// DeleteTODO deletes TODOs on DB by ids.
-func (s *TODOService) DeleteTODO(ctx context.Context, ids []int64) error {
-	if len(ids) == 0 {
+		patched, err = u.repo.Update(ctx, &merged, todo.Version)
+		if err != nil {
+			return err
+		}
+		u.publish(model.TODOEventUpdated, patched.ID, patched)
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return patched, nil
+}
 
-	placeholder := strings.Repeat("?,", len(ids)-1) + "?"
-	query := fmt.Sprintf(`DELETE FROM todos WHERE id IN (%s)`, placeholder)
+// validatePriority returns *model.ErrValidation unless priority is in range.
+func validatePriority(priority int) error {
+	if priority < model.MinTODOPriority || priority > model.MaxTODOPriority {
+		return model.NewErrValidation("priority", fmt.Sprintf("must be between %d and %d", model.MinTODOPriority, model.MaxTODOPriority))
+	}
+	return nil
+}
 
-	anyIDs := make([]interface{}, len(ids))
-	for i, id := range ids {
-		anyIDs[i] = id
+// sameTime reports whether a and b are both nil or the same instant.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return a.Equal(*b)
+}
 
-	res, err := s.db.ExecContext(ctx, query, anyIDs...)
-	if err != nil {
-		return fmt.Errorf("failed to delete todos: %w", err)
+// sameID reports whether a and b are both nil or the same id.
+func sameID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return *a == *b
+}
 
-	deletedCount, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to check affected rows: %w", err)
+// sameTags reports whether a and b name the same tags, ignoring the order and
+// the case like tags are looked up.
+func sameTags(a, b []string) bool {
+	seen := make(map[string]bool, len(a))
+	for _, tag := range a {
+		seen[repository.FoldCase(tag)] = true
 	}
-	if deletedCount == 0 {
-		return &model.ErrNotFound{}
+	for _, tag := range b {
+		if !seen[repository.FoldCase(tag)] {
+			return false
+		}
+		delete(seen, repository.FoldCase(tag))
 	}
+	return len(seen) == 0
+}
+
+// MarkTODODone marks the TODO on DB as done. Marking a done TODO keeps its
+// original completion time.
+func (s *TODOService) MarkTODODone(ctx context.Context, id int64) (*model.TODO, error) {
+	todo, err := s.repo.SetCompleted(ctx, id, true)
+	return s.published(model.TODOEventUpdated, todo, err)
+}
 
+// MarkTODOUndone marks the TODO on DB as not done yet.
+func (s *TODOService) MarkTODOUndone(ctx context.Context, id int64) (*model.TODO, error) {
+	todo, err := s.repo.SetCompleted(ctx, id, false)
+	return s.published(model.TODOEventUpdated, todo, err)
+}
+
+// DeleteTODO moves TODOs on DB by ids to the trash. IfVersion is meant for
+// deleting a single TODO. Moving to the trash is published as deletion, only
+// for the TODOs moved, and purging is not published again.
+func (s *TODOService) DeleteTODO(ctx context.Context, ids []int64, opts ...WriteOption) error {
+	o := newWriteOptions(opts)
+	deleted, err := s.repo.Delete(ctx, ids, o.version)
+	if err != nil {
+		return err
+	}
+	for _, id := range deleted {
+		s.publish(model.TODOEventDeleted, id, nil)
+	}
 	return nil
 }
+
+// RestoreTODO moves the TODO on DB back from the trash, which is published as
+// an update.
+func (s *TODOService) RestoreTODO(ctx context.Context, id int64) (*model.TODO, error) {
+	todo, err := s.repo.Restore(ctx, id)
+	return s.published(model.TODOEventUpdated, todo, err)
+}
+
+// PurgeTODO deletes TODOs in the trash on DB by ids permanently.
+func (s *TODOService) PurgeTODO(ctx context.Context, ids []int64) error {
+	return s.repo.Purge(ctx, ids)
+}
+
+// PurgeTrash deletes TODOs moved to the trash more than retention ago
+// permanently and returns how many were deleted.
+func (s *TODOService) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeDeletedBefore(ctx, time.Now().Add(-retention))
+}
+
+// PurgeTrashEvery runs PurgeTrash every interval until ctx is done. Failures
+// are logged and retried at the next interval.
+func (s *TODOService) PurgeTrashEvery(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeTrash(ctx, retention)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Println("service: failed to purge trash, err =", err)
+		case n != 0:
+			log.Printf("service: purged %d todos from trash", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/repository"
+)
+
+// Headers of a webhook delivery.
+const (
+	// WebhookEventHeader is the type of the event delivered.
+	WebhookEventHeader = "X-Webhook-Event"
+	// WebhookDeliveryHeader is the id of the delivery, the same among its
+	// attempts.
+	WebhookDeliveryHeader = "X-Webhook-Delivery"
+	// WebhookTimestampHeader is when the attempt was made in Unix time.
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookSignatureHeader is the signature made by SignWebhook prefixed
+	// with "sha256=".
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// minWebhookSecretLength is the limit of a secret given to a webhook.
+	minWebhookSecretLength = 16
+	// webhookBatchSize is the number of events dispatched, or deliveries
+	// attempted, at once.
+	webhookBatchSize = 100
+	// defaultWebhookTimeout bounds an attempt made by a Client without
+	// Timeout.
+	defaultWebhookTimeout = 10 * time.Second
+	// webhookLeaseMargin is added to the time a batch of attempts may take, to
+	// record their results before the deliveries are claimed again.
+	webhookLeaseMargin = time.Minute
+)
+
+// A WebhookService implements CRUD of Webhook entities, and delivers the
+// events recorded in the outbox to them.
+type WebhookService struct {
+	repo repository.WebhookRepository
+
+	// Client POSTs the deliveries. Its Timeout bounds an attempt, 10 seconds
+	// if not set, and the claimed deliveries are leased for long enough for
+	// all of them to time out.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is attempted until it fails.
+	MaxAttempts int
+	// MinBackoff is the delay of the first retry, which doubles with every
+	// retry up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Concurrency is the number of deliveries attempted in parallel.
+	Concurrency int
+	// DeliveryRetention is how long the deliveries which succeeded or failed
+	// are kept in the log. 0 keeps them forever.
+	DeliveryRetention time.Duration
+}
+
+// NewWebhookService returns new WebhookService.
+func NewWebhookService(repo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{
+		repo:        repo,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		MinBackoff:  10 * time.Second,
+		MaxBackoff:  time.Hour,
+		Concurrency: 8,
+		// a week, long enough to look into a failure
+		DeliveryRetention: 7 * 24 * time.Hour,
+	}
+}
+
+// CreateWebhook creates a webhook on DB, which delivers the events of types
+// in events, or all types if empty. A secret is generated unless given.
+func (s *WebhookService) CreateWebhook(ctx context.Context, rawURL string, events []model.TODOEventType, active bool, secret string) (*model.Webhook, error) {
+	if secret == "" {
+		secret = generateWebhookSecret()
+	}
+	hook, err := newWebhook(rawURL, events, active, secret)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CreateWebhook(ctx, hook)
+}
+
+// GetWebhook reads the webhook on DB by id.
+func (s *WebhookService) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	return s.repo.GetWebhook(ctx, id)
+}
+
+// ReadWebhooks reads all webhooks on DB in the order they were created.
+func (s *WebhookService) ReadWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	return s.repo.ListWebhooks(ctx)
+}
+
+// UpdateWebhook updates the webhook on DB, keeping its secret unless given.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id int64, rawURL string, events []model.TODOEventType, active bool, secret string) (*model.Webhook, error) {
+	hook, err := newWebhook(rawURL, events, active, secret)
+	if err != nil {
+		return nil, err
+	}
+	hook.ID = id
+	return s.repo.UpdateWebhook(ctx, hook)
+}
+
+// DeleteWebhook deletes the webhook on DB with its deliveries.
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id int64) error {
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// ReadDeliveries reads at most size deliveries of the webhook by webhookID,
+// the latest first, continuing after prevID.
+func (s *WebhookService) ReadDeliveries(ctx context.Context, webhookID, prevID, size int64) ([]*model.WebhookDelivery, error) {
+	return s.repo.ListDeliveries(ctx, webhookID, prevID, size)
+}
+
+// DeliverWebhooks prunes the deliveries older than DeliveryRetention, queues
+// the deliveries of the events recorded in the outbox, then attempts the
+// deliveries due, and returns how many were attempted.
+// A delivery succeeds with a 2xx response. Otherwise it is retried with
+// exponential backoff, and fails after MaxAttempts.
+func (s *WebhookService) DeliverWebhooks(ctx context.Context) (int, error) {
+	if s.DeliveryRetention > 0 {
+		if _, err := s.repo.PruneDeliveries(ctx, time.Now().Add(-s.DeliveryRetention)); err != nil {
+			return 0, fmt.Errorf("failed to prune deliveries: %w", err)
+		}
+	}
+
+	for {
+		n, err := s.repo.DispatchEvents(ctx, webhookBatchSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to dispatch events: %w", err)
+		}
+		if n < webhookBatchSize {
+			break
+		}
+	}
+
+	deliveries, err := s.repo.ClaimDeliveries(ctx, time.Now(), s.lease(webhookBatchSize), webhookBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, s.Concurrency)
+	)
+	for _, delivery := range deliveries {
+		delivery := delivery
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.attempt(ctx, delivery)
+			if err := s.repo.RecordDelivery(ctx, delivery); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return len(deliveries), fmt.Errorf("failed to record %d deliveries: %w", len(errs), errs[0])
+	}
+	return len(deliveries), nil
+}
+
+// DeliverWebhooksEvery runs DeliverWebhooks every interval until ctx is done.
+// Failures are logged and retried at the next interval.
+func (s *WebhookService) DeliverWebhooksEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DeliverWebhooks(ctx); err != nil && ctx.Err() == nil {
+			log.Println("service: failed to deliver webhooks, err =", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lease returns how long n deliveries claimed at once are put off, so that
+// they are not claimed again while attempted. The attempts run on Concurrency
+// workers, each taking up to the timeout of an attempt.
+func (s *WebhookService) lease(n int) time.Duration {
+	workers := s.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	rounds := (n + workers - 1) / workers
+	return time.Duration(rounds)*s.attemptTimeout() + webhookLeaseMargin
+}
+
+// attemptTimeout returns how long an attempt may take.
+func (s *WebhookService) attemptTimeout() time.Duration {
+	if s.Client.Timeout > 0 {
+		return s.Client.Timeout
+	}
+	return defaultWebhookTimeout
+}
+
+// attempt POSTs delivery to its webhook, and updates it by the result.
+func (s *WebhookService) attempt(ctx context.Context, delivery *model.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	status, err := s.post(ctx, delivery)
+	switch {
+	case err != nil:
+		delivery.LastError = err.Error()
+	case status < 200 || status > 299:
+		delivery.LastStatusCode = status
+		delivery.LastError = fmt.Sprintf("unexpected status %d", status)
+	default:
+		delivery.LastStatusCode = status
+		delivery.Status = model.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	if delivery.Attempts >= s.MaxAttempts {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		return
+	}
+	next := time.Now().Add(s.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+// post sends the event of delivery signed, and returns the response status.
+func (s *WebhookService) post(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.Client.Timeout <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultWebhookTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event.Type))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drained a little so that the connection may be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	d := s.MinBackoff
+	for i := 1; i < attempts && d < s.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.MaxBackoff {
+		d = s.MaxBackoff
+	}
+	return d
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of the timestamp and body
+// of a delivery joined with a dot, keyed with the secret of the webhook.
+// Receivers verify the X-Webhook-Signature header with it.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhook validates the fields of a webhook. secret may be empty.
+func newWebhook(rawURL string, events []model.TODOEventType, active bool, secret string) (*model.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, model.NewErrValidation("url", "must be an absolute http or https URL")
+	}
+
+	seen := make(map[model.TODOEventType]bool, len(events))
+	for _, event := range events {
+		switch event {
+		case model.TODOEventCreated, model.TODOEventUpdated, model.TODOEventDeleted:
+		default:
+			return nil, model.NewErrValidation("events", fmt.Sprintf("must not contain unknown event %q", event))
+		}
+		if seen[event] {
+			return nil, model.NewErrValidation("events", fmt.Sprintf("must not contain %q twice", event))
+		}
+		seen[event] = true
+	}
+
+	if secret != "" && len(secret) < minWebhookSecretLength {
+		return nil, model.NewErrValidation("secret", fmt.Sprintf("must be at least %d characters", minWebhookSecretLength))
+	}
+
+	return &model.Webhook{URL: rawURL, Events: events, Active: active, Secret: secret}, nil
+}
+
+// generateWebhookSecret returns a random secret of 256 bits.
+func generateWebhookSecret() string {
+	b := make([]byte, 32)
+	// crypto/rand never fails on supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}